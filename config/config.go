@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
 	BucketName           string `json:"bucketName"`
 	Region               string `json:"region"`
 	DownloadURLTimeLimit int    `json:"downloadURLTimeLimit"`
+	UploadURLTimeLimit   int    `json:"uploadURLTimeLimit"`
+	MaxUploadSizeMB      int    `json:"maxUploadSizeMB"`
 	PaginationPageSize   int    `json:"paginationPageSize"`
 	AwsAccessKeyID       string `json:"awsAccessKeyId"`
 	AwsSecretAccessKey   string `json:"awsSecretAccessKey"`
@@ -23,6 +26,16 @@ type Config struct {
 	SendGridAPIKey       string `json:"sendGridApiKey"`
 	SendGridAPIURL       string `json:"sendGridApiUrl"`
 	MailFrom             string `json:"mailFrom"`
+	APIKeyGraceHours     int    `json:"apiKeyGraceHours"`
+	APIKeyWarningDays    int    `json:"apiKeyWarningDays"`
+	APIKeySigningSecret  string `json:"apiKeySigningSecret"`
+	MFAEncryptionKey     string `json:"mfaEncryptionKey"`
+	SSOEncryptionKey     string `json:"ssoEncryptionKey"`
+	SSORedirectURL       string `json:"ssoRedirectUrl"`
+	// UnverifiedUploads lets clients upload before confirming their email address
+	UnverifiedUploads bool `json:"unverifiedUploads"`
+	// SSOAllowHTTPIssuers accepts identity providers without https or on internal addresses, for local mock providers
+	SSOAllowHTTPIssuers bool `json:"ssoAllowHttpIssuers"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -41,6 +54,22 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	if val := os.Getenv("UPLOAD_URL_TIME_LIMIT"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.UploadURLTimeLimit = parsed
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid UPLOAD_URL_TIME_LIMIT value '%s', using default\n", val)
+		}
+	}
+
+	if val := os.Getenv("MAX_UPLOAD_SIZE_MB"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.MaxUploadSizeMB = parsed
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid MAX_UPLOAD_SIZE_MB value '%s', using default\n", val)
+		}
+	}
+
 	if val := os.Getenv("PAGINATION_PAGE_SIZE"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
 			config.PaginationPageSize = parsed
@@ -49,6 +78,39 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	if val := os.Getenv("API_KEY_ROTATION_GRACE_HOURS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.APIKeyGraceHours = parsed
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid API_KEY_ROTATION_GRACE_HOURS value '%s', using default\n", val)
+		}
+	}
+
+	if val := os.Getenv("API_KEY_EXPIRY_WARNING_DAYS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.APIKeyWarningDays = parsed
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid API_KEY_EXPIRY_WARNING_DAYS value '%s', using default\n", val)
+		}
+	}
+
+	config.UnverifiedUploads = true
+	if val := os.Getenv("ALLOW_UNVERIFIED_UPLOADS"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			config.UnverifiedUploads = parsed
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid ALLOW_UNVERIFIED_UPLOADS value '%s', using default\n", val)
+		}
+	}
+
+	if val := os.Getenv("SSO_ALLOW_HTTP_ISSUERS"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			config.SSOAllowHTTPIssuers = parsed
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid SSO_ALLOW_HTTP_ISSUERS value '%s', using default\n", val)
+		}
+	}
+
 	config.AwsAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
 	config.AwsSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
 	config.DatabaseURL = os.Getenv("DATABASE_URL")
@@ -61,6 +123,10 @@ func LoadConfig() (*Config, error) {
 	config.SendGridAPIKey = os.Getenv("SENDGRID_API_KEY")
 	config.SendGridAPIURL = os.Getenv("SENDGRID_API_URL")
 	config.MailFrom = os.Getenv("MAIL_FROM")
+	config.APIKeySigningSecret = os.Getenv("API_KEY_SIGNING_SECRET")
+	config.MFAEncryptionKey = os.Getenv("MFA_ENCRYPTION_KEY")
+	config.SSOEncryptionKey = os.Getenv("SSO_ENCRYPTION_KEY")
+	config.SSORedirectURL = os.Getenv("SSO_REDIRECT_URL")
 
 	if config.BucketName == "" {
 		return nil, fmt.Errorf("BUCKET_NAME must be set")
@@ -70,10 +136,26 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("REGION must be set")
 	}
 
-	if config.DownloadURLTimeLimit == 0 {
+	if config.DownloadURLTimeLimit <= 0 {
 		config.DownloadURLTimeLimit = 15
 	}
 
+	if config.UploadURLTimeLimit <= 0 {
+		config.UploadURLTimeLimit = 15
+	}
+
+	if config.MaxUploadSizeMB <= 0 {
+		config.MaxUploadSizeMB = 100
+	}
+
+	if config.APIKeyGraceHours <= 0 {
+		config.APIKeyGraceHours = 24
+	}
+
+	if config.APIKeyWarningDays <= 0 {
+		config.APIKeyWarningDays = 7
+	}
+
 	if config.PaginationPageSize == 0 {
 		config.PaginationPageSize = 100
 	}
@@ -94,10 +176,26 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("JWT_SECRET must be set")
 	}
 
+	if config.APIKeySigningSecret == "" {
+		config.APIKeySigningSecret = config.JWTSecret
+	}
+
+	if config.MFAEncryptionKey == "" {
+		config.MFAEncryptionKey = config.JWTSecret
+	}
+
+	if config.SSOEncryptionKey == "" {
+		config.SSOEncryptionKey = config.JWTSecret
+	}
+
 	if config.AppBaseURL == "" {
 		config.AppBaseURL = "http://localhost:3000"
 	}
 
+	if config.SSORedirectURL == "" {
+		config.SSORedirectURL = strings.TrimRight(config.AppBaseURL, "/") + "/sso/callback"
+	}
+
 	if config.AppName == "" {
 		config.AppName = "Orka File Service"
 	}
@@ -0,0 +1,7 @@
+-- Migration: Per-project presigned URL lifetimes and upload size cap
+-- NULL means the global DOWNLOAD_URL_TIME_LIMIT / UPLOAD_URL_TIME_LIMIT / MAX_UPLOAD_SIZE_MB applies
+
+ALTER TABLE projects
+  ADD COLUMN IF NOT EXISTS download_url_ttl_seconds INTEGER,
+  ADD COLUMN IF NOT EXISTS upload_url_ttl_seconds INTEGER,
+  ADD COLUMN IF NOT EXISTS max_upload_size_bytes BIGINT;
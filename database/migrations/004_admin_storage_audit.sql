@@ -0,0 +1,21 @@
+-- Migration: Operator role and audit trail for the admin bucket-browser API
+-- Grant the role manually: UPDATE clients SET platform_role = 'operator' WHERE email = '...';
+
+ALTER TABLE clients
+  ADD COLUMN IF NOT EXISTS platform_role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_client_id UUID REFERENCES clients(id) ON DELETE SET NULL,
+    action VARCHAR(100) NOT NULL,
+    resource TEXT NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    status_code INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_client_id);
@@ -0,0 +1,8 @@
+-- Migration: Indexes backing keyset pagination on listings
+-- Each index matches the ORDER BY of its listing so pages are read without sorting the whole set
+
+CREATE INDEX IF NOT EXISTS idx_assets_project_latest_created ON assets(project_id, created_at DESC, id DESC) WHERE is_latest = TRUE;
+CREATE INDEX IF NOT EXISTS idx_assets_parent_version ON assets(parent_asset_id, version DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_projects_client_created ON projects(client_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_project_members_project_created ON project_members(project_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_client_created ON api_keys(client_id, created_at DESC, id DESC);
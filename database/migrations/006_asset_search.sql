@@ -0,0 +1,31 @@
+-- Migration: Full-text and trigram search on assets
+-- search_vector is maintained by trigger: filename (A), folder path (B), MIME type (C)
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE assets
+  ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+CREATE OR REPLACE FUNCTION assets_search_vector_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.original_filename, ''), '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.folder_path, ''), '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.mime_type, ''), '[^[:alnum:]]+', ' ', 'g')), 'C');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_assets_search_vector ON assets;
+CREATE TRIGGER trigger_assets_search_vector
+BEFORE INSERT OR UPDATE OF original_filename, folder_path, mime_type ON assets
+FOR EACH ROW
+EXECUTE FUNCTION assets_search_vector_update();
+
+-- Backfill existing rows through the trigger
+UPDATE assets SET original_filename = original_filename;
+
+CREATE INDEX IF NOT EXISTS idx_assets_search_vector ON assets USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_assets_filename_trgm ON assets USING GIN (original_filename gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_assets_folder_path_trgm ON assets USING GIN (folder_path gin_trgm_ops);
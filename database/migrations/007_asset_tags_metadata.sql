@@ -0,0 +1,28 @@
+-- Migration: Tags and string key/value metadata on assets
+-- Both are indexed for containment filters and included in search_vector (tags B, metadata D)
+
+ALTER TABLE assets
+  ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_assets_tags ON assets USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_assets_metadata ON assets USING GIN (metadata jsonb_path_ops);
+
+CREATE OR REPLACE FUNCTION assets_search_vector_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.original_filename, ''), '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.folder_path, ''), '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(array_to_string(NEW.tags, ' '), '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.mime_type, ''), '[^[:alnum:]]+', ' ', 'g')), 'C') ||
+        setweight(to_tsvector('simple', COALESCE((SELECT string_agg(value, ' ') FROM jsonb_each_text(NEW.metadata)), '')), 'D');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_assets_search_vector ON assets;
+CREATE TRIGGER trigger_assets_search_vector
+BEFORE INSERT OR UPDATE OF original_filename, folder_path, mime_type, tags, metadata ON assets
+FOR EACH ROW
+EXECUTE FUNCTION assets_search_vector_update();
@@ -0,0 +1,17 @@
+-- Migration: Versioned per-project metadata schemas
+-- assets.metadata_schema_version records the schema version an asset's metadata was validated against (NULL = none)
+
+CREATE TABLE IF NOT EXISTS project_metadata_schemas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    schema JSONB NOT NULL,
+    created_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(project_id, version)
+);
+
+ALTER TABLE assets
+  ADD COLUMN IF NOT EXISTS metadata_schema_version INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_assets_project_schema_version ON assets(project_id, metadata_schema_version);
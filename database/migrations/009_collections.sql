@@ -0,0 +1,26 @@
+-- Migration: Project-scoped collections (albums) of assets across folders
+-- Positions are unique per collection; the constraint is deferred so members can be shifted in one statement
+
+CREATE TABLE IF NOT EXISTS collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    cover_asset_id UUID REFERENCES assets(id) ON DELETE SET NULL,
+    created_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS collection_assets (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    added_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (collection_id, asset_id),
+    UNIQUE (collection_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE INDEX IF NOT EXISTS idx_collections_project_created ON collections(project_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_collection_assets_asset_id ON collection_assets(asset_id);
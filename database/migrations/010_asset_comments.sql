@@ -0,0 +1,26 @@
+-- Migration: Threaded comments and review annotations on assets
+-- root_asset_id is the first version of the chain so comments carry across versions;
+-- region_* are fractions of the image size and timestamp_* are seconds into audio or video
+
+CREATE TABLE IF NOT EXISTS asset_comments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    root_asset_id UUID NOT NULL,
+    parent_id UUID REFERENCES asset_comments(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES clients(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    region_x DOUBLE PRECISION,
+    region_y DOUBLE PRECISION,
+    region_w DOUBLE PRECISION,
+    region_h DOUBLE PRECISION,
+    timestamp_start DOUBLE PRECISION,
+    timestamp_end DOUBLE PRECISION,
+    mentions UUID[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    edited_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_comments_root_created ON asset_comments(root_asset_id, created_at, id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_asset_comments_parent_id ON asset_comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_asset_comments_asset_id ON asset_comments(asset_id);
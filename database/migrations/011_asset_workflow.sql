@@ -0,0 +1,22 @@
+-- Migration: Publishing workflow states for assets
+-- projects.workflow holds the project's transitions (NULL = built-in default)
+
+ALTER TABLE projects
+  ADD COLUMN IF NOT EXISTS workflow JSONB;
+
+ALTER TABLE assets
+  ADD COLUMN IF NOT EXISTS state VARCHAR(20) NOT NULL DEFAULT 'draft'
+    CHECK (state IN ('draft', 'in_review', 'approved', 'rejected', 'published', 'archived'));
+
+CREATE TABLE IF NOT EXISTS asset_state_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    from_state VARCHAR(20) NOT NULL,
+    to_state VARCHAR(20) NOT NULL,
+    changed_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_assets_project_state ON assets(project_id, state);
+CREATE INDEX IF NOT EXISTS idx_asset_state_history_asset_created ON asset_state_history(asset_id, created_at DESC, id DESC);
@@ -0,0 +1,44 @@
+-- Migration: Stable alias paths (/p/<project slug>/<folder path>/<filename>) resolving to the latest version
+-- Slugs default to the project name plus the start of its id; asset_pins holds chains pinned to a version
+
+CREATE OR REPLACE FUNCTION project_default_slug(project_name TEXT, project_id UUID)
+RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(trim(both '-' from left(regexp_replace(lower(project_name), '[^a-z0-9]+', '-', 'g'), 40)), ''), 'project')
+        || '-' || left(replace(project_id::text, '-', ''), 8);
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE projects
+  ADD COLUMN IF NOT EXISTS slug VARCHAR(63),
+  ADD COLUMN IF NOT EXISTS public_aliases BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE projects SET slug = project_default_slug(name, id) WHERE slug IS NULL;
+
+ALTER TABLE projects
+  ALTER COLUMN slug SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_slug ON projects(slug);
+
+CREATE OR REPLACE FUNCTION set_project_slug()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.slug IS NULL THEN
+        NEW.slug := project_default_slug(NEW.name, NEW.id);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_set_project_slug ON projects;
+CREATE TRIGGER trigger_set_project_slug
+BEFORE INSERT ON projects
+FOR EACH ROW
+EXECUTE FUNCTION set_project_slug();
+
+CREATE TABLE IF NOT EXISTS asset_pins (
+    root_asset_id UUID PRIMARY KEY,
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    pinned_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_assets_alias_path ON assets(project_id, folder_path, original_filename) WHERE is_latest = TRUE;
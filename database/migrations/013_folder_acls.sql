@@ -0,0 +1,17 @@
+-- Migration: Folder-level access control lists
+-- An entry grants a member viewer or editor access to a folder subtree, or denies it ('none').
+-- The entry on the deepest matching folder wins over the member's project role; owners are never restricted.
+
+CREATE TABLE IF NOT EXISTS folder_acls (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    folder_path TEXT NOT NULL,
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('viewer', 'editor', 'none')),
+    created_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(project_id, folder_path, client_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_folder_acls_project_client ON folder_acls(project_id, client_id);
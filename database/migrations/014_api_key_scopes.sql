@@ -0,0 +1,9 @@
+-- Migration: Fine-grained API key scopes
+-- Empty arrays leave a key unrestricted on that dimension; a NULL rate limit means no per-key limit.
+-- Folder prefixes are normalized folder paths ("/builds/") covering the folder and its subfolders.
+
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS allowed_folders TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS allowed_cidrs TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS allowed_methods TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS rate_limit_per_minute INTEGER CHECK (rate_limit_per_minute > 0);
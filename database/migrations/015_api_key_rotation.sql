@@ -0,0 +1,12 @@
+-- Migration: API key rotation with overlapping validity
+-- A rotated key points at its successor and keeps working until grace_ends_at, when it is deactivated.
+-- expiry_warning_sent_at records the reminder email so each key is warned about its expiry once.
+
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS rotated_from_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS superseded_by_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS grace_ends_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS expiry_warning_sent_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_grace_ends_at ON api_keys(grace_ends_at) WHERE is_active = TRUE AND grace_ends_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_api_keys_expires_at ON api_keys(expires_at) WHERE is_active = TRUE AND expires_at IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Migration: API key usage analytics
+-- Requests are counted per key, hourly bucket, route and status; writes are batched by the service.
+
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    bucket_start TIMESTAMP NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    status_code INTEGER NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    bytes_uploaded BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, bucket_start, route, status_code)
+);
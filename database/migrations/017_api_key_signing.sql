@@ -0,0 +1,16 @@
+-- Migration: HMAC request signing for API keys
+-- signing_salt is set once signing is enabled; the secret is derived from it and API_KEY_SIGNING_SECRET.
+-- require_signed refuses the raw X-API-Key header for the key. Nonces are kept until their timestamp can no longer pass the skew check.
+
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS signing_salt VARCHAR(64),
+  ADD COLUMN IF NOT EXISTS require_signed BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS api_key_nonces (
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (api_key_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_key_nonces_expires_at ON api_key_nonces(expires_at);
@@ -0,0 +1,10 @@
+-- Migration: Refresh token rotation and revocation
+-- Every login starts a family; each refresh replaces the presented token with a new one in the same family.
+-- Presenting a replaced token again means it leaked, so the whole family is revoked.
+
+ALTER TABLE refresh_tokens
+  ADD COLUMN IF NOT EXISTS family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+  ADD COLUMN IF NOT EXISTS replaced_by_id UUID REFERENCES refresh_tokens(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,26 @@
+-- Migration: Sessions
+-- A session is one login: its refresh token family plus where it came from.
+-- Existing families become sessions without device details.
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip_address VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT NOW(),
+  last_seen_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO sessions (id, client_id, created_at, last_seen_at)
+SELECT family_id, client_id, MIN(created_at), MAX(created_at)
+FROM refresh_tokens
+GROUP BY family_id, client_id
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id DROP DEFAULT;
+
+ALTER TABLE refresh_tokens
+  DROP CONSTRAINT IF EXISTS refresh_tokens_family_id_fkey,
+  ADD CONSTRAINT refresh_tokens_family_id_fkey FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_client_last_seen ON sessions(client_id, last_seen_at DESC);
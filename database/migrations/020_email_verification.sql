@@ -0,0 +1,20 @@
+-- Migration: Email verification
+-- Signups confirm their address, and email changes take effect once the new address is confirmed.
+-- Accounts that existed before verification are treated as verified.
+
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+UPDATE clients SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  email VARCHAR(255) NOT NULL,
+  purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('signup', 'email_change')),
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_client_id ON email_verification_tokens(client_id, purpose);
@@ -0,0 +1,14 @@
+-- Migration: Password reset tokens
+-- Reset links carry a random token stored only as a hash. A token works once and every
+-- outstanding token of a client stops working when its password changes.
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_client_id ON password_reset_tokens(client_id) WHERE used_at IS NULL;
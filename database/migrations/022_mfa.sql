@@ -0,0 +1,20 @@
+-- Migration: TOTP two-factor authentication
+-- The TOTP secret is stored encrypted; it only counts once enrolment is confirmed (mfa_enabled_at).
+-- mfa_last_step keeps a code from being used twice. Recovery codes are stored hashed and work once.
+
+ALTER TABLE clients
+  ADD COLUMN IF NOT EXISTS mfa_secret TEXT,
+  ADD COLUMN IF NOT EXISTS mfa_enabled_at TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (client_id, code_hash)
+);
+
+-- Owners can require every member to have two-factor authentication enabled
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS require_mfa BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,25 @@
+-- Migration: Login failure tracking and account lockout
+-- Failed logins are counted per account (normalised email) and per IP address. Each scope/subject
+-- row carries the time until which further attempts are refused; an account locks after repeated
+-- failures and the owner is emailed a single-use unlock link.
+
+CREATE TABLE IF NOT EXISTS login_failures (
+  scope VARCHAR(16) NOT NULL CHECK (scope IN ('account', 'ip')),
+  subject TEXT NOT NULL,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  blocked_until TIMESTAMP,
+  PRIMARY KEY (scope, subject)
+);
+
+CREATE TABLE IF NOT EXISTS account_unlock_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failed_at ON login_failures(last_failed_at);
+CREATE INDEX IF NOT EXISTS idx_account_unlock_tokens_client_id ON account_unlock_tokens(client_id) WHERE used_at IS NULL;
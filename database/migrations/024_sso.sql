@@ -0,0 +1,71 @@
+-- Migration: OpenID Connect single sign-on
+-- An SSO connection is one organisation's identity provider. Logins through it are restricted to the
+-- connection's verified email domains: operators' claims are verified right away, others by a DNS TXT
+-- record, and only one connection can hold a verified claim on a domain. Clients are provisioned on first
+-- login and linked to the provider's subject; existing accounts are only linked by their signed-in owner.
+-- Group claims grant project roles through group mappings, and memberships granted that way are tagged
+-- with the connection so later logins can revoke them.
+
+CREATE TABLE IF NOT EXISTS sso_connections (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  slug VARCHAR(63) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  issuer TEXT NOT NULL,
+  oidc_client_id TEXT NOT NULL,
+  oidc_client_secret TEXT NOT NULL,
+  groups_claim VARCHAR(100) NOT NULL DEFAULT 'groups',
+  trust_unverified_email BOOLEAN NOT NULL DEFAULT FALSE,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS sso_domains (
+  domain VARCHAR(255) NOT NULL,
+  connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+  verification_token VARCHAR(64) NOT NULL,
+  verified_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (connection_id, domain)
+);
+
+CREATE TABLE IF NOT EXISTS sso_group_mappings (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+  group_name TEXT NOT NULL,
+  project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+  role VARCHAR(50) NOT NULL CHECK (role IN ('editor', 'viewer')),
+  created_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (connection_id, group_name, project_id)
+);
+
+CREATE TABLE IF NOT EXISTS sso_identities (
+  connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+  subject TEXT NOT NULL,
+  client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  created_at TIMESTAMP DEFAULT NOW(),
+  last_login_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (connection_id, subject)
+);
+
+-- Pending logins: the state sent to the provider, with the PKCE verifier and nonce it is redeemed with.
+-- link_client_id marks a signed-in client linking the identity to its account.
+CREATE TABLE IF NOT EXISTS sso_login_states (
+  state_hash VARCHAR(64) PRIMARY KEY,
+  connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+  code_verifier TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  link_client_id UUID REFERENCES clients(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+ALTER TABLE project_members
+  ADD COLUMN IF NOT EXISTS sso_connection_id UUID REFERENCES sso_connections(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sso_connections_client_id ON sso_connections(client_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sso_domains_verified ON sso_domains(domain) WHERE verified_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_sso_identities_client_id ON sso_identities(client_id);
+CREATE INDEX IF NOT EXISTS idx_sso_login_states_expires_at ON sso_login_states(expires_at);
+CREATE INDEX IF NOT EXISTS idx_project_members_sso_connection ON project_members(sso_connection_id) WHERE sso_connection_id IS NOT NULL;
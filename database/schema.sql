@@ -1,13 +1,20 @@
 -- Orkait Asset Management - Database Schema
 
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE clients (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     name VARCHAR(255) NOT NULL,
     email VARCHAR(255) UNIQUE NOT NULL,
     password_hash VARCHAR(255) NOT NULL,
     status VARCHAR(20) NOT NULL DEFAULT 'active',
+    platform_role VARCHAR(20) NOT NULL DEFAULT 'user',
     paused_at TIMESTAMP,
     scheduled_deletion_at TIMESTAMP,
+    email_verified_at TIMESTAMP,
+    mfa_secret TEXT,
+    mfa_enabled_at TIMESTAMP,
+    mfa_last_step BIGINT,
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW()
 );
@@ -17,6 +24,13 @@ CREATE TABLE projects (
     client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     description TEXT,
+    download_url_ttl_seconds INTEGER,
+    upload_url_ttl_seconds INTEGER,
+    max_upload_size_bytes BIGINT,
+    workflow JSONB,
+    slug VARCHAR(63) NOT NULL UNIQUE,
+    public_aliases BOOLEAN NOT NULL DEFAULT FALSE,
+    require_mfa BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW(),
     UNIQUE(client_id, name)
@@ -30,6 +44,16 @@ CREATE TABLE api_keys (
     key_prefix VARCHAR(50) NOT NULL,
     name VARCHAR(255) NOT NULL,
     permissions JSONB NOT NULL DEFAULT '["read"]',
+    allowed_folders TEXT[] NOT NULL DEFAULT '{}',
+    allowed_cidrs TEXT[] NOT NULL DEFAULT '{}',
+    allowed_methods TEXT[] NOT NULL DEFAULT '{}',
+    rate_limit_per_minute INTEGER CHECK (rate_limit_per_minute > 0),
+    rotated_from_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    superseded_by_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    grace_ends_at TIMESTAMP,
+    expiry_warning_sent_at TIMESTAMP,
+    signing_salt VARCHAR(64),
+    require_signed BOOLEAN NOT NULL DEFAULT FALSE,
     is_active BOOLEAN DEFAULT TRUE,
     last_used_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT NOW(),
@@ -49,14 +73,132 @@ CREATE TABLE assets (
     version INTEGER DEFAULT 1,
     is_latest BOOLEAN DEFAULT TRUE,
     parent_asset_id UUID REFERENCES assets(id),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    metadata_schema_version INTEGER,
+    state VARCHAR(20) NOT NULL DEFAULT 'draft'
+        CHECK (state IN ('draft', 'in_review', 'approved', 'rejected', 'published', 'archived')),
+    search_vector TSVECTOR,
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW()
 );
 
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW(),
+    last_seen_at TIMESTAMP DEFAULT NOW()
+);
+
 CREATE TABLE refresh_tokens (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
     token_hash VARCHAR(255) NOT NULL UNIQUE,
+    family_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    replaced_by_id UUID REFERENCES refresh_tokens(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE email_verification_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('signup', 'email_change')),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (client_id, code_hash)
+);
+
+CREATE TABLE login_failures (
+    scope VARCHAR(16) NOT NULL CHECK (scope IN ('account', 'ip')),
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMP,
+    PRIMARY KEY (scope, subject)
+);
+
+CREATE TABLE account_unlock_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE sso_connections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    slug VARCHAR(63) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    issuer TEXT NOT NULL,
+    oidc_client_id TEXT NOT NULL,
+    oidc_client_secret TEXT NOT NULL,
+    groups_claim VARCHAR(100) NOT NULL DEFAULT 'groups',
+    trust_unverified_email BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE sso_domains (
+    domain VARCHAR(255) NOT NULL,
+    connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+    verification_token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (connection_id, domain)
+);
+
+CREATE TABLE sso_group_mappings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+    group_name TEXT NOT NULL,
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('editor', 'viewer')),
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (connection_id, group_name, project_id)
+);
+
+CREATE TABLE sso_identities (
+    connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    last_login_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (connection_id, subject)
+);
+
+CREATE TABLE sso_login_states (
+    state_hash VARCHAR(64) PRIMARY KEY,
+    connection_id UUID NOT NULL REFERENCES sso_connections(id) ON DELETE CASCADE,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    link_client_id UUID REFERENCES clients(id) ON DELETE CASCADE,
     expires_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP DEFAULT NOW()
 );
@@ -67,11 +209,120 @@ CREATE TABLE project_members (
     client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
     role VARCHAR(50) DEFAULT 'viewer',
     invited_by UUID REFERENCES clients(id),
+    sso_connection_id UUID REFERENCES sso_connections(id) ON DELETE SET NULL,
     created_at TIMESTAMP DEFAULT NOW(),
     UNIQUE(project_id, client_id)
 );
 
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_client_id UUID REFERENCES clients(id) ON DELETE SET NULL,
+    action VARCHAR(100) NOT NULL,
+    resource TEXT NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    status_code INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE project_metadata_schemas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    schema JSONB NOT NULL,
+    created_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(project_id, version)
+);
+
+CREATE TABLE collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    cover_asset_id UUID REFERENCES assets(id) ON DELETE SET NULL,
+    created_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE collection_assets (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    added_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (collection_id, asset_id),
+    UNIQUE (collection_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE TABLE asset_comments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    root_asset_id UUID NOT NULL,
+    parent_id UUID REFERENCES asset_comments(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES clients(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    region_x DOUBLE PRECISION,
+    region_y DOUBLE PRECISION,
+    region_w DOUBLE PRECISION,
+    region_h DOUBLE PRECISION,
+    timestamp_start DOUBLE PRECISION,
+    timestamp_end DOUBLE PRECISION,
+    mentions UUID[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    edited_at TIMESTAMP
+);
+
+CREATE TABLE asset_state_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    from_state VARCHAR(20) NOT NULL,
+    to_state VARCHAR(20) NOT NULL,
+    changed_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE asset_pins (
+    root_asset_id UUID PRIMARY KEY,
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    pinned_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE folder_acls (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    folder_path TEXT NOT NULL,
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('viewer', 'editor', 'none')),
+    created_by UUID REFERENCES clients(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(project_id, folder_path, client_id)
+);
+
 CREATE INDEX idx_projects_client_id ON projects(client_id);
+CREATE TABLE api_key_usage (
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    bucket_start TIMESTAMP NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    status_code INTEGER NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    bytes_uploaded BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, bucket_start, route, status_code)
+);
+
+CREATE TABLE api_key_nonces (
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (api_key_id, nonce)
+);
+
 CREATE INDEX idx_api_keys_client_id ON api_keys(client_id);
 CREATE INDEX idx_api_keys_project_id ON api_keys(project_id);
 CREATE INDEX idx_api_keys_key_hash ON api_keys(key_hash);
@@ -87,6 +338,43 @@ CREATE INDEX idx_project_members_project_id ON project_members(project_id);
 CREATE INDEX idx_project_members_client_id ON project_members(client_id);
 CREATE INDEX idx_clients_status ON clients(status);
 CREATE INDEX idx_clients_scheduled_deletion_at ON clients(scheduled_deletion_at) WHERE status = 'paused';
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_client_id);
+CREATE INDEX idx_assets_project_latest_created ON assets(project_id, created_at DESC, id DESC) WHERE is_latest = TRUE;
+CREATE INDEX idx_assets_parent_version ON assets(parent_asset_id, version DESC, id DESC);
+CREATE INDEX idx_projects_client_created ON projects(client_id, created_at DESC, id DESC);
+CREATE INDEX idx_project_members_project_created ON project_members(project_id, created_at, id);
+CREATE INDEX idx_api_keys_client_created ON api_keys(client_id, created_at DESC, id DESC);
+CREATE INDEX idx_assets_search_vector ON assets USING GIN (search_vector);
+CREATE INDEX idx_assets_filename_trgm ON assets USING GIN (original_filename gin_trgm_ops);
+CREATE INDEX idx_assets_folder_path_trgm ON assets USING GIN (folder_path gin_trgm_ops);
+CREATE INDEX idx_assets_tags ON assets USING GIN (tags);
+CREATE INDEX idx_assets_metadata ON assets USING GIN (metadata jsonb_path_ops);
+CREATE INDEX idx_assets_project_schema_version ON assets(project_id, metadata_schema_version);
+CREATE INDEX idx_collections_project_created ON collections(project_id, created_at DESC, id DESC);
+CREATE INDEX idx_collection_assets_asset_id ON collection_assets(asset_id);
+CREATE INDEX idx_asset_comments_root_created ON asset_comments(root_asset_id, created_at, id) WHERE parent_id IS NULL;
+CREATE INDEX idx_asset_comments_parent_id ON asset_comments(parent_id);
+CREATE INDEX idx_asset_comments_asset_id ON asset_comments(asset_id);
+CREATE INDEX idx_assets_project_state ON assets(project_id, state);
+CREATE INDEX idx_asset_state_history_asset_created ON asset_state_history(asset_id, created_at DESC, id DESC);
+CREATE INDEX idx_assets_alias_path ON assets(project_id, folder_path, original_filename) WHERE is_latest = TRUE;
+CREATE INDEX idx_folder_acls_project_client ON folder_acls(project_id, client_id);
+CREATE INDEX idx_api_keys_grace_ends_at ON api_keys(grace_ends_at) WHERE is_active = TRUE AND grace_ends_at IS NOT NULL;
+CREATE INDEX idx_api_keys_expires_at ON api_keys(expires_at) WHERE is_active = TRUE AND expires_at IS NOT NULL;
+CREATE INDEX idx_api_key_nonces_expires_at ON api_key_nonces(expires_at);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX idx_sessions_client_last_seen ON sessions(client_id, last_seen_at DESC);
+CREATE INDEX idx_email_verification_tokens_client_id ON email_verification_tokens(client_id, purpose);
+CREATE INDEX idx_password_reset_tokens_client_id ON password_reset_tokens(client_id) WHERE used_at IS NULL;
+CREATE INDEX idx_login_failures_last_failed_at ON login_failures(last_failed_at);
+CREATE INDEX idx_account_unlock_tokens_client_id ON account_unlock_tokens(client_id) WHERE used_at IS NULL;
+CREATE INDEX idx_sso_connections_client_id ON sso_connections(client_id);
+CREATE UNIQUE INDEX idx_sso_domains_verified ON sso_domains(domain) WHERE verified_at IS NOT NULL;
+CREATE INDEX idx_sso_identities_client_id ON sso_identities(client_id);
+CREATE INDEX idx_sso_login_states_expires_at ON sso_login_states(expires_at);
+CREATE INDEX idx_project_members_sso_connection ON project_members(sso_connection_id) WHERE sso_connection_id IS NOT NULL;
 
 CREATE OR REPLACE FUNCTION create_default_project()
 RETURNS TRIGGER AS $$
@@ -102,6 +390,27 @@ AFTER INSERT ON clients
 FOR EACH ROW
 EXECUTE FUNCTION create_default_project();
 
+CREATE OR REPLACE FUNCTION project_default_slug(project_name TEXT, project_id UUID)
+RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(trim(both '-' from left(regexp_replace(lower(project_name), '[^a-z0-9]+', '-', 'g'), 40)), ''), 'project')
+        || '-' || left(replace(project_id::text, '-', ''), 8);
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION set_project_slug()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.slug IS NULL THEN
+        NEW.slug := project_default_slug(NEW.name, NEW.id);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_set_project_slug
+BEFORE INSERT ON projects
+FOR EACH ROW
+EXECUTE FUNCTION set_project_slug();
+
 CREATE OR REPLACE FUNCTION add_project_owner()
 RETURNS TRIGGER AS $$
 BEGIN
@@ -115,3 +424,21 @@ CREATE TRIGGER trigger_add_project_owner
 AFTER INSERT ON projects
 FOR EACH ROW
 EXECUTE FUNCTION add_project_owner();
+
+CREATE OR REPLACE FUNCTION assets_search_vector_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.original_filename, ''), '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.folder_path, ''), '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(array_to_string(NEW.tags, ' '), '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(COALESCE(NEW.mime_type, ''), '[^[:alnum:]]+', ' ', 'g')), 'C') ||
+        setweight(to_tsvector('simple', COALESCE((SELECT string_agg(value, ' ') FROM jsonb_each_text(NEW.metadata)), '')), 'D');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_assets_search_vector
+BEFORE INSERT OR UPDATE OF original_filename, folder_path, mime_type, tags, metadata ON assets
+FOR EACH ROW
+EXECUTE FUNCTION assets_search_vector_update();
@@ -9,6 +9,9 @@ import (
 	mailerproviders "file-service/pkg/mailer/providers"
 	mailerstrategies "file-service/pkg/mailer/strategies"
 	"file-service/pkg/middleware"
+	"file-service/pkg/oidc"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
 	"file-service/pkg/repository"
 	"file-service/pkg/s3"
 	"file-service/routes"
@@ -132,6 +135,9 @@ func buildEmailService(cfg *config.Config) *mailerpkg.EmailService {
 
 func main() {
 	e := echo.New()
+	// Trust X-Forwarded-For only from loopback and private-network proxies so clients cannot
+	// spoof the address used by the rate limiter and API key network allowlists
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
 
 	err := godotenv.Load(".env")
 	if err != nil {
@@ -183,18 +189,53 @@ func main() {
 	apiKeyRepo := repository.NewAPIKeyRepository(db.DB)
 	assetRepo := repository.NewAssetRepository(db.DB)
 	memberRepo := repository.NewMemberRepository(db.DB)
+	auditRepo := repository.NewAuditRepository(db.DB)
+	schemaRepo := repository.NewMetadataSchemaRepository(db.DB)
+	collectionRepo := repository.NewCollectionRepository(db.DB)
+	commentRepo := repository.NewCommentRepository(db.DB)
+	workflowRepo := repository.NewWorkflowRepository(db.DB)
+	aliasRepo := repository.NewAliasRepository(db.DB)
+	folderACLRepo := repository.NewFolderACLRepository(db.DB)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db.DB)
+	sessionRepo := repository.NewSessionRepository(db.DB)
+	emailVerificationRepo := repository.NewEmailVerificationRepository(db.DB)
+	passwordResetRepo := repository.NewPasswordResetRepository(db.DB)
+	mfaRepo := repository.NewMFARepository(db.DB)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(db.DB)
+	ssoRepo := repository.NewSSORepository(db.DB)
+	apiKeyUsageRepo := repository.NewAPIKeyUsageRepository(db.DB)
+	usageRecorder := middleware.NewUsageRecorder(apiKeyUsageRepo)
+	requestVerifier := middleware.NewRequestVerifier(apiKeyRepo, cfg.APIKeySigningSecret, s3.MaxSingleUploadSize)
 
 	emailService := buildEmailService(cfg)
-
-	authRoutes := routes.NewAuthRoutes(clientRepo, cfg.JWTSecret, emailService, cfg.AppBaseURL, cfg.AppName)
-	clientRoutes := routes.NewClientRoutes(clientRepo, assetRepo, s3Client)
-	projectRoutes := routes.NewProjectRoutes(projectRepo)
-	apiKeyRoutes := routes.NewAPIKeyRoutes(apiKeyRepo)
-	assetRoutes := routes.NewAssetRoutes(s3Client, assetRepo, projectRepo, memberRepo, urlCache)
-	memberRoutes := routes.NewMemberRoutes(memberRepo, projectRepo, clientRepo, emailService, cfg.AppBaseURL, cfg.AppName)
+	rbacChecker := rbac.MustNew(presets.FileManagement())
+
+	emailVerificationRoutes := routes.NewEmailVerificationRoutes(emailVerificationRepo, clientRepo, emailService, cfg.AppBaseURL, cfg.AppName)
+	mfaRoutes := routes.NewMFARoutes(mfaRepo, clientRepo, projectRepo, cfg.MFAEncryptionKey, cfg.AppName)
+	authRoutes := routes.NewAuthRoutes(clientRepo, refreshTokenRepo, sessionRepo, passwordResetRepo, loginAttemptRepo, auditRepo, emailVerificationRoutes, mfaRoutes, cfg.JWTSecret, emailService, cfg.AppBaseURL, cfg.AppName)
+	ssoRoutes := routes.NewSSORoutes(ssoRepo, clientRepo, authRoutes, oidc.NewClient(nil, cfg.SSOAllowHTTPIssuers), cfg.SSOEncryptionKey, cfg.SSORedirectURL)
+	clientRoutes := routes.NewClientRoutes(clientRepo, assetRepo, sessionRepo, emailVerificationRoutes, s3Client)
+	projectRoutes := routes.NewProjectRoutes(projectRepo, memberRepo, mfaRepo)
+	apiKeyRoutes := routes.NewAPIKeyRoutes(apiKeyRepo, apiKeyUsageRepo, requestVerifier, memberRepo, rbacChecker, emailService, time.Duration(cfg.APIKeyGraceHours)*time.Hour, time.Duration(cfg.APIKeyWarningDays)*24*time.Hour, cfg.AppName)
+	assetRoutes := routes.NewAssetRoutes(s3Client, assetRepo, projectRepo, memberRepo, schemaRepo, folderACLRepo, rbacChecker, urlCache)
+	memberRoutes := routes.NewMemberRoutes(memberRepo, projectRepo, clientRepo, rbacChecker, emailService, cfg.AppBaseURL, cfg.AppName)
+	adminRoutes := routes.NewAdminRoutes(auditRepo)
+	searchRoutes := routes.NewSearchRoutes(assetRepo, memberRepo, rbacChecker)
+	schemaRoutes := routes.NewMetadataSchemaRoutes(schemaRepo, memberRepo, assetRepo, rbacChecker, s3Client)
+	collectionRoutes := routes.NewCollectionRoutes(collectionRepo, assetRepo, projectRepo, memberRepo, rbacChecker, s3Client, urlCache)
+	workflowRoutes := routes.NewWorkflowRoutes(workflowRepo, assetRepo, memberRepo, folderACLRepo, rbacChecker)
+	aliasRoutes := routes.NewAliasRoutes(aliasRepo, assetRepo, projectRepo, memberRepo, folderACLRepo, rbacChecker, s3Client, urlCache)
+	folderACLRoutes := routes.NewFolderACLRoutes(folderACLRepo, memberRepo, rbacChecker)
+	commentRoutes := routes.NewCommentRoutes(commentRepo, assetRepo, projectRepo, memberRepo, folderACLRepo, rbacChecker, emailService, cfg.AppBaseURL, cfg.AppName)
 
 	jwtMiddleware := middleware.JWTAuth(cfg.JWTSecret, clientRepo)
-	apiKeyMiddleware := middleware.APIKeyAuth(apiKeyRepo, clientRepo)
+	apiKeyMiddleware := middleware.APIKeyAuth(apiKeyRepo, clientRepo, requestVerifier, usageRecorder)
+	operatorMiddleware := middleware.RequireOperator(clientRepo)
+	uploadMiddleware := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	if !cfg.UnverifiedUploads {
+		uploadMiddleware = middleware.RequireVerifiedEmail(clientRepo)
+	}
+	storageAuditMiddleware := middleware.AuditTrail(auditRepo, "storage")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -225,6 +266,88 @@ func main() {
 		}
 	}()
 
+	go func() {
+		cleanupSessions := func() {
+			tokens, sessions, err := authRoutes.CleanupSessions()
+			if err != nil {
+				log.Printf("Session cleanup failed: %v", err)
+			} else if tokens > 0 || sessions > 0 {
+				log.Printf("Session cleanup deleted %d expired refresh token(s) and %d ended session(s)", tokens, sessions)
+			}
+
+			if counters, err := authRoutes.CleanupLoginFailures(); err != nil {
+				log.Printf("Login failure cleanup failed: %v", err)
+			} else if counters > 0 {
+				log.Printf("Login failure cleanup deleted %d stale counter(s)", counters)
+			}
+
+			if states, err := ssoRoutes.CleanupLoginStates(); err != nil {
+				log.Printf("SSO login state cleanup failed: %v", err)
+			} else if states > 0 {
+				log.Printf("SSO login state cleanup deleted %d abandoned login(s)", states)
+			}
+		}
+
+		cleanupSessions()
+
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cleanupSessions()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		runKeyMaintenance := func() {
+			if deactivated, err := apiKeyRoutes.DeactivateRotatedKeys(); err != nil {
+				log.Printf("API key maintenance failed: %v", err)
+			} else if deactivated > 0 {
+				log.Printf("API key maintenance deactivated %d rotated key(s)", deactivated)
+			}
+			if _, err := apiKeyRoutes.DeleteExpiredNonces(); err != nil {
+				log.Printf("API key maintenance failed: %v", err)
+			}
+			if sent, err := apiKeyRoutes.SendExpiryWarnings(); err != nil {
+				log.Printf("API key expiry warnings finished with errors: %v", err)
+			} else if sent > 0 {
+				log.Printf("API key maintenance sent %d expiry warning(s)", sent)
+			}
+		}
+
+		runKeyMaintenance()
+
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				runKeyMaintenance()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := usageRecorder.Flush(); err != nil {
+					log.Printf("API key usage flush failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	go func() {
 		ticker := time.NewTicker(5 * time.Minute)
 		defer ticker.Stop()
@@ -238,8 +361,8 @@ func main() {
 		}
 	}()
 
-	routes.RegisterRoutes(e, s3Client, urlCache)
-	routes.RegisterMultiTenantRoutes(e, authRoutes, clientRoutes, projectRoutes, apiKeyRoutes, assetRoutes, memberRoutes, jwtMiddleware, apiKeyMiddleware)
+	routes.RegisterRoutes(e, s3Client, urlCache, adminRoutes, jwtMiddleware, operatorMiddleware, storageAuditMiddleware)
+	routes.RegisterMultiTenantRoutes(e, authRoutes, clientRoutes, projectRoutes, apiKeyRoutes, assetRoutes, memberRoutes, searchRoutes, schemaRoutes, collectionRoutes, commentRoutes, workflowRoutes, aliasRoutes, folderACLRoutes, emailVerificationRoutes, mfaRoutes, ssoRoutes, rbacChecker, jwtMiddleware, apiKeyMiddleware, uploadMiddleware)
 
 	go func() {
 		if err := e.Start(getPort()); err != nil && err != http.ErrServerClosed {
@@ -263,5 +386,9 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %s", err)
 	}
 
+	if err := usageRecorder.Flush(); err != nil {
+		log.Printf("API key usage flush failed: %v", err)
+	}
+
 	log.Println("Server exited")
 }
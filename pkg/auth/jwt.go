@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -12,16 +14,25 @@ var (
 	ErrExpiredToken = errors.New("token expired")
 )
 
-type Claims struct {
-	ClientID string `json:"client_id"`
-	Email    string `json:"email"`
-	jwt.RegisteredClaims
-}
+// Token types carried in the typ claim; each token is only accepted where its type belongs
+const (
+	TokenTypeAccess       = "access"
+	TokenTypeRefresh      = "refresh"
+	TokenTypeMFAChallenge = "mfa_challenge"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+	// MFAChallengeTTL is how long a client has to enter its second factor after the password
+	MFAChallengeTTL = 5 * time.Minute
+)
 
-type PasswordResetClaims struct {
-	ClientID string `json:"client_id"`
-	Email    string `json:"email"`
-	Purpose  string `json:"purpose"`
+type Claims struct {
+	ClientID  string `json:"client_id"`
+	Email     string `json:"email"`
+	Type      string `json:"typ"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -30,12 +41,15 @@ type TokenPair struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func GenerateAccessToken(clientID, email, secret string) (string, error) {
+// GenerateAccessToken issues an access token for the session it belongs to
+func GenerateAccessToken(clientID, email, sessionID, secret string) (string, error) {
 	claims := Claims{
-		ClientID: clientID,
-		Email:    email,
+		ClientID:  clientID,
+		Email:     email,
+		Type:      TokenTypeAccess,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -44,27 +58,39 @@ func GenerateAccessToken(clientID, email, secret string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
-func GenerateRefreshToken(clientID, email, secret string) (string, error) {
+// GenerateRefreshToken issues a refresh token and its expiry. The random jti keeps tokens issued
+// in the same second distinct, since they are stored and looked up by hash.
+func GenerateRefreshToken(clientID, email, secret string) (string, time.Time, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(RefreshTokenTTL)
 	claims := Claims{
 		ClientID: clientID,
 		Email:    email,
+		Type:     TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ID:        hex.EncodeToString(jti),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	return token, expiresAt, err
 }
 
-func GeneratePasswordResetToken(clientID, email, secret string) (string, error) {
-	claims := PasswordResetClaims{
+// GenerateMFAChallengeToken issues the token a client with two-factor authentication gets for its password.
+// It grants nothing by itself; exchanging it with a valid code yields the access and refresh tokens.
+func GenerateMFAChallengeToken(clientID, email, secret string) (string, error) {
+	claims := Claims{
 		ClientID: clientID,
 		Email:    email,
-		Purpose:  "password_reset",
+		Type:     TokenTypeMFAChallenge,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAChallengeTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -73,33 +99,24 @@ func GeneratePasswordResetToken(clientID, email, secret string) (string, error)
 	return token.SignedString([]byte(secret))
 }
 
-// ValidateToken validates and parses a JWT token
-func ValidateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(secret), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, ErrInvalidToken
-	}
+// ValidateMFAChallengeToken validates and parses an MFA challenge token
+func ValidateMFAChallengeToken(tokenString, secret string) (*Claims, error) {
+	return validateToken(tokenString, secret, TokenTypeMFAChallenge)
+}
 
-	if claims.ExpiresAt.Before(time.Now()) {
-		return nil, ErrExpiredToken
-	}
+// ValidateAccessToken validates and parses an access token
+func ValidateAccessToken(tokenString, secret string) (*Claims, error) {
+	return validateToken(tokenString, secret, TokenTypeAccess)
+}
 
-	return claims, nil
+// ValidateRefreshToken validates and parses a refresh token; callers must also check it is still stored
+func ValidateRefreshToken(tokenString, secret string) (*Claims, error) {
+	return validateToken(tokenString, secret, TokenTypeRefresh)
 }
 
-func ValidatePasswordResetToken(tokenString, secret string) (*PasswordResetClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &PasswordResetClaims{}, func(token *jwt.Token) (interface{}, error) {
+// validateToken validates and parses a JWT token of the given type
+func validateToken(tokenString, secret, tokenType string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
 		}
@@ -110,8 +127,8 @@ func ValidatePasswordResetToken(tokenString, secret string) (*PasswordResetClaim
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(*PasswordResetClaims)
-	if !ok || !token.Valid {
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.Type != tokenType {
 		return nil, ErrInvalidToken
 	}
 
@@ -119,9 +136,5 @@ func ValidatePasswordResetToken(tokenString, secret string) (*PasswordResetClaim
 		return nil, ErrExpiredToken
 	}
 
-	if claims.Purpose != "password_reset" || claims.ClientID == "" || claims.Email == "" {
-		return nil, ErrInvalidToken
-	}
-
 	return claims, nil
 }
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var errCiphertextTooShort = errors.New("ciphertext too short")
+
+// EncryptSecret seals a secret that must be read back later, such as a TOTP secret, with AES-256-GCM
+// under a key derived from serverKey. The result is base64 with the nonce in front.
+func EncryptSecret(serverKey, plaintext string) (string, error) {
+	aead, err := secretCipher(serverKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret opens a secret sealed by EncryptSecret with the same serverKey
+func DecryptSecret(serverKey, ciphertext string) (string, error) {
+	aead, err := secretCipher(serverKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errCiphertextTooShort
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func secretCipher(serverKey string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("secret-encryption:" + serverKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
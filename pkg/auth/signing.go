@@ -0,0 +1,15 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DeriveSigningSecret returns an API key's request signing secret from the server key and the key's salt.
+// Only the salt is stored, so the secret cannot be read back from the database.
+func DeriveSigningSecret(serverKey, keyID, salt string) string {
+	mac := hmac.New(sha256.New, []byte(serverKey))
+	mac.Write([]byte(keyID + ":" + salt))
+	return hex.EncodeToString(mac.Sum(nil))
+}
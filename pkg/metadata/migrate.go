@@ -0,0 +1,49 @@
+package metadata
+
+import "sort"
+
+// Migration rewrites metadata written against an older schema version.
+// Renames run first, then drops, then defaults fill keys that are still missing.
+type Migration struct {
+	Rename   map[string]string `json:"rename,omitempty"`
+	Drop     []string          `json:"drop,omitempty"`
+	Defaults map[string]string `json:"defaults,omitempty"`
+}
+
+// Apply returns a migrated copy of values; values itself is not modified.
+func (m Migration) Apply(values map[string]string) map[string]string {
+	migrated := make(map[string]string, len(values)+len(m.Defaults))
+	for key, value := range values {
+		migrated[key] = value
+	}
+
+	// Renames apply at once to the original values, so chained (a to b, b to c) and swapped renames
+	// do not depend on map order. Sources are visited sorted so that two renames onto one key
+	// always keep the same value.
+	sources := make([]string, 0, len(m.Rename))
+	for from := range m.Rename {
+		if _, ok := values[from]; ok {
+			sources = append(sources, from)
+			delete(migrated, from)
+		}
+	}
+	sort.Strings(sources)
+	for _, from := range sources {
+		to := m.Rename[from]
+		if _, exists := migrated[to]; !exists {
+			migrated[to] = values[from]
+		}
+	}
+
+	for _, key := range m.Drop {
+		delete(migrated, key)
+	}
+
+	for key, value := range m.Defaults {
+		if _, ok := migrated[key]; !ok {
+			migrated[key] = value
+		}
+	}
+
+	return migrated
+}
@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// FieldType is the type a metadata value must parse as. Values are always
+// stored as strings; the type only governs validation.
+type FieldType string
+
+const (
+	FieldTypeString   FieldType = "string"
+	FieldTypeInteger  FieldType = "integer"
+	FieldTypeNumber   FieldType = "number"
+	FieldTypeBoolean  FieldType = "boolean"
+	FieldTypeDate     FieldType = "date"     // YYYY-MM-DD
+	FieldTypeDateTime FieldType = "datetime" // RFC 3339
+	FieldTypeURL      FieldType = "url"
+)
+
+var fieldTypes = map[FieldType]bool{
+	FieldTypeString:   true,
+	FieldTypeInteger:  true,
+	FieldTypeNumber:   true,
+	FieldTypeBoolean:  true,
+	FieldTypeDate:     true,
+	FieldTypeDateTime: true,
+	FieldTypeURL:      true,
+}
+
+var fieldNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Field describes a single metadata key.
+type Field struct {
+	Type        FieldType `json:"type"`
+	Required    bool      `json:"required,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Enum        []string  `json:"enum,omitempty"`
+	Pattern     string    `json:"pattern,omitempty"`    // strings only
+	MinLength   *int      `json:"min_length,omitempty"` // strings only
+	MaxLength   *int      `json:"max_length,omitempty"` // strings only
+	Minimum     *float64  `json:"minimum,omitempty"`    // integers and numbers only
+	Maximum     *float64  `json:"maximum,omitempty"`    // integers and numbers only
+}
+
+// Schema is a project's metadata definition.
+type Schema struct {
+	Fields map[string]Field `json:"fields"`
+	// AdditionalFields allows keys that are not declared in Fields.
+	AdditionalFields bool `json:"additional_fields"`
+}
+
+// Check reports problems with the schema definition itself, one FieldError per field.
+func (s *Schema) Check() []FieldError {
+	var errs []FieldError
+	if len(s.Fields) == 0 && !s.AdditionalFields {
+		errs = append(errs, FieldError{Field: "fields", Message: "declare at least one field or allow additional fields"})
+	}
+
+	for _, name := range s.fieldNames() {
+		field := s.Fields[name]
+		if !fieldNamePattern.MatchString(name) {
+			errs = append(errs, FieldError{Field: name, Message: "field names use up to 64 lowercase letters, digits, _ or -"})
+			continue
+		}
+		if !fieldTypes[field.Type] {
+			errs = append(errs, FieldError{Field: name, Message: fmt.Sprintf("unknown type %q", field.Type)})
+			continue
+		}
+
+		isString := field.Type == FieldTypeString
+		isNumeric := field.Type == FieldTypeInteger || field.Type == FieldTypeNumber
+
+		if field.Pattern != "" {
+			if !isString {
+				errs = append(errs, FieldError{Field: name, Message: "pattern applies to string fields only"})
+			} else if _, err := regexp.Compile(field.Pattern); err != nil {
+				errs = append(errs, FieldError{Field: name, Message: "pattern is not a valid regular expression"})
+			}
+		}
+		if (field.MinLength != nil || field.MaxLength != nil) && !isString {
+			errs = append(errs, FieldError{Field: name, Message: "min_length and max_length apply to string fields only"})
+		}
+		if field.MinLength != nil && field.MaxLength != nil && *field.MinLength > *field.MaxLength {
+			errs = append(errs, FieldError{Field: name, Message: "min_length exceeds max_length"})
+		}
+		if (field.Minimum != nil || field.Maximum != nil) && !isNumeric {
+			errs = append(errs, FieldError{Field: name, Message: "minimum and maximum apply to integer and number fields only"})
+		}
+		if field.Minimum != nil && field.Maximum != nil && *field.Minimum > *field.Maximum {
+			errs = append(errs, FieldError{Field: name, Message: "minimum exceeds maximum"})
+		}
+		for _, option := range field.Enum {
+			if msg := checkType(field.Type, option); msg != "" {
+				errs = append(errs, FieldError{Field: name, Message: fmt.Sprintf("enum value %q: %s", option, msg)})
+			}
+		}
+	}
+
+	return errs
+}
+
+// fieldNames returns the declared field names in a stable order.
+func (s *Schema) fieldNames() []string {
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,147 @@
+package metadata
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single metadata field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError carries every field-level problem found in a metadata map.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return "metadata validation failed: " + strings.Join(parts, "; ")
+}
+
+// Validate checks values against the schema and returns a *ValidationError
+// listing every failing field, or nil when the values conform.
+func (s *Schema) Validate(values map[string]string) error {
+	var errs []FieldError
+
+	for _, name := range s.fieldNames() {
+		field := s.Fields[name]
+		value, ok := values[name]
+		if !ok {
+			if field.Required {
+				errs = append(errs, FieldError{Field: name, Message: "is required"})
+			}
+			continue
+		}
+		if msg := validateValue(field, value); msg != "" {
+			errs = append(errs, FieldError{Field: name, Message: msg})
+		}
+	}
+
+	if !s.AdditionalFields {
+		var extra []string
+		for name := range values {
+			if _, declared := s.Fields[name]; !declared {
+				extra = append(extra, name)
+			}
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			errs = append(errs, FieldError{Field: name, Message: "is not defined in the schema"})
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+func validateValue(field Field, value string) string {
+	if msg := checkType(field.Type, value); msg != "" {
+		return msg
+	}
+
+	if len(field.Enum) > 0 {
+		found := false
+		for _, option := range field.Enum {
+			if value == option {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("must be one of %s", strings.Join(field.Enum, ", "))
+		}
+	}
+
+	switch field.Type {
+	case FieldTypeString:
+		length := utf8.RuneCountInString(value)
+		if field.MinLength != nil && length < *field.MinLength {
+			return fmt.Sprintf("must be at least %d characters", *field.MinLength)
+		}
+		if field.MaxLength != nil && length > *field.MaxLength {
+			return fmt.Sprintf("must be at most %d characters", *field.MaxLength)
+		}
+		if field.Pattern != "" {
+			// patterns are checked when the schema is saved
+			if re, err := regexp.Compile(field.Pattern); err == nil && !re.MatchString(value) {
+				return fmt.Sprintf("must match %s", field.Pattern)
+			}
+		}
+	case FieldTypeInteger, FieldTypeNumber:
+		number, _ := strconv.ParseFloat(value, 64)
+		if field.Minimum != nil && number < *field.Minimum {
+			return fmt.Sprintf("must be at least %s", strconv.FormatFloat(*field.Minimum, 'f', -1, 64))
+		}
+		if field.Maximum != nil && number > *field.Maximum {
+			return fmt.Sprintf("must be at most %s", strconv.FormatFloat(*field.Maximum, 'f', -1, 64))
+		}
+	}
+
+	return ""
+}
+
+// checkType returns a message when value does not parse as the given type.
+func checkType(fieldType FieldType, value string) string {
+	switch fieldType {
+	case FieldTypeInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "must be an integer"
+		}
+	case FieldTypeNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "must be a number"
+		}
+	case FieldTypeBoolean:
+		if value != "true" && value != "false" {
+			return "must be true or false"
+		}
+	case FieldTypeDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	case FieldTypeDateTime:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "must be an RFC 3339 timestamp"
+		}
+	case FieldTypeURL:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http or https URL"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"file-service/pkg/models"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKeyAPIKeyFolders holds the folder prefixes an API key is restricted to; empty means the whole project
+const ContextKeyAPIKeyFolders = "api_key_folders"
+
+// checkAPIKeyScopes writes the error response and returns false when the request falls outside the key's
+// allowed methods or source networks
+func checkAPIKeyScopes(c echo.Context, key *models.APIKey) (bool, error) {
+	if len(key.AllowedMethods) > 0 && !methodAllowed(key.AllowedMethods, c.Request().Method) {
+		return false, c.JSON(http.StatusForbidden, map[string]string{
+			"error": fmt.Sprintf("API key does not allow %s requests", c.Request().Method),
+		})
+	}
+
+	if len(key.AllowedCIDRs) > 0 && !sourceAllowed(key.AllowedCIDRs, c.RealIP()) {
+		return false, c.JSON(http.StatusForbidden, map[string]string{"error": "request source is not allowed for this API key"})
+	}
+
+	return true, nil
+}
+
+// methodAllowed reports whether the method is in the list; HEAD is covered by GET
+func methodAllowed(allowed []string, method string) bool {
+	for _, m := range allowed {
+		if m == method || (method == http.MethodHead && m == http.MethodGet) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceAllowed reports whether the address belongs to one of the networks
+func sourceAllowed(cidrs []string, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyRateLimiter counts requests per API key in fixed one-minute windows.
+// Counts live in memory, so each instance enforces the limit on its own.
+type keyRateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newKeyRateLimiter() *keyRateLimiter {
+	return &keyRateLimiter{windows: make(map[string]*rateWindow)}
+}
+
+// allow records a request of the key and returns the requests left in the window,
+// or false with the time until the window resets once the limit is reached
+func (l *keyRateLimiter) allow(keyID string, limit int, now time.Time) (int, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop windows of keys that have gone quiet so the map does not grow with every key ever seen
+	if now.Sub(l.lastSweep) >= time.Minute {
+		for id, window := range l.windows {
+			if now.Sub(window.start) >= time.Minute {
+				delete(l.windows, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	window, ok := l.windows[keyID]
+	if !ok || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		l.windows[keyID] = window
+	}
+
+	if window.count >= limit {
+		return 0, window.start.Add(time.Minute).Sub(now), false
+	}
+	window.count++
+
+	return limit - window.count, 0, true
+}
+
+// checkAPIKeyRate writes the 429 response and returns false when the key has used up its requests for the minute
+func (l *keyRateLimiter) checkAPIKeyRate(c echo.Context, key *models.APIKey) (bool, error) {
+	if key.RateLimitPerMinute == nil {
+		return true, nil
+	}
+
+	limit := *key.RateLimitPerMinute
+	remaining, retryAfter, ok := l.allow(key.ID, limit, time.Now())
+
+	header := c.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !ok {
+		header.Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		return false, c.JSON(http.StatusTooManyRequests, map[string]string{"error": "API key rate limit exceeded"})
+	}
+
+	return true, nil
+}
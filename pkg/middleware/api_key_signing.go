@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"file-service/pkg/apiclient"
+	"file-service/pkg/auth"
+	"file-service/pkg/models"
+	"file-service/pkg/repository"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxSignatureSkew is how far a signed request's timestamp may be from the server clock
+	maxSignatureSkew = 5 * time.Minute
+	// bodySpoolThreshold is the body size above which signed bodies are buffered on disk instead of in memory
+	bodySpoolThreshold = 1 << 20
+	// signedBodyOverhead leaves room for multipart framing around the largest upload
+	signedBodyOverhead = 1 << 20
+)
+
+var signatureNoncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+// RequestVerifier checks HMAC-signed API key requests; see pkg/apiclient for the scheme.
+type RequestVerifier struct {
+	apiKeyRepo *repository.APIKeyRepository
+	serverKey  string
+	// maxBodySize caps the signed bodies that are hashed and buffered before the signature is checked
+	maxBodySize int64
+}
+
+func NewRequestVerifier(apiKeyRepo *repository.APIKeyRepository, serverKey string, maxUploadSize int64) *RequestVerifier {
+	return &RequestVerifier{apiKeyRepo: apiKeyRepo, serverKey: serverKey, maxBodySize: maxUploadSize + signedBodyOverhead}
+}
+
+// SigningSecret returns the signing secret of a key with signing enabled
+func (v *RequestVerifier) SigningSecret(key *models.APIKey) string {
+	return auth.DeriveSigningSecret(v.serverKey, key.ID, key.SigningSalt)
+}
+
+// verify returns the key that signed the request. The body is replaced with a buffered copy;
+// cleanup releases it once the request is done. When it fails, the error response has already been written.
+func (v *RequestVerifier) verify(c echo.Context) (*models.APIKey, func(), bool, error) {
+	cleanup := func() {}
+	req := c.Request()
+
+	keyID := req.Header.Get(apiclient.HeaderKeyID)
+	rawTimestamp := req.Header.Get(apiclient.HeaderTimestamp)
+	nonce := req.Header.Get(apiclient.HeaderNonce)
+	signature := strings.ToLower(req.Header.Get(apiclient.HeaderSignature))
+	if keyID == "" || rawTimestamp == "" || nonce == "" || signature == "" {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "incomplete request signature"})
+	}
+
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid signature timestamp"})
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "request timestamp is outside the allowed clock skew"})
+	}
+	if !signatureNoncePattern.MatchString(nonce) {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid signature nonce"})
+	}
+
+	keyData, err := v.apiKeyRepo.ValidateAPIKeyID(keyID)
+	if err != nil {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+	}
+	if !keyData.SigningEnabled {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "request signing is not enabled for this API key"})
+	}
+
+	if req.ContentLength > v.maxBodySize {
+		return nil, cleanup, false, c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, v.maxBodySize)
+	}
+
+	bodySHA256, cleanup, err := bufferRequestBody(req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, cleanup, false, c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+	}
+	if err != nil {
+		return nil, cleanup, false, c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read request body"})
+	}
+
+	stringToSign := apiclient.StringToSign(req.Method, req.URL.EscapedPath(), req.URL.Query(), bodySHA256, timestamp, nonce)
+	expected := apiclient.ComputeSignature(v.SigningSecret(keyData), stringToSign)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid request signature"})
+	}
+
+	// Only requests with a valid signature record their nonce, so nobody else can burn them
+	fresh, err := v.apiKeyRepo.UseNonce(keyData.ID, nonce, 2*maxSignatureSkew)
+	if err != nil {
+		return nil, cleanup, false, c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify request signature"})
+	}
+	if !fresh {
+		return nil, cleanup, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "request nonce already used"})
+	}
+
+	return keyData, cleanup, true, nil
+}
+
+// bufferRequestBody hashes the body and replaces it with a copy the handler can read,
+// kept in memory up to bodySpoolThreshold and in a temporary file beyond
+func bufferRequestBody(req *http.Request) (string, func(), error) {
+	cleanup := func() {}
+	hasher := sha256.New()
+	if req.Body == nil || req.Body == http.NoBody {
+		return hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+	}
+	defer req.Body.Close()
+
+	var buf bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(hasher, &buf), req.Body, bodySpoolThreshold)
+	if err == io.EOF {
+		req.Body = io.NopCloser(&buf)
+		return hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+	}
+	if err != nil {
+		return "", cleanup, err
+	}
+
+	spool, err := os.CreateTemp("", "signed-body-*")
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	if _, err := spool.Write(buf.Bytes()); err != nil {
+		return "", cleanup, err
+	}
+	if _, err := io.Copy(io.MultiWriter(hasher, spool), req.Body); err != nil {
+		return "", cleanup, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return "", cleanup, err
+	}
+
+	req.Body = io.NopCloser(spool)
+	return hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+}
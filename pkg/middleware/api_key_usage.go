@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"file-service/pkg/repository"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const contextKeyUploadedBytes = "api_key_uploaded_bytes"
+
+// RecordUploadedBytes adds to the bytes the current request uploaded, for API key usage analytics.
+func RecordUploadedBytes(c echo.Context, bytes int64) {
+	total, _ := c.Get(contextKeyUploadedBytes).(int64)
+	c.Set(contextKeyUploadedBytes, total+bytes)
+}
+
+// UsageRecorder aggregates API key requests in memory by hour, route and status so they can be written in batches.
+// Counts not yet flushed are lost if the process dies.
+type UsageRecorder struct {
+	repo    *repository.APIKeyUsageRepository
+	mu      sync.Mutex
+	pending map[usageKey]*usageTotals
+}
+
+type usageKey struct {
+	keyID  string
+	bucket time.Time
+	route  string
+	status int
+}
+
+type usageTotals struct {
+	requests int64
+	bytes    int64
+}
+
+func NewUsageRecorder(repo *repository.APIKeyUsageRepository) *UsageRecorder {
+	return &UsageRecorder{repo: repo, pending: make(map[usageKey]*usageTotals)}
+}
+
+// record counts a finished request of the key
+func (u *UsageRecorder) record(c echo.Context, keyID string, handlerErr error) {
+	status := c.Response().Status
+	if handlerErr != nil {
+		if httpErr, ok := handlerErr.(*echo.HTTPError); ok {
+			status = httpErr.Code
+		}
+	}
+
+	route := c.Path()
+	if route == "" {
+		route = c.Request().URL.Path
+	}
+	bytes, _ := c.Get(contextKeyUploadedBytes).(int64)
+
+	key := usageKey{
+		keyID:  keyID,
+		bucket: time.Now().UTC().Truncate(time.Hour),
+		route:  c.Request().Method + " " + route,
+		status: status,
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	totals, ok := u.pending[key]
+	if !ok {
+		totals = &usageTotals{}
+		u.pending[key] = totals
+	}
+	totals.requests++
+	totals.bytes += bytes
+}
+
+// Flush writes the counts gathered since the last flush in one batch; a batch that fails to write is dropped
+func (u *UsageRecorder) Flush() error {
+	u.mu.Lock()
+	pending := u.pending
+	u.pending = make(map[usageKey]*usageTotals)
+	u.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	counts := make([]repository.APIKeyUsageCount, 0, len(pending))
+	for key, totals := range pending {
+		counts = append(counts, repository.APIKeyUsageCount{
+			KeyID:         key.keyID,
+			BucketStart:   key.bucket,
+			Route:         key.route,
+			StatusCode:    key.status,
+			Requests:      totals.requests,
+			BytesUploaded: totals.bytes,
+		})
+	}
+
+	return u.repo.SaveUsage(counts)
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"file-service/pkg/models"
+	"file-service/pkg/repository"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const contextKeyAuditDetails = "audit_details"
+
+// AddAuditDetail attaches a key/value pair to the audit entry of the current request.
+func AddAuditDetail(c echo.Context, key string, value any) {
+	details, ok := c.Get(contextKeyAuditDetails).(map[string]any)
+	if !ok {
+		details = make(map[string]any)
+		c.Set(contextKeyAuditDetails, details)
+	}
+	details[key] = value
+}
+
+// AuditTrail middleware records every request in the audit log once the handler has run.
+// The action is derived from the prefix and the route, e.g. "storage.delete-folder".
+func AuditTrail(auditRepo *repository.AuditRepository, actionPrefix string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			handlerErr := next(c)
+
+			status := c.Response().Status
+			if handlerErr != nil {
+				// Plain errors become 500s in the error handler, which has not run yet
+				status = http.StatusInternalServerError
+				var httpErr *echo.HTTPError
+				if errors.As(handlerErr, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+
+			details, _ := c.Get(contextKeyAuditDetails).(map[string]any)
+			if details == nil {
+				details = make(map[string]any)
+			}
+			details["method"] = c.Request().Method
+			if query := c.QueryParams(); len(query) > 0 {
+				details["query"] = query
+			}
+
+			entry := &models.AuditEntry{
+				Action:     actionPrefix + "." + routeName(c.Path()),
+				Resource:   c.Request().URL.Path,
+				Details:    details,
+				IPAddress:  c.RealIP(),
+				UserAgent:  c.Request().UserAgent(),
+				StatusCode: status,
+			}
+			if clientID, ok := c.Get("client_id").(string); ok && clientID != "" {
+				entry.ActorClientID = &clientID
+			}
+
+			if err := auditRepo.Record(entry); err != nil {
+				log.Printf("audit: %v", err)
+			}
+
+			return handlerErr
+		}
+	}
+}
+
+func routeName(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	return parts[len(parts)-1]
+}
@@ -1,15 +1,21 @@
 package middleware
 
 import (
+	"file-service/pkg/apiclient"
 	"file-service/pkg/auth"
+	"file-service/pkg/models"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/echoadapter"
+	"file-service/pkg/rbac/presets"
 	"file-service/pkg/repository"
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-// JWTAuth middleware validates JWT access tokens
+// JWTAuth middleware validates JWT access tokens and refuses those whose session has ended
 func JWTAuth(secret string, clientRepo *repository.ClientRepository) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -24,16 +30,23 @@ func JWTAuth(secret string, clientRepo *repository.ClientRepository) echo.Middle
 			}
 
 			token := parts[1]
-			claims, err := auth.ValidateToken(token, secret)
+			claims, err := auth.ValidateAccessToken(token, secret)
 			if err != nil {
 				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
 			}
 
 			if clientRepo != nil {
-				active, err := clientRepo.IsClientActive(claims.ClientID)
+				// Every access token belongs to a session; once it is signed out or revoked the token stops working
+				if _, err := uuid.Parse(claims.SessionID); err != nil {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
+				}
+				active, sessionLive, err := clientRepo.CheckClientSession(claims.ClientID, claims.SessionID)
 				if err != nil {
 					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify account status"})
 				}
+				if !sessionLive {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "session has ended; log in again"})
+				}
 				if !active {
 					if c.Request().Method == http.MethodDelete && c.Path() == "/api/clients/me" {
 						// Allow paused clients to complete force-delete with an already-issued token.
@@ -48,24 +61,44 @@ func JWTAuth(secret string, clientRepo *repository.ClientRepository) echo.Middle
 			// Store client info in context
 			c.Set("client_id", claims.ClientID)
 			c.Set("email", claims.Email)
+			c.Set("session_id", claims.SessionID)
+			c.Set(echoadapter.ContextKeyAuthType, string(rbac.AuthTypeJWT))
 
 			return next(c)
 		}
 	}
 }
 
-// APIKeyAuth middleware validates API keys
-func APIKeyAuth(apiKeyRepo *repository.APIKeyRepository, clientRepo *repository.ClientRepository) echo.MiddlewareFunc {
+// APIKeyAuth middleware validates API keys and enforces their method, source network and rate limit scopes.
+// With a verifier, requests carrying an X-Signature are authenticated by their HMAC signature instead of X-API-Key.
+// With a usage recorder, every request of a valid key is counted once the handler has run.
+func APIKeyAuth(apiKeyRepo *repository.APIKeyRepository, clientRepo *repository.ClientRepository, verifier *RequestVerifier, usage *UsageRecorder) echo.MiddlewareFunc {
+	limiter := newKeyRateLimiter()
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			apiKey := c.Request().Header.Get("X-API-Key")
-			if apiKey == "" {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing API key"})
-			}
+			var keyData *models.APIKey
+			if verifier != nil && c.Request().Header.Get(apiclient.HeaderSignature) != "" {
+				signed, cleanup, ok, err := verifier.verify(c)
+				defer cleanup()
+				if !ok {
+					return err
+				}
+				keyData = signed
+			} else {
+				apiKey := c.Request().Header.Get("X-API-Key")
+				if apiKey == "" {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing API key"})
+				}
 
-			keyData, err := apiKeyRepo.ValidateAPIKey(apiKey)
-			if err != nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+				var err error
+				keyData, err = apiKeyRepo.ValidateAPIKey(apiKey)
+				if err != nil {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+				}
+				if keyData.RequireSigned {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "this API key only accepts signed requests"})
+				}
 			}
 
 			if clientRepo != nil {
@@ -78,10 +111,92 @@ func APIKeyAuth(apiKeyRepo *repository.APIKeyRepository, clientRepo *repository.
 				}
 			}
 
-			// Store API key info in context
-			c.Set("client_id", keyData.ClientID)
-			c.Set("project_id", keyData.ProjectID)
-			c.Set("permissions", keyData.Permissions)
+			handlerErr := serveAPIKey(c, keyData, limiter, next)
+			if usage != nil {
+				usage.record(c, keyData.ID, handlerErr)
+			}
+			return handlerErr
+		}
+	}
+}
+
+// serveAPIKey enforces the key's scopes and rate limit, then runs the handler with the key in the context
+func serveAPIKey(c echo.Context, keyData *models.APIKey, limiter *keyRateLimiter, next echo.HandlerFunc) error {
+	if ok, err := checkAPIKeyScopes(c, keyData); !ok {
+		return err
+	}
+	if ok, err := limiter.checkAPIKeyRate(c, keyData); !ok {
+		return err
+	}
+
+	// A rotated key still works until its grace period ends; tell callers when
+	if keyData.GraceEndsAt != nil {
+		c.Response().Header().Set("Sunset", keyData.GraceEndsAt.UTC().Format(http.TimeFormat))
+	}
+
+	// Store API key info in context
+	c.Set("client_id", keyData.ClientID)
+	c.Set("project_id", keyData.ProjectID)
+	c.Set("permissions", keyData.Permissions)
+	c.Set(ContextKeyAPIKeyFolders, keyData.AllowedFolders)
+	c.Set(echoadapter.ContextKeyAuthType, string(rbac.AuthTypeAPIKey))
+	c.Set(echoadapter.ContextKeyAPIKeyPermissions, apiKeyPermissions(keyData.Permissions))
+
+	return next(c)
+}
+
+// apiKeyPermissions converts stored key permissions for the RBAC checker; the legacy "admin" grants all of them
+func apiKeyPermissions(stored []string) []rbac.Permission {
+	permissions := make([]rbac.Permission, 0, len(stored))
+	for _, perm := range stored {
+		if perm == "admin" {
+			return []rbac.Permission{presets.PermissionRead, presets.PermissionWrite, presets.PermissionDelete}
+		}
+		permissions = append(permissions, rbac.Permission(perm))
+	}
+	return permissions
+}
+
+// RequireOperator middleware restricts a route to clients with the platform operator role.
+// It must run after JWTAuth.
+func RequireOperator(clientRepo *repository.ClientRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			clientID, ok := c.Get("client_id").(string)
+			if !ok || clientID == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			}
+
+			isOperator, err := clientRepo.IsOperator(clientID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify operator role"})
+			}
+			if !isOperator {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "operator role required"})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireVerifiedEmail middleware restricts a route to clients that confirmed their email address;
+// for API keys that is the key's owner. It must run after JWTAuth or APIKeyAuth.
+func RequireVerifiedEmail(clientRepo *repository.ClientRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			clientID, ok := c.Get("client_id").(string)
+			if !ok || clientID == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			}
+
+			verified, err := clientRepo.IsEmailVerified(clientID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify email status"})
+			}
+			if !verified {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "verify your email address before uploading"})
+			}
 
 			return next(c)
 		}
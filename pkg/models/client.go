@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"file-service/pkg/metadata"
+	"file-service/pkg/workflow"
+	"time"
+)
 
 type Client struct {
 	ID                  string     `json:"id"`
@@ -10,17 +14,50 @@ type Client struct {
 	Status              string     `json:"status"`
 	PausedAt            *time.Time `json:"paused_at,omitempty"`
 	ScheduledDeletionAt *time.Time `json:"scheduled_deletion_at,omitempty"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
 	CreatedAt           time.Time  `json:"created_at"`
 	UpdatedAt           time.Time  `json:"updated_at"`
+	// PendingEmail is the address awaiting confirmation after an email change request
+	PendingEmail string `json:"pending_email,omitempty"`
 }
 
 type Project struct {
-	ID          string    `json:"id"`
-	ClientID    string    `json:"client_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                    string `json:"id"`
+	ClientID              string `json:"client_id"`
+	Name                  string `json:"name"`
+	Description           string `json:"description,omitempty"`
+	DownloadURLTTLSeconds *int   `json:"download_url_ttl_seconds,omitempty"`
+	UploadURLTTLSeconds   *int   `json:"upload_url_ttl_seconds,omitempty"`
+	MaxUploadSizeBytes    *int64 `json:"max_upload_size_bytes,omitempty"`
+	// Slug names the project in alias paths (/p/<slug>/...)
+	Slug string `json:"slug"`
+	// PublicAliases lets alias paths be resolved without authentication
+	PublicAliases bool `json:"public_aliases"`
+	// RequireMFA limits access to members with two-factor authentication enabled
+	RequireMFA bool      `json:"require_mfa"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SharedProject is a project another client owns that the client was invited to, with the client's role.
+type SharedProject struct {
+	Project
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// ProjectURLSettings overrides the global presigned URL lifetimes and upload cap
+// for a project. A nil field leaves the current value untouched; zero clears it.
+type ProjectURLSettings struct {
+	DownloadURLTTLSeconds *int   `json:"download_url_ttl_seconds"`
+	UploadURLTTLSeconds   *int   `json:"upload_url_ttl_seconds"`
+	MaxUploadSizeBytes    *int64 `json:"max_upload_size_bytes"`
+}
+
+// ProjectAliasSettings changes how a project's alias paths resolve. A nil field is left untouched.
+type ProjectAliasSettings struct {
+	Slug          *string `json:"slug"`
+	PublicAliases *bool   `json:"public_aliases"`
 }
 
 type APIKey struct {
@@ -35,6 +72,43 @@ type APIKey struct {
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+
+	APIKeyScopes
+
+	// Rotation lineage: the key this one replaced, the key that replaced it and when this key stops working
+	RotatedFromID  *string    `json:"rotated_from_id,omitempty"`
+	SupersededByID *string    `json:"superseded_by_id,omitempty"`
+	GraceEndsAt    *time.Time `json:"grace_ends_at,omitempty"`
+
+	// Request signing: the salt the signing secret is derived from, and whether raw X-API-Key use is refused
+	SigningSalt    string `json:"-"`
+	SigningEnabled bool   `json:"signing_enabled"`
+	RequireSigned  bool   `json:"require_signed"`
+}
+
+// APIKeyScopes narrows what an API key may do beyond its permissions; empty fields leave that dimension unrestricted
+type APIKeyScopes struct {
+	AllowedFolders     []string `json:"allowed_folders"` // normalized folder prefixes such as "/builds/"
+	AllowedCIDRs       []string `json:"allowed_cidrs"`   // source networks such as "10.0.0.0/8"
+	AllowedMethods     []string `json:"allowed_methods"` // upper-case HTTP methods
+	RateLimitPerMinute *int     `json:"rate_limit_per_minute,omitempty"`
+}
+
+// APIKeyUsagePoint is the traffic of an API key in one time bucket
+type APIKeyUsagePoint struct {
+	Bucket        time.Time `json:"bucket"`
+	Requests      int64     `json:"requests"`
+	ClientErrors  int64     `json:"client_errors"` // 4xx responses, including scope and rate limit refusals
+	ServerErrors  int64     `json:"server_errors"`
+	BytesUploaded int64     `json:"bytes_uploaded"`
+}
+
+// APIKeyRouteUsage is the traffic of an API key on one route with one response status
+type APIKeyRouteUsage struct {
+	Route         string `json:"route"`
+	StatusCode    int    `json:"status_code"`
+	Requests      int64  `json:"requests"`
+	BytesUploaded int64  `json:"bytes_uploaded"`
 }
 
 type Asset struct {
@@ -63,3 +137,162 @@ type ProjectMember struct {
 	InvitedBy *string   `json:"invited_by,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+type AuditEntry struct {
+	ID            string         `json:"id"`
+	ActorClientID *string        `json:"actor_client_id,omitempty"`
+	Action        string         `json:"action"`
+	Resource      string         `json:"resource"`
+	Details       map[string]any `json:"details,omitempty"`
+	IPAddress     string         `json:"ip_address,omitempty"`
+	UserAgent     string         `json:"user_agent,omitempty"`
+	StatusCode    int            `json:"status_code"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// ProjectMetadataSchema is one version of a project's metadata schema.
+type ProjectMetadataSchema struct {
+	ID        string          `json:"id"`
+	ProjectID string          `json:"project_id"`
+	Version   int             `json:"version"`
+	Schema    metadata.Schema `json:"schema"`
+	CreatedBy *string         `json:"created_by,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Collection groups assets of a project in a chosen order without moving them between folders.
+type Collection struct {
+	ID           string    `json:"id"`
+	ProjectID    string    `json:"project_id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description,omitempty"`
+	CoverAssetID *string   `json:"cover_asset_id,omitempty"`
+	CreatedBy    *string   `json:"created_by,omitempty"`
+	AssetCount   int       `json:"asset_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CollectionUpdate changes collection details. A nil field is left untouched;
+// an empty CoverAssetID clears the cover.
+type CollectionUpdate struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	CoverAssetID *string `json:"cover_asset_id"`
+}
+
+// CommentRegion marks an area of an image as fractions of its width and height.
+type CommentRegion struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"w"`
+	Height float64 `json:"h"`
+}
+
+// Comment is feedback on one version of an asset. Comments are listed across the whole
+// version chain; replies always point at the top-level comment of their thread.
+type Comment struct {
+	ID           string         `json:"id"`
+	AssetID      string         `json:"asset_id"`
+	RootAssetID  string         `json:"root_asset_id"`
+	AssetVersion int            `json:"asset_version"`
+	ParentID     *string        `json:"parent_id,omitempty"`
+	AuthorID     *string        `json:"author_id,omitempty"`
+	AuthorName   string         `json:"author_name,omitempty"`
+	Body         string         `json:"body"`
+	Region       *CommentRegion `json:"region,omitempty"`
+	// TimestampStart and TimestampEnd locate the comment in audio or video, in seconds
+	TimestampStart *float64   `json:"timestamp_start,omitempty"`
+	TimestampEnd   *float64   `json:"timestamp_end,omitempty"`
+	Mentions       []string   `json:"mentions"`
+	Replies        []Comment  `json:"replies,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+}
+
+// AssetStateChange records one workflow transition of an asset.
+type AssetStateChange struct {
+	ID            string         `json:"id"`
+	AssetID       string         `json:"asset_id"`
+	FromState     workflow.State `json:"from_state"`
+	ToState       workflow.State `json:"to_state"`
+	ChangedBy     *string        `json:"changed_by,omitempty"`
+	ChangedByName string         `json:"changed_by_name,omitempty"`
+	Note          string         `json:"note,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// FolderACL grants or denies a member access to a folder and everything below it.
+type FolderACL struct {
+	ID         string    `json:"id"`
+	ProjectID  string    `json:"project_id"`
+	FolderPath string    `json:"folder_path"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name,omitempty"`
+	Role       string    `json:"role"`
+	CreatedBy  *string   `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Session is one login of a client, kept alive by rotating its refresh token.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// SSOConnection is an organisation's OpenID Connect identity provider.
+type SSOConnection struct {
+	ID                   string            `json:"id"`
+	ClientID             string            `json:"client_id"`
+	Slug                 string            `json:"slug"`
+	Name                 string            `json:"name"`
+	Issuer               string            `json:"issuer"`
+	OIDCClientID         string            `json:"oidc_client_id"`
+	AllowedDomains       []string          `json:"allowed_domains"`
+	Domains              []SSODomain       `json:"domains"`
+	GroupsClaim          string            `json:"groups_claim"`
+	TrustUnverifiedEmail bool              `json:"trust_unverified_email"`
+	Enabled              bool              `json:"enabled"`
+	GroupMappings        []SSOGroupMapping `json:"group_mappings"`
+	CreatedAt            time.Time         `json:"created_at"`
+	UpdatedAt            time.Time         `json:"updated_at"`
+	// OIDCClientSecret is stored encrypted and never returned
+	OIDCClientSecret string `json:"-"`
+	// VerifiedDomains are the allowed domains logins may use
+	VerifiedDomains []string `json:"-"`
+}
+
+// SSODomain is a domain claimed by a connection. Claims by operators are verified right away; others
+// once TXTValue is published as a TXT record at TXTRecord.
+type SSODomain struct {
+	Domain     string     `json:"domain"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	TXTRecord  string     `json:"txt_record,omitempty"`
+	TXTValue   string     `json:"txt_value,omitempty"`
+}
+
+// SSOGroupMapping grants members of an identity provider group a role in a project.
+type SSOGroupMapping struct {
+	Group     string `json:"group"`
+	ProjectID string `json:"project_id"`
+	Role      string `json:"role"`
+}
+
+// SSOConnectionUpdate holds the connection fields to change; nil fields are left as they are.
+type SSOConnectionUpdate struct {
+	Name                 *string   `json:"name"`
+	Issuer               *string   `json:"issuer"`
+	OIDCClientID         *string   `json:"oidc_client_id"`
+	OIDCClientSecret     *string   `json:"oidc_client_secret"`
+	AllowedDomains       *[]string `json:"allowed_domains"`
+	GroupsClaim          *string   `json:"groups_claim"`
+	TrustUnverifiedEmail *bool     `json:"trust_unverified_email"`
+	Enabled              *bool     `json:"enabled"`
+}
@@ -0,0 +1,216 @@
+// Package oidc is a minimal OpenID Connect relying party for the authorization code flow with PKCE.
+//
+// It discovers providers from their issuer URL, builds authorization URLs, redeems codes at the
+// token endpoint and verifies RS256-signed ID tokens against the provider's JWKS. Discovery documents
+// and key sets are cached per issuer; an ID token signed with an unknown key id refreshes the key set once.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTTL is how long discovery documents and key sets are reused before they are fetched again
+const discoveryTTL = time.Hour
+
+// maxResponseSize caps the provider responses read into memory
+const maxResponseSize = 1 << 20
+
+// ErrInsecureIssuer is returned for issuers that are not https when plain http is not allowed
+var ErrInsecureIssuer = errors.New("issuer must use https")
+
+// Provider holds the endpoints of an OpenID provider from its discovery document.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client talks to OpenID providers and caches what they publish.
+type Client struct {
+	httpClient *http.Client
+	// allowHTTP accepts plain http issuers and issuers on loopback, private or link-local addresses,
+	// for local mock providers
+	allowHTTP bool
+
+	mu        sync.Mutex
+	providers map[string]cachedProvider
+	keySets   map[string]cachedKeySet
+}
+
+type cachedProvider struct {
+	provider  *Provider
+	fetchedAt time.Time
+}
+
+type cachedKeySet struct {
+	keys      keySet
+	fetchedAt time.Time
+}
+
+// NewClient returns a Client using httpClient, or a client with a 10 second timeout when it is nil.
+// Unless allowHTTP is set, that default client only connects to public addresses.
+func NewClient(httpClient *http.Client, allowHTTP bool) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+		if !allowHTTP {
+			httpClient.Transport = publicOnlyTransport()
+		}
+	}
+	return &Client{
+		httpClient: httpClient,
+		allowHTTP:  allowHTTP,
+		providers:  make(map[string]cachedProvider),
+		keySets:    make(map[string]cachedKeySet),
+	}
+}
+
+// NormalizeIssuer trims the trailing slash of an issuer URL and checks its scheme.
+func (c *Client) NormalizeIssuer(issuer string) (string, error) {
+	issuer = strings.TrimRight(strings.TrimSpace(issuer), "/")
+	parsed, err := url.Parse(issuer)
+	if err != nil || parsed.Host == "" {
+		return "", fmt.Errorf("invalid issuer URL")
+	}
+	switch {
+	case parsed.Scheme == "https":
+	case parsed.Scheme == "http" && c.allowHTTP:
+	default:
+		return "", ErrInsecureIssuer
+	}
+	return issuer, nil
+}
+
+// Discover returns the provider published at the issuer's /.well-known/openid-configuration.
+// Issuers resolving to loopback, private or link-local addresses give ErrPrivateAddress unless
+// plain http is allowed.
+func (c *Client) Discover(ctx context.Context, issuer string) (*Provider, error) {
+	issuer, err := c.NormalizeIssuer(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.providers[issuer]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < discoveryTTL {
+		return cached.provider, nil
+	}
+
+	if !c.allowHTTP {
+		parsed, _ := url.Parse(issuer)
+		if err := checkPublicHost(ctx, parsed.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
+	var provider Provider
+	if err := c.getJSON(ctx, issuer+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %w", err)
+	}
+	if strings.TrimRight(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing endpoints")
+	}
+
+	c.mu.Lock()
+	c.providers[issuer] = cachedProvider{provider: &provider, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return &provider, nil
+}
+
+// AuthCodeURL returns the URL to send the user to for an authorization code bound to the PKCE challenge.
+func (p *Provider) AuthCodeURL(clientID, redirectURI, state, nonce, codeChallenge string, scopes []string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code with the PKCE verifier and returns the raw ID token.
+func (c *Client) Exchange(ctx context.Context, p *Provider, clientID, clientSecret, redirectURI, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", clientID)
+	form.Set("code_verifier", codeVerifier)
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if body.Error != "" {
+			return "", fmt.Errorf("token request rejected: %s %s", body.Error, body.ErrorDescription)
+		}
+		return "", fmt.Errorf("token request returned status %d", resp.StatusCode)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(target)
+}
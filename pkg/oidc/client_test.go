@@ -0,0 +1,192 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"file-service/pkg/oidc"
+	"file-service/pkg/oidc/oidctest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const (
+	testClientID     = "file-service"
+	testClientSecret = "secret"
+	testRedirectURI  = "http://app.test/sso/callback"
+)
+
+func startProvider(t *testing.T) *oidctest.Provider {
+	t.Helper()
+	provider, err := oidctest.NewProvider("", testClientID, testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(provider.Handler())
+	t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+	return provider
+}
+
+// authorize follows an authorization URL to the mock provider and returns the code it redirects back with
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider := startProvider(t)
+	provider.Groups = []string{"designers"}
+	client := oidc.NewClient(nil, true)
+	ctx := context.Background()
+
+	discovered, err := client.Discover(ctx, provider.Issuer+"/")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+
+	verifier, _ := oidc.RandomToken()
+	authURL := discovered.AuthCodeURL(testClientID, testRedirectURI, "state-1", "nonce-1", oidc.CodeChallengeS256(verifier), []string{"openid", "email"})
+	code, state := authorize(t, authURL)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	rawIDToken, err := client.Exchange(ctx, discovered, testClientID, testClientSecret, testRedirectURI, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	idToken, err := client.VerifyIDToken(ctx, discovered, testClientID, rawIDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if idToken.Email != "alice@example.com" || !idToken.EmailVerified || idToken.Subject != "mock|alice@example.com" {
+		t.Fatalf("unexpected identity %+v", idToken)
+	}
+	if groups := idToken.Groups("groups"); len(groups) != 1 || groups[0] != "designers" {
+		t.Fatalf("groups = %v, want [designers]", groups)
+	}
+
+	if _, err := client.Exchange(ctx, discovered, testClientID, testClientSecret, testRedirectURI, code, verifier); err == nil {
+		t.Fatal("redeeming a code twice succeeded")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongNonce(t *testing.T) {
+	provider := startProvider(t)
+	client := oidc.NewClient(nil, true)
+	ctx := context.Background()
+
+	discovered, err := client.Discover(ctx, provider.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := oidc.RandomToken()
+	code, _ := authorize(t, discovered.AuthCodeURL(testClientID, testRedirectURI, "state", "nonce-sent", oidc.CodeChallengeS256(verifier), nil))
+	rawIDToken, err := client.Exchange(ctx, discovered, testClientID, testClientSecret, testRedirectURI, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.VerifyIDToken(ctx, discovered, testClientID, rawIDToken, "nonce-expected"); err == nil {
+		t.Fatal("id token with another login's nonce was accepted")
+	}
+	if _, err := client.VerifyIDToken(ctx, discovered, "other-client", rawIDToken, "nonce-sent"); err == nil {
+		t.Fatal("id token for another audience was accepted")
+	}
+}
+
+func TestVerifyIDTokenEmailVerified(t *testing.T) {
+	provider := startProvider(t)
+	client := oidc.NewClient(nil, true)
+	ctx := context.Background()
+
+	discovered, err := client.Discover(ctx, provider.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for claim, want := range map[string]bool{"true": true, "false": false, "omit": false} {
+		verifier, _ := oidc.RandomToken()
+		authURL := discovered.AuthCodeURL(testClientID, testRedirectURI, "state", "nonce", oidc.CodeChallengeS256(verifier), nil)
+		code, _ := authorize(t, authURL+"&email_verified="+claim)
+		rawIDToken, err := client.Exchange(ctx, discovered, testClientID, testClientSecret, testRedirectURI, code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idToken, err := client.VerifyIDToken(ctx, discovered, testClientID, rawIDToken, "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idToken.EmailVerified != want {
+			t.Errorf("email_verified %s: EmailVerified = %v, want %v", claim, idToken.EmailVerified, want)
+		}
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	provider := startProvider(t)
+	client := oidc.NewClient(nil, true)
+	ctx := context.Background()
+
+	discovered, err := client.Discover(ctx, provider.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := oidc.RandomToken()
+	code, _ := authorize(t, discovered.AuthCodeURL(testClientID, testRedirectURI, "state", "nonce", oidc.CodeChallengeS256(verifier), nil))
+
+	if _, err := client.Exchange(ctx, discovered, testClientID, testClientSecret, testRedirectURI, code, "another-verifier"); err == nil {
+		t.Fatal("code was redeemed without its PKCE verifier")
+	}
+}
+
+func TestDiscoverRejectsInternalIssuers(t *testing.T) {
+	provider := startProvider(t)
+	client := oidc.NewClient(nil, false)
+	ctx := context.Background()
+
+	if _, err := client.Discover(ctx, provider.Issuer); !errors.Is(err, oidc.ErrInsecureIssuer) {
+		t.Fatalf("http issuer: err = %v, want ErrInsecureIssuer", err)
+	}
+
+	for _, issuer := range []string{
+		"https://127.0.0.1",
+		"https://localhost:8443",
+		"https://10.1.2.3",
+		"https://192.168.0.10",
+		"https://169.254.169.254",
+		"https://[::1]",
+		"https://[fe80::1]",
+	} {
+		if _, err := client.Discover(ctx, issuer); !errors.Is(err, oidc.ErrPrivateAddress) {
+			t.Errorf("%s: err = %v, want ErrPrivateAddress", issuer, err)
+		}
+	}
+}
+
+func TestClientRefusesInternalEndpoints(t *testing.T) {
+	provider := startProvider(t)
+	client := oidc.NewClient(nil, false)
+
+	// A public issuer can still name internal token or key set endpoints in its discovery document
+	discovered := &oidc.Provider{Issuer: provider.Issuer, TokenEndpoint: provider.Issuer + "/token"}
+	_, err := client.Exchange(context.Background(), discovered, testClientID, testClientSecret, testRedirectURI, "code", "verifier")
+	if !errors.Is(err, oidc.ErrPrivateAddress) {
+		t.Fatalf("err = %v, want ErrPrivateAddress", err)
+	}
+}
@@ -0,0 +1,182 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clockSkew is how far the provider's clock may be off when checking token times
+const clockSkew = time.Minute
+
+// ErrUnknownKey is returned for ID tokens signed with a key the provider does not publish
+var ErrUnknownKey = errors.New("id token signed with unknown key")
+
+// keySet maps key ids to the provider's RSA signing keys
+type keySet map[string]*rsa.PublicKey
+
+// IDToken is a verified ID token.
+type IDToken struct {
+	Subject string
+	Email   string
+	// EmailVerified is true only when the provider says the email is verified
+	EmailVerified bool
+	Name          string
+	Claims        jwt.MapClaims
+}
+
+// Groups returns the string values of a claim holding group names, which providers send as a list or a single string.
+func (t *IDToken) Groups(claim string) []string {
+	switch value := t.Claims[claim].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		groups := make([]string, 0, len(value))
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	default:
+		return nil
+	}
+}
+
+// VerifyIDToken checks an ID token's RS256 signature, issuer, audience, expiry and nonce.
+func (c *Client) VerifyIDToken(ctx context.Context, p *Provider, clientID, rawIDToken, nonce string) (*IDToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.signingKey(ctx, p, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	// A token issued to several audiences must name this client as the authorized party
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != clientID {
+			return nil, fmt.Errorf("invalid id token: authorized party is not this client")
+		}
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("invalid id token: nonce mismatch")
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("invalid id token: missing subject")
+	}
+
+	idToken := &IDToken{
+		Subject: subject,
+		Claims:  claims,
+	}
+	idToken.Email, _ = claims["email"].(string)
+	idToken.Name, _ = claims["name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		idToken.EmailVerified = verified
+	case string:
+		idToken.EmailVerified = verified == "true"
+	}
+
+	return idToken, nil
+}
+
+// signingKey returns the provider key with the key id, refreshing the key set once when it is unknown.
+// Tokens without a key id are accepted only from providers that publish a single key.
+func (c *Client) signingKey(ctx context.Context, p *Provider, kid string) (*rsa.PublicKey, error) {
+	for _, refresh := range []bool{false, true} {
+		keys, err := c.keys(ctx, p, refresh)
+		if err != nil {
+			return nil, err
+		}
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func (c *Client) keys(ctx context.Context, p *Provider, refresh bool) (keySet, error) {
+	c.mu.Lock()
+	cached, ok := c.keySets[p.JWKSURI]
+	c.mu.Unlock()
+	if ok && !refresh && time.Since(cached.fetchedAt) < discoveryTTL {
+		return cached.keys, nil
+	}
+
+	var document struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.getJSON(ctx, p.JWKSURI, &document); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+
+	keys := make(keySet)
+	for _, jwk := range document.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := rsaPublicKey(jwk.N, jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	c.mu.Lock()
+	c.keySets[p.JWKSURI] = cachedKeySet{keys: keys, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return keys, nil
+}
+
+func rsaPublicKey(modulus, exponent string) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(modulus, "="))
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(exponent, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid RSA key")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
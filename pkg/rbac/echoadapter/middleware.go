@@ -1,6 +1,7 @@
 package echoadapter
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
@@ -78,7 +79,8 @@ func RequirePermission(checker *rbac.RBACChecker, resource rbac.Resource, permis
 				if !checker.HasPermission(subject.Permissions, permission) {
 					log.Printf("rbac: API key lacks permission %q", permission)
 					return c.JSON(http.StatusForbidden, map[string]string{
-						"error": "Forbidden",
+						"error":               fmt.Sprintf("API key lacks the '%s' permission", permission),
+						"required_permission": string(permission),
 					})
 				}
 			case rbac.AuthTypeJWT:
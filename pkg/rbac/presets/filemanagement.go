@@ -12,10 +12,12 @@ const (
 	PermissionWrite  rbac.Permission = "write"
 	PermissionDelete rbac.Permission = "delete"
 
-	ResourceFile   rbac.Resource = "file"
-	ResourceFolder rbac.Resource = "folder"
-	ResourceAPIKey rbac.Resource = "api_key"
-	ResourceMember rbac.Resource = "member"
+	ResourceFile    rbac.Resource = "file"
+	ResourceFolder  rbac.Resource = "folder"
+	ResourceAPIKey  rbac.Resource = "api_key"
+	ResourceMember  rbac.Resource = "member"
+	ResourceComment rbac.Resource = "comment"
+	ResourceProject rbac.Resource = "project"
 
 	ActionRead   rbac.Action = "read"
 	ActionWrite  rbac.Action = "write"
@@ -43,6 +45,8 @@ func FileManagement() rbac.Config {
 			ResourceFolder,
 			ResourceAPIKey,
 			ResourceMember,
+			ResourceComment,
+			ResourceProject,
 		},
 		Actions: []rbac.Action{
 			ActionRead,
@@ -52,22 +56,28 @@ func FileManagement() rbac.Config {
 		},
 		Capabilities: map[rbac.Role]map[rbac.Resource][]rbac.Action{
 			RoleAdmin: {
-				ResourceFile:   {ActionRead, ActionWrite, ActionDelete},
-				ResourceFolder: {ActionRead, ActionWrite, ActionDelete},
-				ResourceAPIKey: {ActionRead, ActionWrite, ActionDelete, ActionManage},
-				ResourceMember: {ActionRead, ActionWrite, ActionDelete, ActionManage},
+				ResourceFile:    {ActionRead, ActionWrite, ActionDelete},
+				ResourceFolder:  {ActionRead, ActionWrite, ActionDelete},
+				ResourceAPIKey:  {ActionRead, ActionWrite, ActionDelete, ActionManage},
+				ResourceMember:  {ActionRead, ActionWrite, ActionDelete, ActionManage},
+				ResourceComment: {ActionRead, ActionWrite, ActionDelete, ActionManage},
+				ResourceProject: {ActionRead, ActionWrite, ActionManage},
 			},
 			RoleEditor: {
-				ResourceFile:   {ActionRead, ActionWrite, ActionDelete},
-				ResourceFolder: {ActionRead, ActionWrite, ActionDelete},
-				ResourceAPIKey: {ActionRead, ActionWrite},
-				ResourceMember: {ActionRead},
+				ResourceFile:    {ActionRead, ActionWrite, ActionDelete},
+				ResourceFolder:  {ActionRead, ActionWrite, ActionDelete},
+				ResourceAPIKey:  {ActionRead, ActionWrite},
+				ResourceMember:  {ActionRead},
+				ResourceComment: {ActionRead, ActionWrite},
+				ResourceProject: {ActionRead},
 			},
 			RoleViewer: {
-				ResourceFile:   {ActionRead},
-				ResourceFolder: {ActionRead},
-				ResourceAPIKey: {ActionRead},
-				ResourceMember: {ActionRead},
+				ResourceFile:    {ActionRead},
+				ResourceFolder:  {ActionRead},
+				ResourceAPIKey:  {ActionRead},
+				ResourceMember:  {ActionRead},
+				ResourceComment: {ActionRead, ActionWrite},
+				ResourceProject: {ActionRead},
 			},
 		},
 		PermissionToActionMap: []rbac.PermissionMapping{
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AliasRepository resolves alias paths (folder path and original filename) to asset versions
+type AliasRepository struct {
+	db *sql.DB
+}
+
+func NewAliasRepository(db *sql.DB) *AliasRepository {
+	return &AliasRepository{db: db}
+}
+
+// ResolvePath returns the latest version at a folder path and original filename.
+// When several version chains share the path, the most recently created one wins.
+func (r *AliasRepository) ResolvePath(projectID, folderPath, originalFilename string) (*Asset, error) {
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE project_id = $1 AND folder_path = $2 AND original_filename = $3 AND is_latest = TRUE
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+
+	asset, err := scanAsset(r.db.QueryRow(query, projectID, folderPath, originalFilename))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("asset not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve alias: %w", err)
+	}
+
+	return asset, nil
+}
+
+// GetChainVersion returns a specific version of the chain rooted at rootAssetID
+func (r *AliasRepository) GetChainVersion(rootAssetID string, version int) (*Asset, error) {
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE (id = $1 OR parent_asset_id = $1) AND version = $2
+	`
+
+	asset, err := scanAsset(r.db.QueryRow(query, rootAssetID, version))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("asset version not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset version: %w", err)
+	}
+
+	return asset, nil
+}
+
+// GetLatestVersion returns the latest version of the chain rooted at rootAssetID
+func (r *AliasRepository) GetLatestVersion(rootAssetID string) (*Asset, error) {
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE (id = $1 OR parent_asset_id = $1) AND is_latest = TRUE
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	asset, err := scanAsset(r.db.QueryRow(query, rootAssetID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("asset not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest version: %w", err)
+	}
+
+	return asset, nil
+}
+
+// GetPinnedVersion returns the version the chain's alias is pinned to, or nil when it follows the latest
+func (r *AliasRepository) GetPinnedVersion(rootAssetID string) (*Asset, error) {
+	query := `
+		SELECT ` + qualifiedAssetColumns("a") + `
+		FROM asset_pins p
+		JOIN assets a ON a.id = p.asset_id
+		WHERE p.root_asset_id = $1
+	`
+
+	asset, err := scanAsset(r.db.QueryRow(query, rootAssetID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned version: %w", err)
+	}
+
+	return asset, nil
+}
+
+// PinVersion makes the chain's alias resolve to assetID instead of the latest version
+func (r *AliasRepository) PinVersion(rootAssetID, assetID, pinnedBy string) error {
+	query := `
+		INSERT INTO asset_pins (root_asset_id, asset_id, pinned_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (root_asset_id) DO UPDATE
+		SET asset_id = EXCLUDED.asset_id, pinned_by = EXCLUDED.pinned_by, pinned_at = NOW()
+	`
+
+	if _, err := r.db.Exec(query, rootAssetID, assetID, pinnedBy); err != nil {
+		return fmt.Errorf("failed to pin version: %w", err)
+	}
+
+	return nil
+}
+
+// UnpinVersion makes the chain's alias follow the latest version again
+func (r *AliasRepository) UnpinVersion(rootAssetID string) error {
+	if _, err := r.db.Exec(`DELETE FROM asset_pins WHERE root_asset_id = $1`, rootAssetID); err != nil {
+		return fmt.Errorf("failed to unpin version: %w", err)
+	}
+
+	return nil
+}
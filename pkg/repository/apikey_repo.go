@@ -6,9 +6,14 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"file-service/pkg/models"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type APIKeyRepository struct {
@@ -33,66 +38,143 @@ func HashAPIKey(key string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// CreateAPIKey creates a new API key
-func (r *APIKeyRepository) CreateAPIKey(clientID, projectID, name string, permissions []string, expiresAt *time.Time) (string, *models.APIKey, error) {
-	// Generate the actual key
+// ErrAPIKeyRotated is returned when rotating a key that already has a successor or is no longer active
+var ErrAPIKeyRotated = errors.New("API key is inactive or already rotated")
+
+// insertAPIKeyQuery inserts a key and returns it; $12 is the key it replaces, if any
+const insertAPIKeyQuery = `
+	INSERT INTO api_keys (client_id, project_id, key_hash, key_prefix, name, permissions,
+		allowed_folders, allowed_cidrs, allowed_methods, rate_limit_per_minute, expires_at, rotated_from_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING ` + apiKeyColumns
+
+// newAPIKeyArgs generates a key for the project and returns it with the arguments of insertAPIKeyQuery
+func newAPIKeyArgs(clientID, projectID, name string, permissions []string, scopes models.APIKeyScopes, expiresAt *time.Time, rotatedFromID *string) (string, []any) {
 	key := GenerateAPIKey(projectID)
 	keyHash := HashAPIKey(key)
 	keyPrefix := key[:20] + "..."
 
 	permJSON, _ := json.Marshal(permissions)
 
-	query := `
-		INSERT INTO api_keys (client_id, project_id, key_hash, key_prefix, name, permissions, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, client_id, project_id, key_prefix, name, permissions, is_active, created_at, expires_at
-	`
+	return key, []any{clientID, projectID, keyHash, keyPrefix, name, permJSON,
+		pq.Array(nonNil(scopes.AllowedFolders)), pq.Array(nonNil(scopes.AllowedCIDRs)), pq.Array(nonNil(scopes.AllowedMethods)),
+		scopes.RateLimitPerMinute, expiresAt, rotatedFromID}
+}
 
-	var apiKey models.APIKey
-	var permStr string
-	var projID sql.NullString
-
-	err := r.db.QueryRow(query, clientID, projectID, keyHash, keyPrefix, name, permJSON, expiresAt).Scan(
-		&apiKey.ID,
-		&apiKey.ClientID,
-		&projID,
-		&apiKey.KeyPrefix,
-		&apiKey.Name,
-		&permStr,
-		&apiKey.IsActive,
-		&apiKey.CreatedAt,
-		&apiKey.ExpiresAt,
-	)
+// CreateAPIKey creates a new API key restricted by the given scopes
+func (r *APIKeyRepository) CreateAPIKey(clientID, projectID, name string, permissions []string, scopes models.APIKeyScopes, expiresAt *time.Time) (string, *models.APIKey, error) {
+	key, args := newAPIKeyArgs(clientID, projectID, name, permissions, scopes, expiresAt, nil)
 
+	apiKey, err := scanAPIKey(r.db.QueryRow(insertAPIKeyQuery, args...))
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to create API key: %w", err)
 	}
 
-	if projID.Valid {
-		apiKey.ProjectID = &projID.String
+	return key, apiKey, nil
+}
+
+// RotateAPIKey issues a successor with the same owner, name, project, permissions and scopes.
+// The old key keeps working for the grace period, capped by its own expiry, and is then deactivated.
+func (r *APIKeyRepository) RotateAPIKey(keyID string, grace time.Duration, expiresAt *time.Time) (string, *models.APIKey, *models.APIKey, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to rotate API key: %w", err)
 	}
+	defer tx.Rollback()
 
-	json.Unmarshal([]byte(permStr), &apiKey.Permissions)
+	old, err := scanAPIKey(tx.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1 FOR UPDATE`, keyID))
+	if err == sql.ErrNoRows {
+		return "", nil, nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	if !old.IsActive || old.SupersededByID != nil || old.ProjectID == nil {
+		return "", nil, nil, ErrAPIKeyRotated
+	}
+
+	key, args := newAPIKeyArgs(old.ClientID, *old.ProjectID, old.Name, old.Permissions, old.APIKeyScopes, expiresAt, &old.ID)
+	successor, err := scanAPIKey(tx.QueryRow(insertAPIKeyQuery, args...))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create successor key: %w", err)
+	}
+
+	query := `
+		UPDATE api_keys
+		SET superseded_by_id = $2,
+			grace_ends_at = LEAST(NOW() + make_interval(secs => $3), COALESCE(expires_at, 'infinity'))
+		WHERE id = $1
+		RETURNING ` + apiKeyColumns
+	old, err = scanAPIKey(tx.QueryRow(query, keyID, successor.ID, grace.Seconds()))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to retire API key: %w", err)
+	}
+
+	// A signing key's successor signs too, with a fresh secret
+	if old.SigningEnabled {
+		query := `UPDATE api_keys SET signing_salt = $2, require_signed = $3 WHERE id = $1 RETURNING ` + apiKeyColumns
+		successor, err = scanAPIKey(tx.QueryRow(query, successor.ID, newSigningSalt(), old.RequireSigned))
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to enable signing on successor key: %w", err)
+		}
+	}
 
-	return key, &apiKey, nil
+	if err := tx.Commit(); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to rotate API key: %w", err)
+	}
+
+	return key, successor, old, nil
 }
 
-// ValidateAPIKey checks if API key is valid and returns associated data
+// ValidateAPIKey checks if API key is valid and returns associated data.
+// last_used_at is stamped by the batched usage writes, not here.
 func (r *APIKeyRepository) ValidateAPIKey(key string) (*models.APIKey, error) {
-	keyHash := HashAPIKey(key)
+	return r.validateAPIKey("key_hash", HashAPIKey(key))
+}
 
+// ValidateAPIKeyID returns the key with the id when it is usable; signed requests name their key by id
+func (r *APIKeyRepository) ValidateAPIKeyID(keyID string) (*models.APIKey, error) {
+	return r.validateAPIKey("id", keyID)
+}
+
+func (r *APIKeyRepository) validateAPIKey(column, value string) (*models.APIKey, error) {
 	query := `
-		SELECT id, client_id, project_id, key_prefix, name, permissions, is_active, last_used_at, created_at, expires_at
+		SELECT ` + apiKeyColumns + `
 		FROM api_keys
-		WHERE key_hash = $1 AND is_active = true
+		WHERE ` + column + ` = $1 AND is_active = true AND (grace_ends_at IS NULL OR grace_ends_at > NOW())
 	`
 
+	apiKey, err := scanAPIKey(r.db.QueryRow(query, value))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate API key: %w", err)
+	}
+
+	// Check expiration
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("API key expired")
+	}
+
+	return apiKey, nil
+}
+
+const apiKeyColumns = `id, client_id, project_id, key_prefix, name, permissions, is_active, last_used_at, created_at, expires_at,
+	allowed_folders, allowed_cidrs, allowed_methods, rate_limit_per_minute, rotated_from_id, superseded_by_id, grace_ends_at, signing_salt, require_signed`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
 	var apiKey models.APIKey
 	var permStr string
 	var projID sql.NullString
 	var lastUsed sql.NullTime
+	var folders, cidrs, methods pq.StringArray
+	var rateLimit sql.NullInt64
+	var rotatedFrom, supersededBy sql.NullString
+	var graceEnds sql.NullTime
+	var signingSalt sql.NullString
 
-	err := r.db.QueryRow(query, keyHash).Scan(
+	err := row.Scan(
 		&apiKey.ID,
 		&apiKey.ClientID,
 		&projID,
@@ -103,13 +185,39 @@ func (r *APIKeyRepository) ValidateAPIKey(key string) (*models.APIKey, error) {
 		&lastUsed,
 		&apiKey.CreatedAt,
 		&apiKey.ExpiresAt,
+		&folders,
+		&cidrs,
+		&methods,
+		&rateLimit,
+		&rotatedFrom,
+		&supersededBy,
+		&graceEnds,
+		&signingSalt,
+		&apiKey.RequireSigned,
 	)
+	if err != nil {
+		return nil, err
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("invalid API key")
+	apiKey.AllowedFolders = nonNil(folders)
+	apiKey.AllowedCIDRs = nonNil(cidrs)
+	apiKey.AllowedMethods = nonNil(methods)
+	if rateLimit.Valid {
+		limit := int(rateLimit.Int64)
+		apiKey.RateLimitPerMinute = &limit
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to validate API key: %w", err)
+	if rotatedFrom.Valid {
+		apiKey.RotatedFromID = &rotatedFrom.String
+	}
+	if supersededBy.Valid {
+		apiKey.SupersededByID = &supersededBy.String
+	}
+	if graceEnds.Valid {
+		apiKey.GraceEndsAt = &graceEnds.Time
+	}
+	if signingSalt.Valid {
+		apiKey.SigningSalt = signingSalt.String
+		apiKey.SigningEnabled = true
 	}
 
 	if projID.Valid {
@@ -121,78 +229,92 @@ func (r *APIKeyRepository) ValidateAPIKey(key string) (*models.APIKey, error) {
 
 	json.Unmarshal([]byte(permStr), &apiKey.Permissions)
 
-	// Check expiration
-	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
-		return nil, fmt.Errorf("API key expired")
+	return &apiKey, nil
+}
+
+// GetAPIKeys retrieves one page of API keys, newest first.
+// An empty clientID or projectID leaves that filter out; at least one must be set.
+func (r *APIKeyRepository) GetAPIKeys(clientID, projectID string, page PageRequest) ([]models.APIKey, *PageInfo, error) {
+	if err := page.checkCursor(newestFirstCursorSort); err != nil {
+		return nil, nil, err
 	}
 
-	// Update last used timestamp
-	go r.updateLastUsed(apiKey.ID)
+	var conditions []string
+	var args []any
+	if clientID != "" {
+		args = append(args, clientID)
+		conditions = append(conditions, "client_id = $"+strconv.Itoa(len(args)))
+	}
+	if projectID != "" {
+		args = append(args, projectID)
+		conditions = append(conditions, "project_id = $"+strconv.Itoa(len(args)))
+	}
+	if len(conditions) == 0 {
+		return nil, nil, fmt.Errorf("client or project required")
+	}
 
-	return &apiKey, nil
-}
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "api_keys", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count API keys: %w", err)
+		}
+		info.Total = &total
+	}
 
-func (r *APIKeyRepository) updateLastUsed(keyID string) {
-	query := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`
-	r.db.Exec(query, keyID)
-}
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "created_at", "timestamp", "DESC")
 
-// GetAPIKeysByClientID retrieves all API keys for a client
-func (r *APIKeyRepository) GetAPIKeysByClientID(clientID string) ([]models.APIKey, error) {
+	limit := page.pageLimit()
+	args = append(args, limit+1)
 	query := `
-		SELECT id, client_id, project_id, key_prefix, name, permissions, is_active, last_used_at, created_at, expires_at
+		SELECT ` + apiKeyColumns + `
 		FROM api_keys
-		WHERE client_id = $1
-		ORDER BY created_at DESC
-	`
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args))
 
-	rows, err := r.db.Query(query, clientID)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get API keys: %w", err)
+		return nil, nil, fmt.Errorf("failed to get API keys: %w", err)
 	}
 	defer rows.Close()
 
-	var keys []models.APIKey
+	keys := make([]models.APIKey, 0)
 	for rows.Next() {
-		var apiKey models.APIKey
-		var permStr string
-		var projID sql.NullString
-		var lastUsed sql.NullTime
-
-		err := rows.Scan(
-			&apiKey.ID,
-			&apiKey.ClientID,
-			&projID,
-			&apiKey.KeyPrefix,
-			&apiKey.Name,
-			&permStr,
-			&apiKey.IsActive,
-			&lastUsed,
-			&apiKey.CreatedAt,
-			&apiKey.ExpiresAt,
-		)
+		apiKey, err := scanAPIKey(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan API key: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan API key: %w", err)
 		}
+		keys = append(keys, *apiKey)
+	}
 
-		if projID.Valid {
-			apiKey.ProjectID = &projID.String
-		}
-		if lastUsed.Valid {
-			apiKey.LastUsedAt = &lastUsed.Time
-		}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		last := keys[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: newestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
 
-		json.Unmarshal([]byte(permStr), &apiKey.Permissions)
-		keys = append(keys, apiKey)
+	return keys, info, nil
+}
+
+// GetAPIKeyByID retrieves an API key by ID; callers must check it belongs to them or to a project they manage
+func (r *APIKeyRepository) GetAPIKeyByID(keyID string) (*models.APIKey, error) {
+	apiKey, err := scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, keyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
 	}
 
-	return keys, nil
+	return apiKey, nil
 }
 
 // RevokeAPIKey deactivates an API key
-func (r *APIKeyRepository) RevokeAPIKey(keyID, clientID string) error {
-	query := `UPDATE api_keys SET is_active = false WHERE id = $1 AND client_id = $2`
-	result, err := r.db.Exec(query, keyID, clientID)
+func (r *APIKeyRepository) RevokeAPIKey(keyID string) error {
+	query := `UPDATE api_keys SET is_active = false WHERE id = $1`
+	result, err := r.db.Exec(query, keyID)
 	if err != nil {
 		return fmt.Errorf("failed to revoke API key: %w", err)
 	}
@@ -204,3 +326,120 @@ func (r *APIKeyRepository) RevokeAPIKey(keyID, clientID string) error {
 
 	return nil
 }
+
+// DeactivateRotatedKeys deactivates rotated keys whose grace period has ended and returns how many
+func (r *APIKeyRepository) DeactivateRotatedKeys() (int64, error) {
+	result, err := r.db.Exec(`UPDATE api_keys SET is_active = false WHERE is_active = true AND grace_ends_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deactivate rotated API keys: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ExpiringAPIKey is an active key nearing its expiry together with the client to warn
+type ExpiringAPIKey struct {
+	KeyID       string
+	KeyPrefix   string
+	Name        string
+	ProjectName string
+	ExpiresAt   time.Time
+	OwnerEmail  string
+	OwnerName   string
+}
+
+// ClaimExpiringKeys marks active, unrotated keys expiring within the window as warned and returns them,
+// so each key is warned about once even when several instances run the job
+func (r *APIKeyRepository) ClaimExpiringKeys(within time.Duration) ([]ExpiringAPIKey, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE api_keys
+			SET expiry_warning_sent_at = NOW()
+			WHERE is_active = true AND superseded_by_id IS NULL AND expiry_warning_sent_at IS NULL
+			  AND expires_at > NOW() AND expires_at <= NOW() + make_interval(secs => $1)
+			RETURNING id, key_prefix, name, project_id, client_id, expires_at
+		)
+		SELECT k.id, k.key_prefix, k.name, COALESCE(p.name, ''), k.expires_at, c.email, c.name
+		FROM claimed k
+		JOIN clients c ON c.id = k.client_id
+		LEFT JOIN projects p ON p.id = k.project_id
+		ORDER BY k.expires_at
+	`
+
+	rows, err := r.db.Query(query, within.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expiring API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]ExpiringAPIKey, 0)
+	for rows.Next() {
+		var key ExpiringAPIKey
+		if err := rows.Scan(&key.KeyID, &key.KeyPrefix, &key.Name, &key.ProjectName, &key.ExpiresAt, &key.OwnerEmail, &key.OwnerName); err != nil {
+			return nil, fmt.Errorf("failed to scan expiring API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func newSigningSalt() string {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return hex.EncodeToString(salt)
+}
+
+// EnableSigning gives the key a new signing salt, replacing any previous signing secret
+func (r *APIKeyRepository) EnableSigning(keyID string, requireSigned bool) (*models.APIKey, error) {
+	query := `UPDATE api_keys SET signing_salt = $2, require_signed = $3 WHERE id = $1 AND is_active = true RETURNING ` + apiKeyColumns
+	apiKey, err := scanAPIKey(r.db.QueryRow(query, keyID, newSigningSalt(), requireSigned))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable signing: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+// DisableSigning drops the key's signing secret; the key is usable through X-API-Key only
+func (r *APIKeyRepository) DisableSigning(keyID string) (*models.APIKey, error) {
+	query := `UPDATE api_keys SET signing_salt = NULL, require_signed = false WHERE id = $1 RETURNING ` + apiKeyColumns
+	apiKey, err := scanAPIKey(r.db.QueryRow(query, keyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to disable signing: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+// UseNonce records a signed request's nonce and reports false when the key already used it
+func (r *APIKeyRepository) UseNonce(keyID, nonce string, ttl time.Duration) (bool, error) {
+	query := `
+		INSERT INTO api_key_nonces (api_key_id, nonce, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))
+		ON CONFLICT (api_key_id, nonce) DO NOTHING
+	`
+	result, err := r.db.Exec(query, keyID, nonce, ttl.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to record nonce: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows == 1, nil
+}
+
+// DeleteExpiredNonces removes nonces whose requests can no longer pass the timestamp check
+func (r *APIKeyRepository) DeleteExpiredNonces() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM api_key_nonces WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired nonces: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"file-service/pkg/models"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// usageBucketLayout formats bucket starts for the timestamp[] cast in SaveUsage
+const usageBucketLayout = "2006-01-02 15:04:05"
+
+// APIKeyUsageRepository stores request counts of API keys in hourly buckets
+type APIKeyUsageRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyUsageRepository(db *sql.DB) *APIKeyUsageRepository {
+	return &APIKeyUsageRepository{db: db}
+}
+
+// APIKeyUsageCount is the traffic of a key on one route and status within one bucket
+type APIKeyUsageCount struct {
+	KeyID         string
+	BucketStart   time.Time
+	Route         string
+	StatusCode    int
+	Requests      int64
+	BytesUploaded int64
+}
+
+// SaveUsage adds a batch of counts to their buckets and stamps last_used_at on the keys, in one transaction
+func (r *APIKeyUsageRepository) SaveUsage(counts []APIKeyUsageCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	keyIDs := make([]string, len(counts))
+	buckets := make([]string, len(counts))
+	routes := make([]string, len(counts))
+	statuses := make([]int64, len(counts))
+	requests := make([]int64, len(counts))
+	bytes := make([]int64, len(counts))
+	for i, count := range counts {
+		keyIDs[i] = count.KeyID
+		buckets[i] = count.BucketStart.UTC().Format(usageBucketLayout)
+		routes[i] = count.Route
+		statuses[i] = int64(count.StatusCode)
+		requests[i] = count.Requests
+		bytes[i] = count.BytesUploaded
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save API key usage: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO api_key_usage (api_key_id, bucket_start, route, status_code, request_count, bytes_uploaded)
+		SELECT u.key_id, u.bucket_start, u.route, u.status_code, u.requests, u.bytes
+		FROM unnest($1::uuid[], $2::timestamp[], $3::text[], $4::int[], $5::bigint[], $6::bigint[])
+			AS u(key_id, bucket_start, route, status_code, requests, bytes)
+		WHERE EXISTS (SELECT 1 FROM api_keys k WHERE k.id = u.key_id)
+		ON CONFLICT (api_key_id, bucket_start, route, status_code) DO UPDATE
+		SET request_count = api_key_usage.request_count + EXCLUDED.request_count,
+			bytes_uploaded = api_key_usage.bytes_uploaded + EXCLUDED.bytes_uploaded
+	`
+	if _, err := tx.Exec(query, pq.Array(keyIDs), pq.Array(buckets), pq.Array(routes), pq.Array(statuses), pq.Array(requests), pq.Array(bytes)); err != nil {
+		return fmt.Errorf("failed to save API key usage: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE api_keys SET last_used_at = NOW() WHERE id = ANY($1::uuid[])`, pq.Array(keyIDs)); err != nil {
+		return fmt.Errorf("failed to update API key last use: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetUsageSeries returns the traffic of a key per hour or day bucket in [from, to); buckets without traffic are left out
+func (r *APIKeyUsageRepository) GetUsageSeries(keyID string, from, to time.Time, interval string) ([]models.APIKeyUsagePoint, error) {
+	query := `
+		SELECT date_trunc($4, bucket_start) AS bucket,
+			SUM(request_count),
+			COALESCE(SUM(request_count) FILTER (WHERE status_code BETWEEN 400 AND 499), 0),
+			COALESCE(SUM(request_count) FILTER (WHERE status_code >= 500), 0),
+			SUM(bytes_uploaded)
+		FROM api_key_usage
+		WHERE api_key_id = $1 AND bucket_start >= $2 AND bucket_start < $3
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := r.db.Query(query, keyID, from.UTC().Format(usageBucketLayout), to.UTC().Format(usageBucketLayout), interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key usage: %w", err)
+	}
+	defer rows.Close()
+
+	points := make([]models.APIKeyUsagePoint, 0)
+	for rows.Next() {
+		var point models.APIKeyUsagePoint
+		if err := rows.Scan(&point.Bucket, &point.Requests, &point.ClientErrors, &point.ServerErrors, &point.BytesUploaded); err != nil {
+			return nil, fmt.Errorf("failed to scan API key usage: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+// GetUsageByRoute returns the traffic of a key in [from, to) per route and status, busiest first
+func (r *APIKeyUsageRepository) GetUsageByRoute(keyID string, from, to time.Time) ([]models.APIKeyRouteUsage, error) {
+	query := `
+		SELECT route, status_code, SUM(request_count), SUM(bytes_uploaded)
+		FROM api_key_usage
+		WHERE api_key_id = $1 AND bucket_start >= $2 AND bucket_start < $3
+		GROUP BY route, status_code
+		ORDER BY SUM(request_count) DESC, route, status_code
+	`
+
+	rows, err := r.db.Query(query, keyID, from.UTC().Format(usageBucketLayout), to.UTC().Format(usageBucketLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key usage by route: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make([]models.APIKeyRouteUsage, 0)
+	for rows.Next() {
+		var route models.APIKeyRouteUsage
+		if err := rows.Scan(&route.Route, &route.StatusCode, &route.Requests, &route.BytesUploaded); err != nil {
+			return nil, fmt.Errorf("failed to scan API key usage by route: %w", err)
+		}
+		usage = append(usage, route)
+	}
+
+	return usage, rows.Err()
+}
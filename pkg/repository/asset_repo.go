@@ -2,10 +2,16 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"file-service/pkg/workflow"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type AssetRepository struct {
@@ -17,40 +23,49 @@ func NewAssetRepository(db *sql.DB) *AssetRepository {
 }
 
 type Asset struct {
-	ID               string    `json:"id"`
-	ClientID         string    `json:"client_id"`
-	ProjectID        string    `json:"project_id"`
-	FolderPath       string    `json:"folder_path"`
-	Filename         string    `json:"filename"`
-	OriginalFilename string    `json:"original_filename"`
-	FileSize         int64     `json:"file_size"`
-	MimeType         string    `json:"mime_type,omitempty"`
-	S3Key            string    `json:"s3_key"`
-	PresignedURL     string    `json:"presigned_url,omitempty"`
-	Version          int       `json:"version"`
-	IsLatest         bool      `json:"is_latest"`
-	ParentAssetID    *string   `json:"parent_asset_id,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-}
-
-func (r *AssetRepository) CreateAsset(clientID, projectID, folderPath, filename, originalFilename string, fileSize int64, mimeType, s3Key string) (*Asset, error) {
-	assetID := uuid.New().String()
+	ID               string            `json:"id"`
+	ClientID         string            `json:"client_id"`
+	ProjectID        string            `json:"project_id"`
+	FolderPath       string            `json:"folder_path"`
+	Filename         string            `json:"filename"`
+	OriginalFilename string            `json:"original_filename"`
+	FileSize         int64             `json:"file_size"`
+	MimeType         string            `json:"mime_type,omitempty"`
+	S3Key            string            `json:"s3_key"`
+	PresignedURL     string            `json:"presigned_url,omitempty"`
+	Version          int               `json:"version"`
+	IsLatest         bool              `json:"is_latest"`
+	ParentAssetID    *string           `json:"parent_asset_id,omitempty"`
+	Tags             []string          `json:"tags"`
+	Metadata         map[string]string `json:"metadata"`
+	// MetadataSchemaVersion is the project schema version the metadata was last validated against
+	MetadataSchemaVersion *int `json:"metadata_schema_version,omitempty"`
+	// State is the asset's place in the project's publishing workflow
+	State     workflow.State `json:"state"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
 
-	if folderPath == "" {
-		folderPath = "/"
-	}
+const assetColumns = `id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, tags, metadata, metadata_schema_version, state, created_at, updated_at`
 
-	query := `
-		INSERT INTO assets (id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 1, TRUE)
-		RETURNING id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, created_at, updated_at
-	`
+// qualifiedAssetColumns returns assetColumns prefixed with a table alias for joins
+func qualifiedAssetColumns(alias string) string {
+	columns := strings.Split(assetColumns, ", ")
+	for i := range columns {
+		columns[i] = alias + "." + columns[i]
+	}
+	return strings.Join(columns, ", ")
+}
 
+func scanAsset(row rowScanner) (*Asset, error) {
 	var asset Asset
+	var mimeType sql.NullString
 	var parentID sql.NullString
+	var tags pq.StringArray
+	var metadata []byte
+	var schemaVersion sql.NullInt64
 
-	err := r.db.QueryRow(query, assetID, clientID, projectID, folderPath, filename, originalFilename, fileSize, mimeType, s3Key).Scan(
+	err := row.Scan(
 		&asset.ID,
 		&asset.ClientID,
 		&asset.ProjectID,
@@ -58,27 +73,98 @@ func (r *AssetRepository) CreateAsset(clientID, projectID, folderPath, filename,
 		&asset.Filename,
 		&asset.OriginalFilename,
 		&asset.FileSize,
-		&asset.MimeType,
+		&mimeType,
 		&asset.S3Key,
 		&asset.Version,
 		&asset.IsLatest,
 		&parentID,
+		&tags,
+		&metadata,
+		&schemaVersion,
+		&asset.State,
 		&asset.CreatedAt,
 		&asset.UpdatedAt,
 	)
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to create asset: %w", err)
+		return nil, err
 	}
 
+	asset.MimeType = mimeType.String
 	if parentID.Valid {
 		asset.ParentAssetID = &parentID.String
 	}
 
+	if schemaVersion.Valid {
+		version := int(schemaVersion.Int64)
+		asset.MetadataSchemaVersion = &version
+	}
+
+	asset.Tags = []string(tags)
+	if asset.Tags == nil {
+		asset.Tags = []string{}
+	}
+	asset.Metadata = map[string]string{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &asset.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode asset metadata: %w", err)
+		}
+	}
+
 	return &asset, nil
 }
 
-func (r *AssetRepository) CreateAssetVersion(clientID, projectID, folderPath, filename, originalFilename string, fileSize int64, mimeType, s3Key, parentAssetID string) (*Asset, error) {
+// AssetAttributes holds the descriptive data recorded with a new asset or version
+type AssetAttributes struct {
+	Tags          []string
+	Metadata      map[string]string
+	SchemaVersion *int // project metadata schema version the metadata was validated against
+}
+
+// encodeTagsAndMetadata converts tags and metadata to their column values
+func encodeTagsAndMetadata(tags []string, metadata map[string]string) (any, []byte, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	return pq.Array(tags), metadataJSON, nil
+}
+
+func (r *AssetRepository) CreateAsset(clientID, projectID, folderPath, filename, originalFilename string, fileSize int64, mimeType, s3Key string, attrs AssetAttributes) (*Asset, error) {
+	assetID := uuid.New().String()
+
+	if folderPath == "" {
+		folderPath = "/"
+	}
+
+	tagsArg, metadataArg, err := encodeTagsAndMetadata(attrs.Tags, attrs.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO assets (id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, tags, metadata, metadata_schema_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 1, TRUE, $10, $11, $12)
+		RETURNING ` + assetColumns
+
+	asset, err := scanAsset(r.db.QueryRow(query, assetID, clientID, projectID, folderPath, filename, originalFilename, fileSize, mimeType, s3Key, tagsArg, metadataArg, attrs.SchemaVersion))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create asset: %w", err)
+	}
+
+	return asset, nil
+}
+
+// CreateAssetVersion records a new latest version of an asset
+func (r *AssetRepository) CreateAssetVersion(clientID, projectID, folderPath, filename, originalFilename string, fileSize int64, mimeType, s3Key, parentAssetID string, attrs AssetAttributes) (*Asset, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
@@ -86,12 +172,17 @@ func (r *AssetRepository) CreateAssetVersion(clientID, projectID, folderPath, fi
 	defer tx.Rollback()
 
 	var parentVersion int
-	err = tx.QueryRow(`SELECT version FROM assets WHERE id = $1 AND client_id = $2`, parentAssetID, clientID).Scan(&parentVersion)
+	err = tx.QueryRow(`SELECT version FROM assets WHERE id = $1 AND project_id = $2`, parentAssetID, projectID).Scan(&parentVersion)
 	if err != nil {
 		return nil, fmt.Errorf("parent asset not found: %w", err)
 	}
 
-	_, err = tx.Exec(`UPDATE assets SET is_latest = FALSE WHERE (id = $1 OR parent_asset_id = $1) AND client_id = $2`, parentAssetID, clientID)
+	tagsArg, metadataArg, err := encodeTagsAndMetadata(attrs.Tags, attrs.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE assets SET is_latest = FALSE WHERE (id = $1 OR parent_asset_id = $1) AND project_id = $2`, parentAssetID, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update previous versions: %w", err)
 	}
@@ -100,136 +191,247 @@ func (r *AssetRepository) CreateAssetVersion(clientID, projectID, folderPath, fi
 	nextVersion := parentVersion + 1
 
 	query := `
-		INSERT INTO assets (id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, TRUE, $11)
-		RETURNING id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, created_at, updated_at
-	`
-
-	var asset Asset
-	var parentID sql.NullString
+		INSERT INTO assets (id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, tags, metadata, metadata_schema_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, TRUE, $11, $12, $13, $14)
+		RETURNING ` + assetColumns
 
-	err = tx.QueryRow(query, assetID, clientID, projectID, folderPath, filename, originalFilename, fileSize, mimeType, s3Key, nextVersion, parentAssetID).Scan(
-		&asset.ID,
-		&asset.ClientID,
-		&asset.ProjectID,
-		&asset.FolderPath,
-		&asset.Filename,
-		&asset.OriginalFilename,
-		&asset.FileSize,
-		&asset.MimeType,
-		&asset.S3Key,
-		&asset.Version,
-		&asset.IsLatest,
-		&parentID,
-		&asset.CreatedAt,
-		&asset.UpdatedAt,
-	)
+	asset, err := scanAsset(tx.QueryRow(query, assetID, clientID, projectID, folderPath, filename, originalFilename, fileSize, mimeType, s3Key, nextVersion, parentAssetID, tagsArg, metadataArg, attrs.SchemaVersion))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create asset version: %w", err)
 	}
 
-	if parentID.Valid {
-		asset.ParentAssetID = &parentID.String
-	}
-
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return &asset, nil
+	return asset, nil
+}
+
+// AssetFilter narrows and orders an asset listing
+type AssetFilter struct {
+	FolderPath    *string
+	MimeTypes     []string // exact ("image/png") or wildcard ("image/*")
+	Extensions    []string
+	SizeGT        *int64
+	SizeLT        *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Query         string            // case-insensitive match on the original filename
+	Tags          []string          // assets must carry every tag
+	Metadata      map[string]string // assets must carry every key with the given value
+	States        []workflow.State  // assets must be in one of the states
+	ReaderID      string            // when set, assets in folders denied to this client are left out
+	FolderScopes  []string          // when set, only assets under one of these folder prefixes are kept
+	Sort          string            // name, created_at, size or type
+	Order         string            // asc or desc
+}
+
+const (
+	folderCursorSort  = "folder_path:ASC"
+	versionCursorSort = "version:DESC"
+)
+
+type assetSortKey struct {
+	expr     string
+	castType string
+}
+
+var assetSortKeys = map[string]assetSortKey{
+	"name":       {expr: "original_filename", castType: "text"},
+	"created_at": {expr: "created_at", castType: "timestamp"},
+	"size":       {expr: "file_size", castType: "bigint"},
+	"type":       {expr: "COALESCE(mime_type, '')", castType: "text"},
+}
+
+// assetSortValue returns the cursor value of an asset for the given sort field
+func assetSortValue(asset Asset, field string) string {
+	switch field {
+	case "name":
+		return asset.OriginalFilename
+	case "size":
+		return strconv.FormatInt(asset.FileSize, 10)
+	case "type":
+		return asset.MimeType
+	default:
+		return asset.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// buildAssetFilter appends the WHERE conditions of a filter
+func buildAssetFilter(filter AssetFilter, conditions []string, args []any) ([]string, []any) {
+	if filter.FolderPath != nil && *filter.FolderPath != "" {
+		args = append(args, *filter.FolderPath)
+		conditions = append(conditions, fmt.Sprintf("folder_path = $%d", len(args)))
+	}
+
+	if len(filter.MimeTypes) > 0 {
+		patterns := make([]string, 0, len(filter.MimeTypes))
+		for _, mimeType := range filter.MimeTypes {
+			mimeType = strings.ToLower(mimeType)
+			if strings.HasSuffix(mimeType, "/*") {
+				patterns = append(patterns, escapeLike(strings.TrimSuffix(mimeType, "*"))+"%")
+			} else {
+				patterns = append(patterns, escapeLike(mimeType))
+			}
+		}
+		args = append(args, pq.Array(patterns))
+		conditions = append(conditions, fmt.Sprintf("lower(mime_type) LIKE ANY($%d)", len(args)))
+	}
+
+	if len(filter.Extensions) > 0 {
+		patterns := make([]string, 0, len(filter.Extensions))
+		for _, ext := range filter.Extensions {
+			patterns = append(patterns, "%."+escapeLike(strings.ToLower(strings.TrimPrefix(ext, "."))))
+		}
+		args = append(args, pq.Array(patterns))
+		conditions = append(conditions, fmt.Sprintf("lower(original_filename) LIKE ANY($%d)", len(args)))
+	}
+
+	if filter.SizeGT != nil {
+		args = append(args, *filter.SizeGT)
+		conditions = append(conditions, fmt.Sprintf("file_size > $%d", len(args)))
+	}
+	if filter.SizeLT != nil {
+		args = append(args, *filter.SizeLT)
+		conditions = append(conditions, fmt.Sprintf("file_size < $%d", len(args)))
+	}
+
+	if filter.CreatedAfter != nil {
+		args = append(args, filter.CreatedAfter.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at > $%d", len(args)))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, filter.CreatedBefore.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if filter.Query != "" {
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf("original_filename ILIKE $%d", len(args)))
+	}
+
+	if len(filter.Tags) > 0 {
+		args = append(args, pq.Array(filter.Tags))
+		conditions = append(conditions, fmt.Sprintf("tags @> $%d::text[]", len(args)))
+	}
+
+	if len(filter.Metadata) > 0 {
+		metadataJSON, _ := json.Marshal(filter.Metadata)
+		args = append(args, metadataJSON)
+		conditions = append(conditions, fmt.Sprintf("metadata @> $%d::jsonb", len(args)))
+	}
+
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, state := range filter.States {
+			states[i] = string(state)
+		}
+		args = append(args, pq.Array(states))
+		conditions = append(conditions, fmt.Sprintf("state = ANY($%d)", len(args)))
+	}
+
+	if filter.ReaderID != "" {
+		args = append(args, filter.ReaderID)
+		conditions = append(conditions, folderReadableCondition(len(args)))
+	}
+
+	if len(filter.FolderScopes) > 0 {
+		args = append(args, pq.Array(filter.FolderScopes))
+		conditions = append(conditions, folderScopeCondition(len(args)))
+	}
+
+	return conditions, args
+}
+
+// folderScopeCondition is the SQL condition that keeps assets under one of the folder prefixes in argument prefixArg
+func folderScopeCondition(prefixArg int) string {
+	return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM unnest($%d::text[]) AS scope(prefix)
+			WHERE left(assets.folder_path, length(scope.prefix)) = scope.prefix
+		)`, prefixArg)
 }
 
-func (r *AssetRepository) GetAssetsByProjectID(projectID, clientID string, folderPath *string) ([]Asset, error) {
-	var query string
-	var args []any
-
-	if folderPath != nil && *folderPath != "" {
-		query = `
-			SELECT id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, created_at, updated_at
-			FROM assets
-			WHERE project_id = $1 AND client_id = $2 AND folder_path = $3 AND is_latest = TRUE
-			ORDER BY created_at DESC
-		`
-		args = []any{projectID, clientID, *folderPath}
-	} else {
-		query = `
-			SELECT id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, created_at, updated_at
-			FROM assets
-			WHERE project_id = $1 AND client_id = $2 AND is_latest = TRUE
-			ORDER BY created_at DESC
-		`
-		args = []any{projectID, clientID}
+// GetAssetsByProjectID returns one page of the latest assets of a project matching the filter
+func (r *AssetRepository) GetAssetsByProjectID(projectID string, filter AssetFilter, page PageRequest) ([]Asset, *PageInfo, error) {
+	sortField := filter.Sort
+	if _, ok := assetSortKeys[sortField]; !ok {
+		sortField = "created_at"
+	}
+	sortKey := assetSortKeys[sortField]
+	direction := "DESC"
+	if filter.Order == "asc" {
+		direction = "ASC"
+	}
+
+	if err := page.checkCursor(sortField + ":" + direction); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"project_id = $1", "is_latest = TRUE"}
+	args := []any{projectID}
+	conditions, args = buildAssetFilter(filter, conditions, args)
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "assets", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count assets: %w", err)
+		}
+		info.Total = &total
 	}
 
+	conditions, args = appendKeyset(conditions, args, page.Cursor, sortKey.expr, sortKey.castType, direction)
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + sortKey.expr + ` ` + direction + `, id ` + direction + `
+		LIMIT $` + strconv.Itoa(len(args))
+
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get assets: %w", err)
+		return nil, nil, fmt.Errorf("failed to get assets: %w", err)
 	}
 	defer rows.Close()
 
-	var assets []Asset
+	assets := make([]Asset, 0)
 	for rows.Next() {
-		var asset Asset
-		var parentID sql.NullString
-
-		err := rows.Scan(
-			&asset.ID,
-			&asset.ClientID,
-			&asset.ProjectID,
-			&asset.FolderPath,
-			&asset.Filename,
-			&asset.OriginalFilename,
-			&asset.FileSize,
-			&asset.MimeType,
-			&asset.S3Key,
-			&asset.Version,
-			&asset.IsLatest,
-			&parentID,
-			&asset.CreatedAt,
-			&asset.UpdatedAt,
-		)
+		asset, err := scanAsset(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan asset: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan asset: %w", err)
 		}
 
-		if parentID.Valid {
-			asset.ParentAssetID = &parentID.String
-		}
+		assets = append(assets, *asset)
+	}
 
-		assets = append(assets, asset)
+	if len(assets) > limit {
+		assets = assets[:limit]
+		last := assets[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: sortField + ":" + direction, Value: assetSortValue(last, sortField), ID: last.ID})
 	}
 
-	return assets, nil
+	return assets, info, nil
 }
 
-func (r *AssetRepository) GetAssetByID(assetID, clientID string) (*Asset, error) {
+// FindAssetByID retrieves an asset by ID; callers must check the caller's project role
+func (r *AssetRepository) FindAssetByID(assetID string) (*Asset, error) {
 	query := `
-		SELECT id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, created_at, updated_at
+		SELECT ` + assetColumns + `
 		FROM assets
-		WHERE id = $1 AND client_id = $2
+		WHERE id = $1
 	`
 
-	var asset Asset
-	var parentID sql.NullString
-
-	err := r.db.QueryRow(query, assetID, clientID).Scan(
-		&asset.ID,
-		&asset.ClientID,
-		&asset.ProjectID,
-		&asset.FolderPath,
-		&asset.Filename,
-		&asset.OriginalFilename,
-		&asset.FileSize,
-		&asset.MimeType,
-		&asset.S3Key,
-		&asset.Version,
-		&asset.IsLatest,
-		&parentID,
-		&asset.CreatedAt,
-		&asset.UpdatedAt,
-	)
-
+	asset, err := scanAsset(r.db.QueryRow(query, assetID))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("asset not found")
 	}
@@ -237,16 +439,12 @@ func (r *AssetRepository) GetAssetByID(assetID, clientID string) (*Asset, error)
 		return nil, fmt.Errorf("failed to get asset: %w", err)
 	}
 
-	if parentID.Valid {
-		asset.ParentAssetID = &parentID.String
-	}
-
-	return &asset, nil
+	return asset, nil
 }
 
-func (r *AssetRepository) DeleteAsset(assetID, clientID string) error {
-	query := `DELETE FROM assets WHERE id = $1 AND client_id = $2`
-	result, err := r.db.Exec(query, assetID, clientID)
+func (r *AssetRepository) DeleteAsset(assetID string) error {
+	query := `DELETE FROM assets WHERE id = $1`
+	result, err := r.db.Exec(query, assetID)
 	if err != nil {
 		return fmt.Errorf("failed to delete asset: %w", err)
 	}
@@ -259,36 +457,74 @@ func (r *AssetRepository) DeleteAsset(assetID, clientID string) error {
 	return nil
 }
 
-func (r *AssetRepository) GetFoldersByProjectID(projectID, clientID string) ([]string, error) {
+// GetFoldersByProjectID returns one page of the distinct folders of a project the client may read, in path order.
+// Non-empty folderScopes keep only folders under one of the prefixes.
+func (r *AssetRepository) GetFoldersByProjectID(projectID, readerID string, folderScopes []string, page PageRequest) ([]string, *PageInfo, error) {
+	if err := page.checkCursor(folderCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"project_id = $1", folderReadableCondition(2)}
+	args := []any{projectID, readerID}
+	if len(folderScopes) > 0 {
+		args = append(args, pq.Array(folderScopes))
+		conditions = append(conditions, folderScopeCondition(len(args)))
+	}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		var total int
+		query := `SELECT COUNT(DISTINCT folder_path) FROM assets WHERE ` + strings.Join(conditions, " AND ")
+		if err := r.db.QueryRow(query, args...).Scan(&total); err != nil {
+			return nil, nil, fmt.Errorf("failed to count folders: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "folder_path", "text", "ASC")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
 	query := `
 		SELECT DISTINCT folder_path
 		FROM assets
-		WHERE project_id = $1 AND client_id = $2
+		WHERE ` + strings.Join(conditions, " AND ") + `
 		ORDER BY folder_path
-	`
+		LIMIT $` + strconv.Itoa(len(args))
 
-	rows, err := r.db.Query(query, projectID, clientID)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get folders: %w", err)
+		return nil, nil, fmt.Errorf("failed to get folders: %w", err)
 	}
 	defer rows.Close()
 
-	var folders []string
+	folders := make([]string, 0)
 	for rows.Next() {
 		var folder string
 		if err := rows.Scan(&folder); err != nil {
-			return nil, fmt.Errorf("failed to scan folder: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan folder: %w", err)
 		}
 		folders = append(folders, folder)
 	}
 
-	return folders, nil
+	if len(folders) > limit {
+		folders = folders[:limit]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: folderCursorSort, Value: folders[limit-1]})
+	}
+
+	return folders, info, nil
 }
 
-func (r *AssetRepository) GetAssetVersions(assetID, clientID string) ([]Asset, error) {
-	asset, err := r.GetAssetByID(assetID, clientID)
+// GetAssetVersions returns one page of the version chain of an asset, newest first
+func (r *AssetRepository) GetAssetVersions(assetID string, page PageRequest) ([]Asset, *PageInfo, error) {
+	if err := page.checkCursor(versionCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	asset, err := r.FindAssetByID(assetID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	rootAssetID := assetID
@@ -296,52 +532,217 @@ func (r *AssetRepository) GetAssetVersions(assetID, clientID string) ([]Asset, e
 		rootAssetID = *asset.ParentAssetID
 	}
 
+	conditions := []string{"(id = $1 OR parent_asset_id = $1)"}
+	args := []any{rootAssetID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "assets", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count asset versions: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "version", "integer", "DESC")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
 	query := `
-		SELECT id, client_id, project_id, folder_path, filename, original_filename, file_size, mime_type, s3_key, version, is_latest, parent_asset_id, created_at, updated_at
+		SELECT ` + assetColumns + `
 		FROM assets
-		WHERE (id = $1 OR parent_asset_id = $1) AND client_id = $2
-		ORDER BY version DESC
-	`
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY version DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args))
 
-	rows, err := r.db.Query(query, rootAssetID, clientID)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get asset versions: %w", err)
+		return nil, nil, fmt.Errorf("failed to get asset versions: %w", err)
 	}
 	defer rows.Close()
 
-	var versions []Asset
+	versions := make([]Asset, 0)
 	for rows.Next() {
-		var version Asset
-		var parentID sql.NullString
-
-		err := rows.Scan(
-			&version.ID,
-			&version.ClientID,
-			&version.ProjectID,
-			&version.FolderPath,
-			&version.Filename,
-			&version.OriginalFilename,
-			&version.FileSize,
-			&version.MimeType,
-			&version.S3Key,
-			&version.Version,
-			&version.IsLatest,
-			&parentID,
-			&version.CreatedAt,
-			&version.UpdatedAt,
-		)
+		version, err := scanAsset(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan version: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan version: %w", err)
 		}
 
-		if parentID.Valid {
-			version.ParentAssetID = &parentID.String
+		versions = append(versions, *version)
+	}
+
+	if len(versions) > limit {
+		versions = versions[:limit]
+		last := versions[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: versionCursorSort, Value: strconv.Itoa(last.Version), ID: last.ID})
+	}
+
+	return versions, info, nil
+}
+
+// MergeTags returns the sorted union of tag lists without duplicates
+func MergeTags(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	merged := make([]string, 0)
+	for _, list := range lists {
+		for _, tag := range list {
+			if !seen[tag] {
+				seen[tag] = true
+				merged = append(merged, tag)
+			}
 		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// TagUpdate changes the tags of an asset: Set replaces them, then Add and Remove apply
+type TagUpdate struct {
+	Set    *[]string
+	Add    []string
+	Remove []string
+}
+
+// UpdateAssetTags applies a tag update to a single asset version
+func (r *AssetRepository) UpdateAssetTags(assetID string, update TagUpdate) (*Asset, error) {
+	replace := update.Set != nil
+	var set []string
+	if replace {
+		set = *update.Set
+	}
+
+	query := `
+		UPDATE assets
+		SET tags = ARRAY(
+				SELECT DISTINCT t
+				FROM unnest(CASE WHEN $2::boolean THEN $3::text[] ELSE tags END || $4::text[]) AS t
+				WHERE t <> ALL($5::text[])
+				ORDER BY t
+			),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + assetColumns
+
+	asset, err := scanAsset(r.db.QueryRow(query, assetID, replace, pq.Array(nonNil(set)), pq.Array(nonNil(update.Add)), pq.Array(nonNil(update.Remove))))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("asset not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tags: %w", err)
+	}
+
+	return asset, nil
+}
 
-		versions = append(versions, version)
+// UpdateAssetMetadata merges set into the metadata of a single asset version and drops the keys in remove.
+// schemaVersion records the project schema the result was validated against.
+func (r *AssetRepository) UpdateAssetMetadata(assetID string, set map[string]string, remove []string, schemaVersion *int) (*Asset, error) {
+	if set == nil {
+		set = map[string]string{}
+	}
+	setJSON, err := json.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	query := `
+		UPDATE assets
+		SET metadata = (metadata - $3::text[]) || $2::jsonb,
+			metadata_schema_version = $4,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + assetColumns
+
+	asset, err := scanAsset(r.db.QueryRow(query, assetID, setJSON, pq.Array(nonNil(remove)), schemaVersion))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("asset not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update metadata: %w", err)
 	}
 
-	return versions, nil
+	return asset, nil
+}
+
+// GetAssetsBehindSchema returns up to limit assets of a project, in id order after afterID,
+// whose metadata was not validated against the given schema version or newer
+func (r *AssetRepository) GetAssetsBehindSchema(projectID string, version int, afterID string, limit int) ([]Asset, error) {
+	var after any
+	if afterID != "" {
+		after = afterID
+	}
+
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE project_id = $1
+			AND (metadata_schema_version IS NULL OR metadata_schema_version < $2)
+			AND ($3::uuid IS NULL OR id > $3::uuid)
+		ORDER BY id
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(query, projectID, version, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assets behind schema: %w", err)
+	}
+	defer rows.Close()
+
+	assets := make([]Asset, 0)
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan asset: %w", err)
+		}
+		assets = append(assets, *asset)
+	}
+
+	return assets, nil
+}
+
+// ReplaceAssetMetadata overwrites the metadata of an asset version and records the schema version it conforms to
+func (r *AssetRepository) ReplaceAssetMetadata(assetID string, metadata map[string]string, schemaVersion int) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	query := `UPDATE assets SET metadata = $2, metadata_schema_version = $3, updated_at = NOW() WHERE id = $1`
+	if _, err := r.db.Exec(query, assetID, metadataJSON, schemaVersion); err != nil {
+		return fmt.Errorf("failed to replace metadata: %w", err)
+	}
+
+	return nil
+}
+
+// FilterAssetIDsInProject returns the ids among assetIDs that belong to the project
+func (r *AssetRepository) FilterAssetIDsInProject(projectID string, assetIDs []string) ([]string, error) {
+	query := `SELECT id FROM assets WHERE project_id = $1 AND id = ANY($2::uuid[])`
+
+	rows, err := r.db.Query(query, projectID, pq.Array(assetIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check assets: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0, len(assetIDs))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan asset id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
 }
 
 func (r *AssetRepository) GetAllS3KeysByClientID(clientID string) ([]string, error) {
@@ -368,3 +769,109 @@ func (r *AssetRepository) GetAllS3KeysByClientID(clientID string) ([]string, err
 
 	return keys, nil
 }
+
+// AssetSearch describes a ranked search across the projects a client can access
+type AssetSearch struct {
+	Query        string
+	ProjectID    string // optional, must be one the client can access
+	FolderPrefix string
+	Filter       AssetFilter // mime, extension, size and date bounds
+	Limit        int
+	Offset       int
+}
+
+// AssetSearchResult is a matching asset with its relevance score
+type AssetSearchResult struct {
+	Asset
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// rankedRow scans the asset columns followed by the rank column
+type rankedRow struct {
+	rows *sql.Rows
+	rank *float64
+}
+
+func (r rankedRow) Scan(dest ...any) error {
+	return r.rows.Scan(append(dest, r.rank)...)
+}
+
+// SearchAssets ranks the latest assets of every project the client owns or is a member of,
+// leaving out projects that require two-factor authentication the client has not enabled.
+// Filenames match on full-text terms, trigram similarity or substring; results are ordered by rank, then newest first.
+func (r *AssetRepository) SearchAssets(clientID string, search AssetSearch) ([]AssetSearchResult, bool, error) {
+	conditions := []string{
+		"is_latest = TRUE",
+		`project_id IN (
+			SELECT p.id FROM projects p
+			JOIN clients c ON c.id = $1
+			WHERE (p.client_id = $1 OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.client_id = $1))
+			  AND NOT (p.require_mfa AND c.mfa_enabled_at IS NULL)
+		)`,
+	}
+	args := []any{clientID}
+
+	rank := "0::real"
+	if search.Query != "" {
+		args = append(args, search.Query)
+		queryArg := len(args)
+		args = append(args, "%"+escapeLike(search.Query)+"%")
+		likeArg := len(args)
+
+		conditions = append(conditions, fmt.Sprintf(
+			"(search_vector @@ websearch_to_tsquery('simple', $%d) OR original_filename %% $%d OR original_filename ILIKE $%d OR folder_path ILIKE $%d)",
+			queryArg, queryArg, likeArg, likeArg,
+		))
+		rank = fmt.Sprintf("ts_rank(search_vector, websearch_to_tsquery('simple', $%d)) + similarity(original_filename, $%d)", queryArg, queryArg)
+	}
+
+	if search.ProjectID != "" {
+		args = append(args, search.ProjectID)
+		conditions = append(conditions, fmt.Sprintf("project_id = $%d", len(args)))
+	}
+
+	if search.FolderPrefix != "" {
+		args = append(args, escapeLike(search.FolderPrefix)+"%")
+		conditions = append(conditions, fmt.Sprintf("folder_path LIKE $%d", len(args)))
+	}
+
+	conditions, args = buildAssetFilter(search.Filter, conditions, args)
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	args = append(args, limit+1, search.Offset)
+
+	query := `
+		SELECT ` + assetColumns + `, ` + rank + ` AS rank
+		FROM assets
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY rank DESC, created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search assets: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]AssetSearchResult, 0)
+	for rows.Next() {
+		var score float64
+		asset, err := scanAsset(rankedRow{rows: rows, rank: &score})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		results = append(results, AssetSearchResult{Asset: *asset, Rank: score})
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	return results, hasMore, nil
+}
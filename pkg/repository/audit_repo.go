@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-service/pkg/models"
+	"fmt"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Record appends an entry to the audit trail
+func (r *AuditRepository) Record(entry *models.AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_client_id, action, resource, details, ip_address, user_agent, status_code)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = r.db.Exec(query, entry.ActorClientID, entry.Action, entry.Resource, details, entry.IPAddress, entry.UserAgent, entry.StatusCode)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuditEntries returns audit entries, newest first, optionally filtered by action prefix
+func (r *AuditRepository) ListAuditEntries(actionPrefix string, limit, offset int) ([]models.AuditEntry, error) {
+	query := `
+		SELECT id, actor_client_id, action, resource, details, ip_address, user_agent, status_code, created_at
+		FROM audit_log
+		WHERE $1 = '' OR action LIKE $1 || '%'
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(query, actionPrefix, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var entry models.AuditEntry
+		var actorID, ipAddress, userAgent sql.NullString
+		var details []byte
+
+		if err := rows.Scan(
+			&entry.ID,
+			&actorID,
+			&entry.Action,
+			&entry.Resource,
+			&details,
+			&ipAddress,
+			&userAgent,
+			&entry.StatusCode,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+
+		if actorID.Valid {
+			entry.ActorClientID = &actorID.String
+		}
+		entry.IPAddress = ipAddress.String
+		entry.UserAgent = userAgent.String
+		json.Unmarshal(details, &entry.Details)
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
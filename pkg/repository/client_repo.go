@@ -15,7 +15,7 @@ func NewClientRepository(db *sql.DB) *ClientRepository {
 	return &ClientRepository{db: db}
 }
 
-func assignClientLifecycleFields(client *models.Client, pausedAt sql.NullTime, scheduledDeletionAt sql.NullTime) {
+func assignClientLifecycleFields(client *models.Client, pausedAt sql.NullTime, scheduledDeletionAt sql.NullTime, emailVerifiedAt sql.NullTime) {
 	if pausedAt.Valid {
 		t := pausedAt.Time
 		client.PausedAt = &t
@@ -24,6 +24,10 @@ func assignClientLifecycleFields(client *models.Client, pausedAt sql.NullTime, s
 		t := scheduledDeletionAt.Time
 		client.ScheduledDeletionAt = &t
 	}
+	if emailVerifiedAt.Valid {
+		t := emailVerifiedAt.Time
+		client.EmailVerifiedAt = &t
+	}
 }
 
 // CreateClient creates a new client
@@ -31,12 +35,13 @@ func (r *ClientRepository) CreateClient(name, email, passwordHash string) (*mode
 	query := `
 		INSERT INTO clients (name, email, password_hash)
 		VALUES ($1, $2, $3)
-		RETURNING id, name, email, status, paused_at, scheduled_deletion_at, created_at, updated_at
+		RETURNING id, name, email, status, paused_at, scheduled_deletion_at, email_verified_at, created_at, updated_at
 	`
 
 	var client models.Client
 	var pausedAt sql.NullTime
 	var scheduledDeletionAt sql.NullTime
+	var emailVerifiedAt sql.NullTime
 	err := r.db.QueryRow(query, name, email, passwordHash).Scan(
 		&client.ID,
 		&client.Name,
@@ -44,6 +49,7 @@ func (r *ClientRepository) CreateClient(name, email, passwordHash string) (*mode
 		&client.Status,
 		&pausedAt,
 		&scheduledDeletionAt,
+		&emailVerifiedAt,
 		&client.CreatedAt,
 		&client.UpdatedAt,
 	)
@@ -51,7 +57,7 @@ func (r *ClientRepository) CreateClient(name, email, passwordHash string) (*mode
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
-	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt)
+	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt, emailVerifiedAt)
 
 	return &client, nil
 }
@@ -59,7 +65,7 @@ func (r *ClientRepository) CreateClient(name, email, passwordHash string) (*mode
 // GetClientByEmail retrieves client by email
 func (r *ClientRepository) GetClientByEmail(email string) (*models.Client, error) {
 	query := `
-		SELECT id, name, email, password_hash, status, paused_at, scheduled_deletion_at, created_at, updated_at
+		SELECT id, name, email, password_hash, status, paused_at, scheduled_deletion_at, email_verified_at, created_at, updated_at
 		FROM clients
 		WHERE email = $1
 	`
@@ -67,6 +73,7 @@ func (r *ClientRepository) GetClientByEmail(email string) (*models.Client, error
 	var client models.Client
 	var pausedAt sql.NullTime
 	var scheduledDeletionAt sql.NullTime
+	var emailVerifiedAt sql.NullTime
 	err := r.db.QueryRow(query, email).Scan(
 		&client.ID,
 		&client.Name,
@@ -75,6 +82,7 @@ func (r *ClientRepository) GetClientByEmail(email string) (*models.Client, error
 		&client.Status,
 		&pausedAt,
 		&scheduledDeletionAt,
+		&emailVerifiedAt,
 		&client.CreatedAt,
 		&client.UpdatedAt,
 	)
@@ -85,7 +93,7 @@ func (r *ClientRepository) GetClientByEmail(email string) (*models.Client, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
-	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt)
+	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt, emailVerifiedAt)
 
 	return &client, nil
 }
@@ -93,7 +101,7 @@ func (r *ClientRepository) GetClientByEmail(email string) (*models.Client, error
 // GetClientByID retrieves client by ID
 func (r *ClientRepository) GetClientByID(id string) (*models.Client, error) {
 	query := `
-		SELECT id, name, email, status, paused_at, scheduled_deletion_at, created_at, updated_at
+		SELECT id, name, email, status, paused_at, scheduled_deletion_at, email_verified_at, created_at, updated_at
 		FROM clients
 		WHERE id = $1
 	`
@@ -101,6 +109,7 @@ func (r *ClientRepository) GetClientByID(id string) (*models.Client, error) {
 	var client models.Client
 	var pausedAt sql.NullTime
 	var scheduledDeletionAt sql.NullTime
+	var emailVerifiedAt sql.NullTime
 	err := r.db.QueryRow(query, id).Scan(
 		&client.ID,
 		&client.Name,
@@ -108,6 +117,7 @@ func (r *ClientRepository) GetClientByID(id string) (*models.Client, error) {
 		&client.Status,
 		&pausedAt,
 		&scheduledDeletionAt,
+		&emailVerifiedAt,
 		&client.CreatedAt,
 		&client.UpdatedAt,
 	)
@@ -118,25 +128,32 @@ func (r *ClientRepository) GetClientByID(id string) (*models.Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
-	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt)
+	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt, emailVerifiedAt)
 
 	return &client, nil
 }
 
 // UpdateClientPassword updates password hash for a client.
+// Outstanding password reset tokens of the client stop working.
 func (r *ClientRepository) UpdateClientPassword(clientID, passwordHash string) error {
 	query := `
-		UPDATE clients
-		SET password_hash = $1, updated_at = NOW()
-		WHERE id = $2
+		WITH updated AS (
+			UPDATE clients
+			SET password_hash = $1, updated_at = NOW()
+			WHERE id = $2
+			RETURNING id
+		), invalidated AS (
+			UPDATE password_reset_tokens
+			SET used_at = NOW()
+			WHERE client_id IN (SELECT id FROM updated) AND used_at IS NULL
+		)
+		SELECT COUNT(*) FROM updated
 	`
 
-	result, err := r.db.Exec(query, passwordHash, clientID)
-	if err != nil {
+	var rows int
+	if err := r.db.QueryRow(query, passwordHash, clientID).Scan(&rows); err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
-
-	rows, _ := result.RowsAffected()
 	if rows == 0 {
 		return fmt.Errorf("client not found")
 	}
@@ -163,6 +180,70 @@ func (r *ClientRepository) IsClientActive(clientID string) (bool, error) {
 	return status == "active", nil
 }
 
+// CheckClientSession reports whether the client is active and whether the session an access token
+// belongs to is still live, that is neither signed out nor revoked
+func (r *ClientRepository) CheckClientSession(clientID, sessionID string) (active bool, sessionLive bool, err error) {
+	query := `
+		SELECT c.status, EXISTS (
+			SELECT 1 FROM sessions s
+			WHERE s.id = $2 AND s.client_id = c.id AND ` + liveSessionCondition + `
+		)
+		FROM clients c
+		WHERE c.id = $1
+	`
+
+	var status string
+	err = r.db.QueryRow(query, clientID, sessionID).Scan(&status, &sessionLive)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get client session status: %w", err)
+	}
+
+	return status == "active", sessionLive, nil
+}
+
+// IsOperator reports whether the client holds the platform operator role.
+func (r *ClientRepository) IsOperator(clientID string) (bool, error) {
+	query := `
+		SELECT platform_role
+		FROM clients
+		WHERE id = $1
+	`
+
+	var role string
+	err := r.db.QueryRow(query, clientID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get platform role: %w", err)
+	}
+
+	return role == "operator", nil
+}
+
+// IsEmailVerified reports whether the client has confirmed its email address
+func (r *ClientRepository) IsEmailVerified(clientID string) (bool, error) {
+	query := `
+		SELECT email_verified_at IS NOT NULL
+		FROM clients
+		WHERE id = $1
+	`
+
+	var verified bool
+	err := r.db.QueryRow(query, clientID).Scan(&verified)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get email verification: %w", err)
+	}
+
+	return verified, nil
+}
+
 func (r *ClientRepository) PauseClientForDeletion(clientID string, scheduledDeletionAt time.Time) error {
 	query := `
 		UPDATE clients
@@ -188,7 +269,7 @@ func (r *ClientRepository) PauseClientForDeletion(clientID string, scheduledDele
 
 func (r *ClientRepository) GetClientsDueForDeletion(now time.Time) ([]models.Client, error) {
 	query := `
-		SELECT id, name, email, status, paused_at, scheduled_deletion_at, created_at, updated_at
+		SELECT id, name, email, status, paused_at, scheduled_deletion_at, email_verified_at, created_at, updated_at
 		FROM clients
 		WHERE status = 'paused'
 			AND scheduled_deletion_at IS NOT NULL
@@ -207,6 +288,7 @@ func (r *ClientRepository) GetClientsDueForDeletion(now time.Time) ([]models.Cli
 		var client models.Client
 		var pausedAt sql.NullTime
 		var scheduledDeletionAt sql.NullTime
+		var emailVerifiedAt sql.NullTime
 		if err := rows.Scan(
 			&client.ID,
 			&client.Name,
@@ -214,12 +296,13 @@ func (r *ClientRepository) GetClientsDueForDeletion(now time.Time) ([]models.Cli
 			&client.Status,
 			&pausedAt,
 			&scheduledDeletionAt,
+			&emailVerifiedAt,
 			&client.CreatedAt,
 			&client.UpdatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan client due for deletion: %w", err)
 		}
-		assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt)
+		assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt, emailVerifiedAt)
 		clients = append(clients, client)
 	}
 
@@ -244,7 +327,7 @@ func (r *ClientRepository) DeleteClient(clientID string) error {
 
 func (r *ClientRepository) ListClients(limit int, offset int, q string) ([]models.Client, error) {
 	query := `
-		SELECT id, name, email, status, paused_at, scheduled_deletion_at, created_at, updated_at
+		SELECT id, name, email, status, paused_at, scheduled_deletion_at, email_verified_at, created_at, updated_at
 		FROM clients
 		WHERE status = 'active'
 			AND (
@@ -267,6 +350,7 @@ func (r *ClientRepository) ListClients(limit int, offset int, q string) ([]model
 		var client models.Client
 		var pausedAt sql.NullTime
 		var scheduledDeletionAt sql.NullTime
+		var emailVerifiedAt sql.NullTime
 
 		if err := rows.Scan(
 			&client.ID,
@@ -275,38 +359,41 @@ func (r *ClientRepository) ListClients(limit int, offset int, q string) ([]model
 			&client.Status,
 			&pausedAt,
 			&scheduledDeletionAt,
+			&emailVerifiedAt,
 			&client.CreatedAt,
 			&client.UpdatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan client: %w", err)
 		}
-		assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt)
+		assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt, emailVerifiedAt)
 		clients = append(clients, client)
 	}
 
 	return clients, nil
 }
 
-func (r *ClientRepository) UpdateClientProfile(clientID string, name string, email string) (*models.Client, error) {
+// UpdateClientProfile renames a client; email changes go through ConfirmEmailVerification
+func (r *ClientRepository) UpdateClientProfile(clientID string, name string) (*models.Client, error) {
 	query := `
 		UPDATE clients
 		SET name = $1,
-			email = $2,
 			updated_at = NOW()
-		WHERE id = $3
-		RETURNING id, name, email, status, paused_at, scheduled_deletion_at, created_at, updated_at
+		WHERE id = $2
+		RETURNING id, name, email, status, paused_at, scheduled_deletion_at, email_verified_at, created_at, updated_at
 	`
 
 	var client models.Client
 	var pausedAt sql.NullTime
 	var scheduledDeletionAt sql.NullTime
-	if err := r.db.QueryRow(query, name, email, clientID).Scan(
+	var emailVerifiedAt sql.NullTime
+	if err := r.db.QueryRow(query, name, clientID).Scan(
 		&client.ID,
 		&client.Name,
 		&client.Email,
 		&client.Status,
 		&pausedAt,
 		&scheduledDeletionAt,
+		&emailVerifiedAt,
 		&client.CreatedAt,
 		&client.UpdatedAt,
 	); err != nil {
@@ -315,7 +402,7 @@ func (r *ClientRepository) UpdateClientProfile(clientID string, name string, ema
 		}
 		return nil, fmt.Errorf("failed to update client profile: %w", err)
 	}
-	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt)
+	assignClientLifecycleFields(&client, pausedAt, scheduledDeletionAt, emailVerifiedAt)
 
 	return &client, nil
 }
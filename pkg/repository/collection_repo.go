@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"file-service/pkg/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type CollectionRepository struct {
+	db *sql.DB
+}
+
+func NewCollectionRepository(db *sql.DB) *CollectionRepository {
+	return &CollectionRepository{db: db}
+}
+
+// CollectionAsset is the latest version of a collection member with its place in the collection
+type CollectionAsset struct {
+	Asset
+	// MemberAssetID is the version that was added; Asset follows its latest version
+	MemberAssetID string    `json:"member_asset_id"`
+	Position      int       `json:"position"`
+	AddedAt       time.Time `json:"added_at"`
+}
+
+const collectionCursorSort = "position:ASC"
+
+// ErrCollectionOrderMismatch is returned when a new order does not list exactly the current members
+var ErrCollectionOrderMismatch = errors.New("asset_ids must list every asset in the collection exactly once")
+
+const collectionColumns = `c.id, c.project_id, c.name, c.description, c.cover_asset_id, c.created_by,
+	(SELECT COUNT(*) FROM collection_assets ca WHERE ca.collection_id = c.id),
+	c.created_at, c.updated_at`
+
+func scanCollection(row rowScanner) (*models.Collection, error) {
+	var collection models.Collection
+	var description, coverAssetID, createdBy sql.NullString
+
+	err := row.Scan(
+		&collection.ID,
+		&collection.ProjectID,
+		&collection.Name,
+		&description,
+		&coverAssetID,
+		&createdBy,
+		&collection.AssetCount,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	collection.Description = description.String
+	if coverAssetID.Valid {
+		collection.CoverAssetID = &coverAssetID.String
+	}
+	if createdBy.Valid {
+		collection.CreatedBy = &createdBy.String
+	}
+
+	return &collection, nil
+}
+
+// CreateCollection creates an empty collection in a project
+func (r *CollectionRepository) CreateCollection(projectID, createdBy, name, description string, coverAssetID *string) (*models.Collection, error) {
+	var id string
+	query := `
+		INSERT INTO collections (project_id, name, description, cover_asset_id, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	if err := r.db.QueryRow(query, projectID, name, description, coverAssetID, createdBy).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	return r.GetCollection(id)
+}
+
+// GetCollection retrieves a collection by ID
+func (r *CollectionRepository) GetCollection(collectionID string) (*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections c WHERE c.id = $1`
+
+	collection, err := scanCollection(r.db.QueryRow(query, collectionID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("collection not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	return collection, nil
+}
+
+// ListCollections retrieves one page of the collections of a project, newest first
+func (r *CollectionRepository) ListCollections(projectID string, page PageRequest) ([]models.Collection, *PageInfo, error) {
+	if err := page.checkCursor(newestFirstCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"project_id = $1"}
+	args := []any{projectID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "collections", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count collections: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "created_at", "timestamp", "DESC")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections c
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := make([]models.Collection, 0)
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		collections = append(collections, *collection)
+	}
+
+	if len(collections) > limit {
+		collections = collections[:limit]
+		last := collections[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: newestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
+
+	return collections, info, nil
+}
+
+// UpdateCollection changes the name, description or cover of a collection
+func (r *CollectionRepository) UpdateCollection(collectionID string, update models.CollectionUpdate) (*models.Collection, error) {
+	var cover *string
+	if update.CoverAssetID != nil && *update.CoverAssetID != "" {
+		cover = update.CoverAssetID
+	}
+
+	query := `
+		UPDATE collections
+		SET name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			cover_asset_id = CASE WHEN $4::boolean THEN $5::uuid ELSE cover_asset_id END,
+			updated_at = NOW()
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(query, collectionID, update.Name, update.Description, update.CoverAssetID != nil, cover)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update collection: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("collection not found")
+	}
+
+	return r.GetCollection(collectionID)
+}
+
+// DeleteCollection removes a collection; its assets are untouched
+func (r *CollectionRepository) DeleteCollection(collectionID string) error {
+	result, err := r.db.Exec(`DELETE FROM collections WHERE id = $1`, collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("collection not found")
+	}
+
+	return nil
+}
+
+// AddCollectionAssets inserts assets at position (or at the end when nil), shifting later members down.
+// Assets already in the collection are skipped; the number added is returned.
+func (r *CollectionRepository) AddCollectionAssets(collectionID string, assetIDs []string, position *int, addedBy string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize position changes per collection
+	if _, err := tx.Exec(`SELECT id FROM collections WHERE id = $1 FOR UPDATE`, collectionID); err != nil {
+		return 0, fmt.Errorf("failed to lock collection: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT asset_id FROM collection_assets WHERE collection_id = $1 AND asset_id = ANY($2::uuid[])`, collectionID, pq.Array(assetIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to check collection members: %w", err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan collection member: %w", err)
+		}
+		existing[id] = true
+	}
+	rows.Close()
+
+	toAdd := make([]string, 0, len(assetIDs))
+	for _, id := range assetIDs {
+		if !existing[id] {
+			existing[id] = true
+			toAdd = append(toAdd, id)
+		}
+	}
+	if len(toAdd) == 0 {
+		return 0, nil
+	}
+
+	var start int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM collection_assets WHERE collection_id = $1`, collectionID).Scan(&start); err != nil {
+		return 0, fmt.Errorf("failed to get collection size: %w", err)
+	}
+
+	if position != nil && *position < start {
+		start = *position
+		if start < 0 {
+			start = 0
+		}
+		_, err := tx.Exec(`UPDATE collection_assets SET position = position + $3 WHERE collection_id = $1 AND position >= $2`, collectionID, start, len(toAdd))
+		if err != nil {
+			return 0, fmt.Errorf("failed to shift collection members: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO collection_assets (collection_id, asset_id, position, added_by)
+		SELECT $1, asset_id, $3 + idx - 1, $4
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(asset_id, idx)
+	`
+	if _, err := tx.Exec(query, collectionID, pq.Array(toAdd), start, addedBy); err != nil {
+		return 0, fmt.Errorf("failed to add collection members: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE collections SET updated_at = NOW() WHERE id = $1`, collectionID); err != nil {
+		return 0, fmt.Errorf("failed to touch collection: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(toAdd), nil
+}
+
+// RemoveCollectionAsset removes an asset from a collection
+func (r *CollectionRepository) RemoveCollectionAsset(collectionID, assetID string) error {
+	result, err := r.db.Exec(`DELETE FROM collection_assets WHERE collection_id = $1 AND asset_id = $2`, collectionID, assetID)
+	if err != nil {
+		return fmt.Errorf("failed to remove collection member: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("asset not in collection")
+	}
+
+	r.db.Exec(`UPDATE collections SET updated_at = NOW() WHERE id = $1`, collectionID)
+	return nil
+}
+
+// ReorderCollectionAssets sets the order of a collection; assetIDs must list every member exactly once
+func (r *CollectionRepository) ReorderCollectionAssets(collectionID string, assetIDs []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM collections WHERE id = $1 FOR UPDATE`, collectionID); err != nil {
+		return fmt.Errorf("failed to lock collection: %w", err)
+	}
+
+	var members, matched int
+	query := `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE asset_id = ANY($2::uuid[]))
+		FROM collection_assets
+		WHERE collection_id = $1
+	`
+	if err := tx.QueryRow(query, collectionID, pq.Array(assetIDs)).Scan(&members, &matched); err != nil {
+		return fmt.Errorf("failed to check collection members: %w", err)
+	}
+	if members != len(assetIDs) || matched != len(assetIDs) {
+		return ErrCollectionOrderMismatch
+	}
+
+	query = `
+		UPDATE collection_assets ca
+		SET position = o.idx - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(asset_id, idx)
+		WHERE ca.collection_id = $1 AND ca.asset_id = o.asset_id
+	`
+	if _, err := tx.Exec(query, collectionID, pq.Array(assetIDs)); err != nil {
+		return fmt.Errorf("failed to reorder collection: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE collections SET updated_at = NOW() WHERE id = $1`, collectionID); err != nil {
+		return fmt.Errorf("failed to touch collection: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetCollectionAssets retrieves one page of a collection in order, resolving each member to the latest version of its asset.
+// Assets in folders denied to readerID are left out.
+func (r *CollectionRepository) GetCollectionAssets(collectionID, readerID string, page PageRequest) ([]CollectionAsset, *PageInfo, error) {
+	if err := page.checkCursor(collectionCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"ca.collection_id = $1", folderReadableConditionOn("a", 2)}
+	args := []any{collectionID, readerID}
+
+	from := `collection_assets ca
+		JOIN assets m ON m.id = ca.asset_id
+		JOIN assets a ON a.is_latest = TRUE
+			AND (a.id = COALESCE(m.parent_asset_id, m.id) OR a.parent_asset_id = COALESCE(m.parent_asset_id, m.id))`
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, from, conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count collection members: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "ca.position", "integer", "ASC")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
+	query := `
+		SELECT ` + qualifiedAssetColumns("a") + `, ca.asset_id, ca.position, ca.added_at
+		FROM ` + from + `
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ca.position
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get collection assets: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]CollectionAsset, 0)
+	for rows.Next() {
+		var member CollectionAsset
+		asset, err := scanAsset(collectionRow{rows: rows, member: &member})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan collection asset: %w", err)
+		}
+		member.Asset = *asset
+		members = append(members, member)
+	}
+
+	if len(members) > limit {
+		members = members[:limit]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: collectionCursorSort, Value: strconv.Itoa(members[limit-1].Position)})
+	}
+
+	return members, info, nil
+}
+
+// collectionRow scans the asset columns followed by the membership columns
+type collectionRow struct {
+	rows   *sql.Rows
+	member *CollectionAsset
+}
+
+func (r collectionRow) Scan(dest ...any) error {
+	return r.rows.Scan(append(dest, &r.member.MemberAssetID, &r.member.Position, &r.member.AddedAt)...)
+}
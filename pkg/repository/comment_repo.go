@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"database/sql"
+	"file-service/pkg/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type CommentRepository struct {
+	db *sql.DB
+}
+
+func NewCommentRepository(db *sql.DB) *CommentRepository {
+	return &CommentRepository{db: db}
+}
+
+const commentColumns = `c.id, c.asset_id, c.root_asset_id, a.version, c.parent_id, c.author_id, COALESCE(cl.name, ''), c.body,
+	c.region_x, c.region_y, c.region_w, c.region_h, c.timestamp_start, c.timestamp_end, c.mentions,
+	c.created_at, c.updated_at, c.edited_at`
+
+const commentFrom = `
+	FROM asset_comments c
+	JOIN assets a ON a.id = c.asset_id
+	LEFT JOIN clients cl ON cl.id = c.author_id`
+
+func scanComment(row rowScanner) (*models.Comment, error) {
+	var comment models.Comment
+	var parentID, authorID sql.NullString
+	var x, y, w, h, start, end sql.NullFloat64
+	var mentions pq.StringArray
+	var editedAt sql.NullTime
+
+	err := row.Scan(
+		&comment.ID,
+		&comment.AssetID,
+		&comment.RootAssetID,
+		&comment.AssetVersion,
+		&parentID,
+		&authorID,
+		&comment.AuthorName,
+		&comment.Body,
+		&x, &y, &w, &h,
+		&start,
+		&end,
+		&mentions,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&editedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		comment.ParentID = &parentID.String
+	}
+	if authorID.Valid {
+		comment.AuthorID = &authorID.String
+	}
+	if x.Valid && y.Valid && w.Valid && h.Valid {
+		comment.Region = &models.CommentRegion{X: x.Float64, Y: y.Float64, Width: w.Float64, Height: h.Float64}
+	}
+	if start.Valid {
+		comment.TimestampStart = &start.Float64
+	}
+	if end.Valid {
+		comment.TimestampEnd = &end.Float64
+	}
+	comment.Mentions = nonNil(mentions)
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+
+	return &comment, nil
+}
+
+// CreateComment stores a comment on an asset version; RootAssetID must be the root of its version chain
+func (r *CommentRepository) CreateComment(comment models.Comment) (*models.Comment, error) {
+	var x, y, w, h *float64
+	if comment.Region != nil {
+		x, y, w, h = &comment.Region.X, &comment.Region.Y, &comment.Region.Width, &comment.Region.Height
+	}
+
+	var id string
+	query := `
+		INSERT INTO asset_comments (asset_id, root_asset_id, parent_id, author_id, body,
+			region_x, region_y, region_w, region_h, timestamp_start, timestamp_end, mentions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`
+	err := r.db.QueryRow(query,
+		comment.AssetID,
+		comment.RootAssetID,
+		comment.ParentID,
+		comment.AuthorID,
+		comment.Body,
+		x, y, w, h,
+		comment.TimestampStart,
+		comment.TimestampEnd,
+		pq.Array(nonNil(comment.Mentions)),
+	).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	return r.GetComment(id)
+}
+
+// GetComment retrieves a comment by ID
+func (r *CommentRepository) GetComment(commentID string) (*models.Comment, error) {
+	query := `SELECT ` + commentColumns + commentFrom + ` WHERE c.id = $1`
+
+	comment, err := scanComment(r.db.QueryRow(query, commentID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("comment not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// ListComments retrieves one page of the threads on a version chain, oldest first, each with all of its replies
+func (r *CommentRepository) ListComments(rootAssetID string, page PageRequest) ([]models.Comment, *PageInfo, error) {
+	if err := page.checkCursor(oldestFirstCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"c.root_asset_id = $1", "c.parent_id IS NULL"}
+	args := []any{rootAssetID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "asset_comments c", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count comments: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeysetOn(conditions, args, page.Cursor, "c.created_at", "timestamp", "ASC", "c.id")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
+	query := `SELECT ` + commentColumns + commentFrom + `
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT $` + strconv.Itoa(len(args))
+
+	threads, err := r.queryComments(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(threads) > limit {
+		threads = threads[:limit]
+		last := threads[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: oldestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
+
+	if len(threads) == 0 {
+		return threads, info, nil
+	}
+
+	threadIDs := make([]string, len(threads))
+	index := make(map[string]int, len(threads))
+	for i, thread := range threads {
+		threadIDs[i] = thread.ID
+		index[thread.ID] = i
+	}
+
+	query = `SELECT ` + commentColumns + commentFrom + `
+		WHERE c.parent_id = ANY($1::uuid[])
+		ORDER BY c.created_at ASC, c.id ASC`
+
+	replies, err := r.queryComments(query, pq.Array(threadIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, reply := range replies {
+		i := index[*reply.ParentID]
+		threads[i].Replies = append(threads[i].Replies, reply)
+	}
+
+	return threads, info, nil
+}
+
+func (r *CommentRepository) queryComments(query string, args ...any) ([]models.Comment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments := make([]models.Comment, 0)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, *comment)
+	}
+
+	return comments, nil
+}
+
+// UpdateCommentBody replaces the text and mentions of a comment
+func (r *CommentRepository) UpdateCommentBody(commentID, body string, mentions []string) (*models.Comment, error) {
+	query := `
+		UPDATE asset_comments
+		SET body = $2, mentions = $3, edited_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(query, commentID, body, pq.Array(nonNil(mentions)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("comment not found")
+	}
+
+	return r.GetComment(commentID)
+}
+
+// DeleteComment removes a comment and, for a top-level comment, its replies
+func (r *CommentRepository) DeleteComment(commentID string) error {
+	result, err := r.db.Exec(`DELETE FROM asset_comments WHERE id = $1`, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("comment not found")
+	}
+
+	return nil
+}
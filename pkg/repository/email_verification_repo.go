@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Purposes of email verification tokens
+const (
+	EmailVerificationSignup = "signup"
+	EmailVerificationChange = "email_change"
+)
+
+var (
+	// ErrVerificationTokenInvalid is returned for verification tokens that are unknown, used, expired or superseded
+	ErrVerificationTokenInvalid = errors.New("invalid verification token")
+	// ErrEmailTaken is returned when a confirmed email change targets an address another client registered meanwhile
+	ErrEmailTaken = errors.New("email already exists")
+)
+
+// EmailVerification is a confirmed verification token: the address it confirmed and what for
+type EmailVerification struct {
+	ClientID string
+	Email    string
+	Purpose  string
+}
+
+// EmailVerificationRepository stores hashes of email verification tokens
+type EmailVerificationRepository struct {
+	db *sql.DB
+}
+
+func NewEmailVerificationRepository(db *sql.DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{db: db}
+}
+
+// CreateVerificationToken returns a new token confirming email for the purpose.
+// Earlier unused tokens of the client for the same purpose stop working.
+func (r *EmailVerificationRepository) CreateVerificationToken(clientID, email, purpose string, ttl time.Duration) (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	token := hex.EncodeToString(randomBytes)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to create verification token: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE email_verification_tokens SET used_at = NOW() WHERE client_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err := tx.Exec(query, clientID, purpose); err != nil {
+		return "", fmt.Errorf("failed to supersede verification tokens: %w", err)
+	}
+
+	query = `
+		INSERT INTO email_verification_tokens (client_id, email, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5))
+	`
+	if _, err := tx.Exec(query, clientID, email, purpose, hashToken(token), ttl.Seconds()); err != nil {
+		return "", fmt.Errorf("failed to create verification token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to create verification token: %w", err)
+	}
+
+	return token, nil
+}
+
+// VerificationSentWithin reports whether the client was sent a token for the purpose within the window
+func (r *EmailVerificationRepository) VerificationSentWithin(clientID, purpose string, window time.Duration) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM email_verification_tokens
+			WHERE client_id = $1 AND purpose = $2 AND created_at > NOW() - make_interval(secs => $3)
+		)
+	`
+
+	var sent bool
+	if err := r.db.QueryRow(query, clientID, purpose, window.Seconds()).Scan(&sent); err != nil {
+		return false, fmt.Errorf("failed to get verification tokens: %w", err)
+	}
+
+	return sent, nil
+}
+
+// ConfirmEmailVerification uses a token: a signup token marks the client's email verified,
+// an email change token replaces the client's email with the confirmed address.
+func (r *EmailVerificationRepository) ConfirmEmailVerification(token string) (*EmailVerification, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm email: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id string
+	var verification EmailVerification
+	query := `
+		SELECT id, client_id, email, purpose
+		FROM email_verification_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, hashToken(token)).Scan(&id, &verification.ClientID, &verification.Email, &verification.Purpose)
+	if err == sql.ErrNoRows {
+		return nil, ErrVerificationTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verification token: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE email_verification_tokens SET used_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to use verification token: %w", err)
+	}
+
+	var result sql.Result
+	switch verification.Purpose {
+	case EmailVerificationChange:
+		query = `
+			UPDATE clients
+			SET email = $2, email_verified_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+		`
+		result, err = tx.Exec(query, verification.ClientID, verification.Email)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrEmailTaken
+		}
+	default:
+		// The address must still be the client's; a confirmed email change voids older signup tokens
+		query = `
+			UPDATE clients
+			SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+			WHERE id = $1 AND email = $2
+		`
+		result, err = tx.Exec(query, verification.ClientID, verification.Email)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm email: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to confirm email: %w", err)
+	}
+
+	return &verification, nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"database/sql"
+	"file-service/pkg/models"
+	"fmt"
+)
+
+// FolderACLRepository stores per-member grants and denials on folder subtrees
+type FolderACLRepository struct {
+	db *sql.DB
+}
+
+func NewFolderACLRepository(db *sql.DB) *FolderACLRepository {
+	return &FolderACLRepository{db: db}
+}
+
+// folderReadableCondition is the SQL condition that keeps assets whose folder is readable by the client in argument clientArg.
+// The entry on the deepest folder containing the asset decides; project owners see everything.
+func folderReadableCondition(clientArg int) string {
+	return folderReadableConditionOn("assets", clientArg)
+}
+
+// folderReadableConditionOn is folderReadableCondition for queries that alias the assets table
+func folderReadableConditionOn(table string, clientArg int) string {
+	return fmt.Sprintf(`(COALESCE((
+			SELECT fa.role FROM folder_acls fa
+			WHERE fa.project_id = %[2]s.project_id AND fa.client_id = $%[1]d
+			  AND left(%[2]s.folder_path, length(fa.folder_path)) = fa.folder_path
+			ORDER BY length(fa.folder_path) DESC
+			LIMIT 1
+		), '') <> 'none'
+		OR EXISTS (
+			SELECT 1 FROM project_members pm
+			WHERE pm.project_id = %[2]s.project_id AND pm.client_id = $%[1]d AND pm.role = 'owner'
+		))`, clientArg, table)
+}
+
+// EffectiveRole returns the client's role on a folder: the project role overridden by the entry
+// on the deepest folder containing it. Owners keep their role; "" means the client is not a member.
+// Members without two-factor authentication get ErrMFARequired for projects that require it.
+func (r *FolderACLRepository) EffectiveRole(projectID, clientID, folderPath string) (string, error) {
+	query := `
+		SELECT pm.role, (
+			SELECT fa.role FROM folder_acls fa
+			WHERE fa.project_id = pm.project_id AND fa.client_id = pm.client_id
+			  AND left($3, length(fa.folder_path)) = fa.folder_path
+			ORDER BY length(fa.folder_path) DESC
+			LIMIT 1
+		), p.require_mfa AND c.mfa_enabled_at IS NULL
+		FROM project_members pm
+		JOIN projects p ON p.id = pm.project_id
+		JOIN clients c ON c.id = pm.client_id
+		WHERE pm.project_id = $1 AND pm.client_id = $2
+	`
+
+	var projectRole string
+	var folderRole sql.NullString
+	var needsMFA bool
+	err := r.db.QueryRow(query, projectID, clientID, folderPath).Scan(&projectRole, &folderRole, &needsMFA)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve folder access: %w", err)
+	}
+	if needsMFA {
+		return "", ErrMFARequired
+	}
+
+	if projectRole == "owner" || !folderRole.Valid {
+		return projectRole, nil
+	}
+	return folderRole.String, nil
+}
+
+// ListFolderACLs returns every entry of a project ordered by folder, then member
+func (r *FolderACLRepository) ListFolderACLs(projectID string) ([]models.FolderACL, error) {
+	query := `
+		SELECT fa.id, fa.project_id, fa.folder_path, fa.client_id, COALESCE(c.name, ''), fa.role, fa.created_by, fa.created_at, fa.updated_at
+		FROM folder_acls fa
+		LEFT JOIN clients c ON c.id = fa.client_id
+		WHERE fa.project_id = $1
+		ORDER BY fa.folder_path, c.name, fa.id
+	`
+
+	rows, err := r.db.Query(query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder acls: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.FolderACL, 0)
+	for rows.Next() {
+		entry, err := scanFolderACL(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// SetFolderACL creates or replaces the entry of a member on a folder
+func (r *FolderACLRepository) SetFolderACL(projectID, folderPath, clientID, role, createdBy string) (*models.FolderACL, error) {
+	query := `
+		WITH saved AS (
+			INSERT INTO folder_acls (project_id, folder_path, client_id, role, created_by)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (project_id, folder_path, client_id) DO UPDATE
+			SET role = EXCLUDED.role, created_by = EXCLUDED.created_by, updated_at = NOW()
+			RETURNING *
+		)
+		SELECT s.id, s.project_id, s.folder_path, s.client_id, COALESCE(c.name, ''), s.role, s.created_by, s.created_at, s.updated_at
+		FROM saved s
+		LEFT JOIN clients c ON c.id = s.client_id
+	`
+
+	entry, err := scanFolderACL(r.db.QueryRow(query, projectID, folderPath, clientID, role, createdBy))
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// DeleteFolderACL removes an entry so the folder inherits from its parent again
+func (r *FolderACLRepository) DeleteFolderACL(projectID, aclID string) error {
+	result, err := r.db.Exec(`DELETE FROM folder_acls WHERE id = $1 AND project_id = $2`, aclID, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to delete folder acl: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("folder acl not found")
+	}
+
+	return nil
+}
+
+func scanFolderACL(row rowScanner) (*models.FolderACL, error) {
+	var entry models.FolderACL
+	var createdBy sql.NullString
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.ProjectID,
+		&entry.FolderPath,
+		&entry.ClientID,
+		&entry.ClientName,
+		&entry.Role,
+		&createdBy,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan folder acl: %w", err)
+	}
+
+	if createdBy.Valid {
+		entry.CreatedBy = &createdBy.String
+	}
+
+	return &entry, nil
+}
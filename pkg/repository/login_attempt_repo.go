@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Scopes failed logins are counted in
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+// ErrUnlockTokenInvalid is returned for unlock tokens that are unknown, used or expired
+var ErrUnlockTokenInvalid = errors.New("invalid unlock token")
+
+// LoginAttemptRepository counts failed logins per account and per IP address and stores account unlock tokens
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// LoginBlockedFor returns how long logins for the subject are still refused, or zero
+func (r *LoginAttemptRepository) LoginBlockedFor(scope, subject string) (time.Duration, error) {
+	var seconds float64
+	query := `
+		SELECT COALESCE(EXTRACT(EPOCH FROM MAX(blocked_until) - NOW()), 0)
+		FROM login_failures
+		WHERE scope = $1 AND subject = $2 AND blocked_until > NOW()
+	`
+	if err := r.db.QueryRow(query, scope, subject).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("failed to check login failures: %w", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// RecordLoginFailure counts a failed login and returns the subject's consecutive failures.
+// The count starts over when the previous failure is older than resetAfter.
+func (r *LoginAttemptRepository) RecordLoginFailure(scope, subject string, resetAfter time.Duration) (int, error) {
+	var failures int
+	query := `
+		INSERT INTO login_failures (scope, subject, failures, last_failed_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, subject) DO UPDATE SET
+			failures = CASE
+				WHEN login_failures.last_failed_at < NOW() - make_interval(secs => $3) THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failed_at = NOW()
+		RETURNING failures
+	`
+	if err := r.db.QueryRow(query, scope, subject, resetAfter.Seconds()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// BlockLogin refuses logins for the subject for the given duration
+func (r *LoginAttemptRepository) BlockLogin(scope, subject string, duration time.Duration) error {
+	query := `
+		UPDATE login_failures
+		SET blocked_until = NOW() + make_interval(secs => $3)
+		WHERE scope = $1 AND subject = $2
+	`
+	if _, err := r.db.Exec(query, scope, subject, duration.Seconds()); err != nil {
+		return fmt.Errorf("failed to block login: %w", err)
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the subject's failed logins and lifts any block
+func (r *LoginAttemptRepository) ClearLoginFailures(scope, subject string) error {
+	if _, err := r.db.Exec(`DELETE FROM login_failures WHERE scope = $1 AND subject = $2`, scope, subject); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleLoginFailures removes counters that are no longer blocking and saw no failure within the
+// retention period, along with expired unlock tokens. It returns how many counters were removed.
+func (r *LoginAttemptRepository) DeleteStaleLoginFailures(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM login_failures
+		WHERE last_failed_at < NOW() - make_interval(secs => $1)
+		  AND (blocked_until IS NULL OR blocked_until < NOW())
+	`
+	result, err := r.db.Exec(query, retention.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete login failures: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete login failures: %w", err)
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM account_unlock_tokens WHERE expires_at < NOW()`); err != nil {
+		return deleted, fmt.Errorf("failed to delete unlock tokens: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// CreateUnlockToken returns a new unlock token for the client; earlier unused tokens stop working
+func (r *LoginAttemptRepository) CreateUnlockToken(clientID string, ttl time.Duration) (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate unlock token: %w", err)
+	}
+	token := hex.EncodeToString(randomBytes)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to create unlock token: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE account_unlock_tokens SET used_at = NOW() WHERE client_id = $1 AND used_at IS NULL`, clientID); err != nil {
+		return "", fmt.Errorf("failed to supersede unlock tokens: %w", err)
+	}
+
+	query := `
+		INSERT INTO account_unlock_tokens (client_id, token_hash, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))
+	`
+	if _, err := tx.Exec(query, clientID, hashToken(token), ttl.Seconds()); err != nil {
+		return "", fmt.Errorf("failed to create unlock token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to create unlock token: %w", err)
+	}
+
+	return token, nil
+}
+
+// UnlockAccount uses an unlock token to clear the failed logins of its client's account.
+// It returns the client id and email.
+func (r *LoginAttemptRepository) UnlockAccount(token string) (string, string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to unlock account: %w", err)
+	}
+	defer tx.Rollback()
+
+	var clientID, email string
+	query := `
+		UPDATE account_unlock_tokens t
+		SET used_at = NOW()
+		FROM clients c
+		WHERE c.id = t.client_id AND t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW()
+		RETURNING c.id, c.email
+	`
+	err = tx.QueryRow(query, hashToken(token)).Scan(&clientID, &email)
+	if err == sql.ErrNoRows {
+		return "", "", ErrUnlockTokenInvalid
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to use unlock token: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM login_failures WHERE scope = $1 AND subject = $2`, LoginScopeAccount, email); err != nil {
+		return "", "", fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("failed to unlock account: %w", err)
+	}
+
+	return clientID, email, nil
+}
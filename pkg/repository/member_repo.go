@@ -2,10 +2,19 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"file-service/pkg/models"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrMFARequired is returned when a member without two-factor authentication accesses a project that requires it
+var ErrMFARequired = errors.New("project requires two-factor authentication")
+
 type MemberRepository struct {
 	db *sql.DB
 }
@@ -45,22 +54,42 @@ func (r *MemberRepository) InviteMember(projectID, clientID, invitedBy, role str
 	return &member, nil
 }
 
-// GetProjectMembers retrieves all members of a project
-func (r *MemberRepository) GetProjectMembers(projectID string) ([]models.ProjectMember, error) {
+// GetProjectMembers retrieves one page of the members of a project, oldest first
+func (r *MemberRepository) GetProjectMembers(projectID string, page PageRequest) ([]models.ProjectMember, *PageInfo, error) {
+	if err := page.checkCursor(oldestFirstCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"project_id = $1"}
+	args := []any{projectID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "project_members", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count members: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "created_at", "timestamp", "ASC")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
 	query := `
 		SELECT id, project_id, client_id, role, invited_by, created_at
 		FROM project_members
-		WHERE project_id = $1
-		ORDER BY created_at ASC
-	`
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at ASC, id ASC
+		LIMIT $` + strconv.Itoa(len(args))
 
-	rows, err := r.db.Query(query, projectID)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get members: %w", err)
+		return nil, nil, fmt.Errorf("failed to get members: %w", err)
 	}
 	defer rows.Close()
 
-	var members []models.ProjectMember
+	members := make([]models.ProjectMember, 0)
 	for rows.Next() {
 		var member models.ProjectMember
 		var invitedByVal sql.NullString
@@ -74,7 +103,7 @@ func (r *MemberRepository) GetProjectMembers(projectID string) ([]models.Project
 			&member.CreatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan member: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan member: %w", err)
 		}
 
 		if invitedByVal.Valid {
@@ -84,18 +113,30 @@ func (r *MemberRepository) GetProjectMembers(projectID string) ([]models.Project
 		members = append(members, member)
 	}
 
-	return members, nil
+	if len(members) > limit {
+		members = members[:limit]
+		last := members[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: oldestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
+
+	return members, info, nil
 }
 
-// CheckMemberAccess checks if a client has access to a project
+// CheckMemberAccess checks if a client has access to a project.
+// Members without two-factor authentication get ErrMFARequired for projects that require it.
 func (r *MemberRepository) CheckMemberAccess(projectID, clientID string) (bool, string, error) {
 	query := `
-		SELECT role FROM project_members
-		WHERE project_id = $1 AND client_id = $2
+		SELECT pm.role, p.require_mfa AND c.mfa_enabled_at IS NULL
+		FROM project_members pm
+		JOIN projects p ON p.id = pm.project_id
+		JOIN clients c ON c.id = pm.client_id
+		WHERE pm.project_id = $1 AND pm.client_id = $2
 	`
 
 	var role string
-	err := r.db.QueryRow(query, projectID, clientID).Scan(&role)
+	var needsMFA bool
+	err := r.db.QueryRow(query, projectID, clientID).Scan(&role, &needsMFA)
 
 	if err == sql.ErrNoRows {
 		return false, "", nil
@@ -103,10 +144,40 @@ func (r *MemberRepository) CheckMemberAccess(projectID, clientID string) (bool,
 	if err != nil {
 		return false, "", fmt.Errorf("failed to check access: %w", err)
 	}
+	if needsMFA {
+		return false, role, ErrMFARequired
+	}
 
 	return true, role, nil
 }
 
+// FindMembersByEmail returns the members of a project whose email is in emails
+func (r *MemberRepository) FindMembersByEmail(projectID string, emails []string) ([]models.Client, error) {
+	query := `
+		SELECT c.id, c.name, c.email
+		FROM project_members pm
+		JOIN clients c ON c.id = pm.client_id
+		WHERE pm.project_id = $1 AND LOWER(c.email) = ANY($2)
+	`
+
+	rows, err := r.db.Query(query, projectID, pq.Array(emails))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]models.Client, 0)
+	for rows.Next() {
+		var member models.Client
+		if err := rows.Scan(&member.ID, &member.Name, &member.Email); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
 // RemoveMember removes a member from a project
 func (r *MemberRepository) RemoveMember(projectID, clientID string) error {
 	query := `DELETE FROM project_members WHERE project_id = $1 AND client_id = $2 AND role != 'owner'`
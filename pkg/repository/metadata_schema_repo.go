@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-service/pkg/metadata"
+	"file-service/pkg/models"
+	"fmt"
+)
+
+type MetadataSchemaRepository struct {
+	db *sql.DB
+}
+
+func NewMetadataSchemaRepository(db *sql.DB) *MetadataSchemaRepository {
+	return &MetadataSchemaRepository{db: db}
+}
+
+const metadataSchemaColumns = `id, project_id, version, schema, created_by, created_at`
+
+func scanMetadataSchema(row rowScanner) (*models.ProjectMetadataSchema, error) {
+	var schema models.ProjectMetadataSchema
+	var definition []byte
+	var createdBy sql.NullString
+
+	if err := row.Scan(&schema.ID, &schema.ProjectID, &schema.Version, &definition, &createdBy, &schema.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(definition, &schema.Schema); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata schema: %w", err)
+	}
+	if createdBy.Valid {
+		schema.CreatedBy = &createdBy.String
+	}
+
+	return &schema, nil
+}
+
+// CreateSchemaVersion stores a schema as the next version for a project
+func (r *MetadataSchemaRepository) CreateSchemaVersion(projectID, createdBy string, schema metadata.Schema) (*models.ProjectMetadataSchema, error) {
+	definition, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata schema: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize version numbering per project
+	if _, err := tx.Exec(`SELECT id FROM projects WHERE id = $1 FOR UPDATE`, projectID); err != nil {
+		return nil, fmt.Errorf("failed to lock project: %w", err)
+	}
+
+	query := `
+		INSERT INTO project_metadata_schemas (project_id, version, schema, created_by)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3
+		FROM project_metadata_schemas
+		WHERE project_id = $1
+		RETURNING ` + metadataSchemaColumns
+
+	created, err := scanMetadataSchema(tx.QueryRow(query, projectID, definition, createdBy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata schema: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetCurrentSchema returns the latest schema of a project, or nil when the project has none
+func (r *MetadataSchemaRepository) GetCurrentSchema(projectID string) (*models.ProjectMetadataSchema, error) {
+	query := `
+		SELECT ` + metadataSchemaColumns + `
+		FROM project_metadata_schemas
+		WHERE project_id = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	schema, err := scanMetadataSchema(r.db.QueryRow(query, projectID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+// GetSchemaVersion returns a specific schema version of a project
+func (r *MetadataSchemaRepository) GetSchemaVersion(projectID string, version int) (*models.ProjectMetadataSchema, error) {
+	query := `
+		SELECT ` + metadataSchemaColumns + `
+		FROM project_metadata_schemas
+		WHERE project_id = $1 AND version = $2
+	`
+
+	schema, err := scanMetadataSchema(r.db.QueryRow(query, projectID, version))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("metadata schema version not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+// ListSchemaVersions returns every schema version of a project, newest first
+func (r *MetadataSchemaRepository) ListSchemaVersions(projectID string) ([]models.ProjectMetadataSchema, error) {
+	query := `
+		SELECT ` + metadataSchemaColumns + `
+		FROM project_metadata_schemas
+		WHERE project_id = $1
+		ORDER BY version DESC
+	`
+
+	rows, err := r.db.Query(query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata schemas: %w", err)
+	}
+	defer rows.Close()
+
+	schemas := make([]models.ProjectMetadataSchema, 0)
+	for rows.Next() {
+		schema, err := scanMetadataSchema(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan metadata schema: %w", err)
+		}
+		schemas = append(schemas, *schema)
+	}
+
+	return schemas, nil
+}
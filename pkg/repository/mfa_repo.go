@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes a client gets each time they are generated
+const RecoveryCodeCount = 10
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a client that already has two-factor authentication
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming enrolment for a client without a pending secret
+	ErrMFANotEnrolled = errors.New("two-factor enrolment not started")
+)
+
+// MFAState is a client's two-factor authentication setup
+type MFAState struct {
+	// Secret is the encrypted TOTP secret, pending until EnabledAt is set
+	Secret    string
+	EnabledAt *time.Time
+}
+
+// MFARepository stores TOTP secrets and hashed single-use recovery codes
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// NormalizeRecoveryCode strips the separators and case users may type a recovery code with
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// GetMFAState returns the client's two-factor setup; Secret is empty when it never enrolled
+func (r *MFARepository) GetMFAState(clientID string) (*MFAState, error) {
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err := r.db.QueryRow(`SELECT mfa_secret, mfa_enabled_at FROM clients WHERE id = $1`, clientID).Scan(&secret, &enabledAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("client not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa state: %w", err)
+	}
+
+	state := &MFAState{Secret: secret.String}
+	if enabledAt.Valid {
+		state.EnabledAt = &enabledAt.Time
+	}
+	return state, nil
+}
+
+// SetPendingSecret stores a new encrypted TOTP secret awaiting confirmation, replacing an earlier pending one
+func (r *MFARepository) SetPendingSecret(clientID, encryptedSecret string) error {
+	result, err := r.db.Exec(`
+		UPDATE clients
+		SET mfa_secret = $2, mfa_last_step = NULL, updated_at = NOW()
+		WHERE id = $1 AND mfa_enabled_at IS NULL
+	`, clientID, encryptedSecret)
+	if err != nil {
+		return fmt.Errorf("failed to store mfa secret: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store mfa secret: %w", err)
+	}
+	if rows == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableMFA confirms the pending secret with the time step of a valid code and returns fresh recovery codes
+func (r *MFARepository) EnableMFA(clientID string, step int64) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE clients
+		SET mfa_enabled_at = NOW(), mfa_last_step = $2, updated_at = NOW()
+		WHERE id = $1 AND mfa_enabled_at IS NULL AND mfa_secret IS NOT NULL
+	`, clientID, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	if rows == 0 {
+		return nil, ErrMFANotEnrolled
+	}
+
+	codes, err := replaceRecoveryCodes(tx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	return codes, nil
+}
+
+// UseTOTPStep records that a code of the time step was used. It returns false when that step or a
+// later one was used already, so each code works once.
+func (r *MFARepository) UseTOTPStep(clientID string, step int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE clients
+		SET mfa_last_step = $2
+		WHERE id = $1 AND (mfa_last_step IS NULL OR mfa_last_step < $2)
+	`, clientID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record mfa code: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record mfa code: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ReplaceRecoveryCodes invalidates the client's recovery codes and returns new ones
+func (r *MFARepository) ReplaceRecoveryCodes(clientID string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, clientID string) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE client_id = $1`, clientID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		randomBytes := make([]byte, 5)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := hex.EncodeToString(randomBytes)
+
+		_, err := tx.Exec(`INSERT INTO mfa_recovery_codes (client_id, code_hash) VALUES ($1, $2)`, clientID, hashToken(code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the client as used, returning false when there is none
+func (r *MFARepository) UseRecoveryCode(clientID, code string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE client_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, clientID, hashToken(NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the client has left
+func (r *MFARepository) CountRecoveryCodes(clientID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM mfa_recovery_codes WHERE client_id = $1 AND used_at IS NULL`, clientID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// DisableMFA removes the client's TOTP secret and recovery codes
+func (r *MFARepository) DisableMFA(clientID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to disable mfa: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE clients
+		SET mfa_secret = NULL, mfa_enabled_at = NULL, mfa_last_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to disable mfa: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE client_id = $1`, clientID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to disable mfa: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// Orderings shared by listings keyed on created_at,id
+const (
+	newestFirstCursorSort = "created_at:DESC"
+	oldestFirstCursorSort = "created_at:ASC"
+)
+
+// cursorValueTypes lists the type each sort field's cursor value is compared as
+var cursorValueTypes = map[string]string{
+	"created_at":  "timestamp",
+	"name":        "text",
+	"type":        "text",
+	"folder_path": "text",
+	"size":        "bigint",
+	"version":     "integer",
+	"position":    "integer",
+}
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of the previous page
+type Cursor struct {
+	Sort  string `json:"s,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"id,omitempty"`
+}
+
+// PageRequest describes a keyset page
+type PageRequest struct {
+	Limit        int
+	Cursor       *Cursor
+	IncludeTotal bool
+}
+
+// PageInfo describes the page that was returned
+type PageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// EncodeCursor returns the opaque form of a cursor
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses an opaque cursor
+func DecodeCursor(raw string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || !cursor.valid() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// valid reports whether the cursor's value and id parse as the types they are compared as in SQL
+func (c Cursor) valid() bool {
+	if c.ID != "" {
+		if _, err := uuid.Parse(c.ID); err != nil {
+			return false
+		}
+	}
+
+	field, _, _ := strings.Cut(c.Sort, ":")
+	switch cursorValueTypes[field] {
+	case "timestamp":
+		_, err := time.Parse(time.RFC3339Nano, c.Value)
+		return err == nil
+	case "bigint":
+		_, err := strconv.ParseInt(c.Value, 10, 64)
+		return err == nil
+	case "integer":
+		_, err := strconv.ParseInt(c.Value, 10, 32)
+		return err == nil
+	case "text":
+		return true
+	default:
+		return false
+	}
+}
+
+// pageLimit clamps the requested limit to the allowed range
+func (p PageRequest) pageLimit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// checkCursor rejects cursors issued for a different ordering
+func (p PageRequest) checkCursor(sort string) error {
+	if p.Cursor != nil && p.Cursor.Sort != sort {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// appendKeyset adds the condition that skips rows up to and including the cursor.
+// sortExpr is compared as sortType and ties are broken on id in the same direction.
+func appendKeyset(conditions []string, args []any, cursor *Cursor, sortExpr, sortType, direction string) ([]string, []any) {
+	return appendKeysetOn(conditions, args, cursor, sortExpr, sortType, direction, "id")
+}
+
+// appendKeysetOn is appendKeyset with the tie-breaking column named, for queries that join tables
+func appendKeysetOn(conditions []string, args []any, cursor *Cursor, sortExpr, sortType, direction, idExpr string) ([]string, []any) {
+	if cursor == nil {
+		return conditions, args
+	}
+
+	op := "<"
+	if direction == "ASC" {
+		op = ">"
+	}
+
+	args = append(args, cursor.Value)
+	if cursor.ID == "" {
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d::%s", sortExpr, op, len(args), sortType))
+		return conditions, args
+	}
+
+	args = append(args, cursor.ID)
+	conditions = append(conditions, fmt.Sprintf("(%s, %s) %s ($%d::%s, $%d::uuid)", sortExpr, idExpr, op, len(args)-1, sortType, len(args)))
+	return conditions, args
+}
+
+// countRows runs a COUNT(*) over the given table and conditions
+func countRows(db *sql.DB, table string, conditions []string, args []any) (int, error) {
+	var total int
+	query := `SELECT COUNT(*) FROM ` + table + ` WHERE ` + strings.Join(conditions, " AND ")
+	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
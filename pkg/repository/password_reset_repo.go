@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrResetTokenInvalid is returned for password reset tokens that are unknown, used, expired or superseded
+var ErrResetTokenInvalid = errors.New("invalid reset token")
+
+// PasswordResetRepository stores hashes of single-use password reset tokens
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// CreateResetToken returns a new reset token for the client; earlier unused tokens stop working
+func (r *PasswordResetRepository) CreateResetToken(clientID string, ttl time.Duration) (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	token := hex.EncodeToString(randomBytes)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to create reset token: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = NOW() WHERE client_id = $1 AND used_at IS NULL`, clientID); err != nil {
+		return "", fmt.Errorf("failed to supersede reset tokens: %w", err)
+	}
+
+	query := `
+		INSERT INTO password_reset_tokens (client_id, token_hash, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))
+	`
+	if _, err := tx.Exec(query, clientID, hashToken(token), ttl.Seconds()); err != nil {
+		return "", fmt.Errorf("failed to create reset token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to create reset token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ResetPassword uses a reset token to set the client's password and returns the client id.
+// The token and any other outstanding token of the client stop working.
+func (r *PasswordResetRepository) ResetPassword(token, passwordHash string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+	defer tx.Rollback()
+
+	var clientID string
+	query := `
+		SELECT t.client_id
+		FROM password_reset_tokens t
+		JOIN clients c ON c.id = t.client_id
+		WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW() AND c.status = 'active'
+		FOR UPDATE OF t
+	`
+	err = tx.QueryRow(query, hashToken(token)).Scan(&clientID)
+	if err == sql.ErrNoRows {
+		return "", ErrResetTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get reset token: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE clients SET password_hash = $1, updated_at = NOW() WHERE id = $2`, passwordHash, clientID); err != nil {
+		return "", fmt.Errorf("failed to update password: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = NOW() WHERE client_id = $1 AND used_at IS NULL`, clientID); err != nil {
+		return "", fmt.Errorf("failed to use reset token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	return clientID, nil
+}
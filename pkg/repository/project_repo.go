@@ -2,8 +2,14 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"file-service/pkg/models"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type ProjectRepository struct {
@@ -14,84 +20,220 @@ func NewProjectRepository(db *sql.DB) *ProjectRepository {
 	return &ProjectRepository{db: db}
 }
 
-// CreateProject creates a new project
-func (r *ProjectRepository) CreateProject(clientID, name, description string) (*models.Project, error) {
-	query := `
-		INSERT INTO projects (client_id, name, description)
-		VALUES ($1, $2, $3)
-		RETURNING id, client_id, name, description, created_at, updated_at
-	`
+const projectColumns = `id, client_id, name, description, download_url_ttl_seconds, upload_url_ttl_seconds, max_upload_size_bytes, slug, public_aliases, require_mfa, created_at, updated_at`
+
+// ErrSlugTaken is returned when another project already uses a slug
+var ErrSlugTaken = errors.New("slug is already in use")
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
+func scanProject(row rowScanner) (*models.Project, error) {
 	var project models.Project
-	err := r.db.QueryRow(query, clientID, name, description).Scan(
+	var description sql.NullString
+	var downloadTTL, uploadTTL sql.NullInt32
+	var maxUpload sql.NullInt64
+
+	err := row.Scan(
 		&project.ID,
 		&project.ClientID,
 		&project.Name,
-		&project.Description,
+		&description,
+		&downloadTTL,
+		&uploadTTL,
+		&maxUpload,
+		&project.Slug,
+		&project.PublicAliases,
+		&project.RequireMFA,
 		&project.CreatedAt,
 		&project.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	project.Description = description.String
+	if downloadTTL.Valid {
+		v := int(downloadTTL.Int32)
+		project.DownloadURLTTLSeconds = &v
+	}
+	if uploadTTL.Valid {
+		v := int(uploadTTL.Int32)
+		project.UploadURLTTLSeconds = &v
+	}
+	if maxUpload.Valid {
+		v := maxUpload.Int64
+		project.MaxUploadSizeBytes = &v
+	}
+
+	return &project, nil
+}
 
+// CreateProject creates a new project
+func (r *ProjectRepository) CreateProject(clientID, name, description string) (*models.Project, error) {
+	query := `
+		INSERT INTO projects (client_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING ` + projectColumns
+
+	project, err := scanProject(r.db.QueryRow(query, clientID, name, description))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create project: %w", err)
 	}
 
-	return &project, nil
+	return project, nil
 }
 
-// GetProjectsByClientID retrieves all projects for a client
-func (r *ProjectRepository) GetProjectsByClientID(clientID string) ([]models.Project, error) {
+// GetProjectsByClientID retrieves one page of projects for a client, newest first
+func (r *ProjectRepository) GetProjectsByClientID(clientID string, page PageRequest) ([]models.Project, *PageInfo, error) {
+	if err := page.checkCursor(newestFirstCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"client_id = $1"}
+	args := []any{clientID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "projects", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count projects: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeyset(conditions, args, page.Cursor, "created_at", "timestamp", "DESC")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
 	query := `
-		SELECT id, client_id, name, description, created_at, updated_at
+		SELECT ` + projectColumns + `
 		FROM projects
-		WHERE client_id = $1
-		ORDER BY created_at DESC
-	`
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args))
 
-	rows, err := r.db.Query(query, clientID)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get projects: %w", err)
+		return nil, nil, fmt.Errorf("failed to get projects: %w", err)
 	}
 	defer rows.Close()
 
-	var projects []models.Project
+	projects := make([]models.Project, 0)
 	for rows.Next() {
-		var project models.Project
-		err := rows.Scan(
-			&project.ID,
-			&project.ClientID,
-			&project.Name,
-			&project.Description,
-			&project.CreatedAt,
-			&project.UpdatedAt,
-		)
+		project, err := scanProject(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan project: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan project: %w", err)
 		}
-		projects = append(projects, project)
+		projects = append(projects, *project)
 	}
 
-	return projects, nil
+	if len(projects) > limit {
+		projects = projects[:limit]
+		last := projects[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: newestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
+
+	return projects, info, nil
+}
+
+// GetSharedProjects retrieves one page of the projects a client is a member of but does not own, newest first
+func (r *ProjectRepository) GetSharedProjects(clientID string, page PageRequest) ([]models.SharedProject, *PageInfo, error) {
+	if err := page.checkCursor(newestFirstCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"pm.client_id = $1", "p.client_id <> $1"}
+	args := []any{clientID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "projects p JOIN project_members pm ON pm.project_id = p.id", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count shared projects: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeysetOn(conditions, args, page.Cursor, "p.created_at", "timestamp", "DESC", "p.id")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
+	query := `
+		SELECT p.` + strings.ReplaceAll(projectColumns, ", ", ", p.") + `, pm.role, pm.created_at
+		FROM projects p
+		JOIN project_members pm ON pm.project_id = p.id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get shared projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := make([]models.SharedProject, 0)
+	for rows.Next() {
+		var shared models.SharedProject
+		project, err := scanProject(sharedProjectRow{rows, &shared})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan shared project: %w", err)
+		}
+		shared.Project = *project
+		projects = append(projects, shared)
+	}
+
+	if len(projects) > limit {
+		projects = projects[:limit]
+		last := projects[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: newestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
+
+	return projects, info, nil
+}
+
+// sharedProjectRow scans the membership columns that follow the project columns
+type sharedProjectRow struct {
+	row    rowScanner
+	shared *models.SharedProject
+}
+
+func (r sharedProjectRow) Scan(dest ...any) error {
+	return r.row.Scan(append(dest, &r.shared.Role, &r.shared.JoinedAt)...)
 }
 
 // GetProjectByID retrieves a project by ID
 func (r *ProjectRepository) GetProjectByID(projectID, clientID string) (*models.Project, error) {
 	query := `
-		SELECT id, client_id, name, description, created_at, updated_at
+		SELECT ` + projectColumns + `
 		FROM projects
 		WHERE id = $1 AND client_id = $2
 	`
 
-	var project models.Project
-	err := r.db.QueryRow(query, projectID, clientID).Scan(
-		&project.ID,
-		&project.ClientID,
-		&project.Name,
-		&project.Description,
-		&project.CreatedAt,
-		&project.UpdatedAt,
-	)
+	project, err := scanProject(r.db.QueryRow(query, projectID, clientID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	return project, nil
+}
 
+// FindProjectByID retrieves a project regardless of owner; callers must check membership first
+func (r *ProjectRepository) FindProjectByID(projectID string) (*models.Project, error) {
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects
+		WHERE id = $1
+	`
+
+	project, err := scanProject(r.db.QueryRow(query, projectID))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("project not found")
 	}
@@ -99,5 +241,119 @@ func (r *ProjectRepository) GetProjectByID(projectID, clientID string) (*models.
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
 
-	return &project, nil
+	return project, nil
+}
+
+// GetProjectBySlug retrieves a project by its alias slug; callers must check access
+func (r *ProjectRepository) GetProjectBySlug(slug string) (*models.Project, error) {
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects
+		WHERE slug = $1
+	`
+
+	project, err := scanProject(r.db.QueryRow(query, slug))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	return project, nil
+}
+
+// UpdateProjectAliasSettings changes the slug and alias visibility of a project
+func (r *ProjectRepository) UpdateProjectAliasSettings(projectID, clientID string, settings models.ProjectAliasSettings) (*models.Project, error) {
+	query := `
+		UPDATE projects
+		SET slug = COALESCE($3, slug),
+			public_aliases = COALESCE($4, public_aliases),
+			updated_at = NOW()
+		WHERE id = $1 AND client_id = $2
+		RETURNING ` + projectColumns
+
+	project, err := scanProject(r.db.QueryRow(query, projectID, clientID, settings.Slug, settings.PublicAliases))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project not found")
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update project alias settings: %w", err)
+	}
+
+	return project, nil
+}
+
+// SetProjectRequireMFA sets whether every member of a project must have two-factor authentication enabled
+func (r *ProjectRepository) SetProjectRequireMFA(projectID, clientID string, require bool) (*models.Project, error) {
+	query := `
+		UPDATE projects
+		SET require_mfa = $3, updated_at = NOW()
+		WHERE id = $1 AND client_id = $2
+		RETURNING ` + projectColumns
+
+	project, err := scanProject(r.db.QueryRow(query, projectID, clientID, require))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update project security settings: %w", err)
+	}
+
+	return project, nil
+}
+
+// OwnsMFARequiredProject reports whether the client owns a project that requires two-factor authentication
+func (r *ProjectRepository) OwnsMFARequiredProject(clientID string) (bool, error) {
+	var owns bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM projects WHERE client_id = $1 AND require_mfa)`, clientID).Scan(&owns)
+	if err != nil {
+		return false, fmt.Errorf("failed to check project security settings: %w", err)
+	}
+
+	return owns, nil
+}
+
+// UpdateProjectURLSettings updates the presigned URL overrides of a project.
+func (r *ProjectRepository) UpdateProjectURLSettings(projectID, clientID string, settings models.ProjectURLSettings) (*models.Project, error) {
+	query := `
+		UPDATE projects
+		SET download_url_ttl_seconds = CASE WHEN $3::boolean THEN NULLIF($4::integer, 0) ELSE download_url_ttl_seconds END,
+			upload_url_ttl_seconds = CASE WHEN $5::boolean THEN NULLIF($6::integer, 0) ELSE upload_url_ttl_seconds END,
+			max_upload_size_bytes = CASE WHEN $7::boolean THEN NULLIF($8::bigint, 0) ELSE max_upload_size_bytes END,
+			updated_at = NOW()
+		WHERE id = $1 AND client_id = $2
+		RETURNING ` + projectColumns
+
+	var downloadTTL, uploadTTL int
+	var maxUpload int64
+	if settings.DownloadURLTTLSeconds != nil {
+		downloadTTL = *settings.DownloadURLTTLSeconds
+	}
+	if settings.UploadURLTTLSeconds != nil {
+		uploadTTL = *settings.UploadURLTTLSeconds
+	}
+	if settings.MaxUploadSizeBytes != nil {
+		maxUpload = *settings.MaxUploadSizeBytes
+	}
+
+	project, err := scanProject(r.db.QueryRow(query,
+		projectID,
+		clientID,
+		settings.DownloadURLTTLSeconds != nil, downloadTTL,
+		settings.UploadURLTTLSeconds != nil, uploadTTL,
+		settings.MaxUploadSizeBytes != nil, maxUpload,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update project settings: %w", err)
+	}
+
+	return project, nil
 }
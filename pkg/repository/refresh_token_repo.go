@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for refresh tokens that are unknown, expired or revoked
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again; its family is revoked
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshTokenRepository stores hashes of issued refresh tokens grouped into families, one per session
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// RotateRefreshToken replaces a client's live refresh token with its successor in the same family
+// and returns the family's session id, recording the session as seen from ipAddress.
+// A token that was already replaced revokes the whole family and returns ErrRefreshTokenReused.
+func (r *RefreshTokenRepository) RotateRefreshToken(clientID, token, successor string, expiresAt time.Time, ipAddress string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id, familyID string
+	var replacedBy sql.NullString
+	var revokedAt sql.NullTime
+	var tokenExpiresAt time.Time
+	query := `
+		SELECT id, family_id, replaced_by_id, revoked_at, expires_at
+		FROM refresh_tokens
+		WHERE token_hash = $1 AND client_id = $2
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, hashToken(token), clientID).Scan(&id, &familyID, &replacedBy, &revokedAt, &tokenExpiresAt)
+	if err == sql.ErrNoRows {
+		return "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if replacedBy.Valid {
+		if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID); err != nil {
+			return "", fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return "", fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		return "", ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || tokenExpiresAt.Before(time.Now()) {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	var successorID string
+	query = `
+		INSERT INTO refresh_tokens (client_id, token_hash, family_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	if err := tx.QueryRow(query, clientID, hashToken(successor), familyID, expiresAt).Scan(&successorID); err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET replaced_by_id = $2, revoked_at = NOW() WHERE id = $1`, id, successorID); err != nil {
+		return "", fmt.Errorf("failed to retire refresh token: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET last_seen_at = NOW(), ip_address = $2 WHERE id = $1`, familyID, ipAddress); err != nil {
+		return "", fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return familyID, nil
+}
+
+// RevokeRefreshTokenFamily revokes the family of a refresh token, ending that login
+func (r *RefreshTokenRepository) RevokeRefreshTokenFamily(clientID, token string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE revoked_at IS NULL AND family_id = (
+			SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND client_id = $2
+		)
+	`
+	if _, err := r.db.Exec(query, hashToken(token), clientID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes tokens past their expiry; reuse of an expired token no longer matters
+func (r *RefreshTokenRepository) DeleteExpiredRefreshTokens() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"file-service/pkg/models"
+	"fmt"
+	"time"
+)
+
+// SessionRepository tracks logins. A session is active while its refresh token family has a live token.
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// liveSessionCondition matches sessions with an unrevoked, unexpired refresh token
+const liveSessionCondition = `EXISTS (
+	SELECT 1 FROM refresh_tokens rt
+	WHERE rt.family_id = s.id AND rt.revoked_at IS NULL AND rt.expires_at > NOW()
+)`
+
+// CreateSession starts a session with its first refresh token. newDevice reports whether
+// the client has logged in before, but never with this user agent.
+func (r *SessionRepository) CreateSession(clientID, userAgent, ipAddress, token string, expiresAt time.Time) (sessionID string, newDevice bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer tx.Rollback()
+
+	var hasSessions, knownDevice bool
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM sessions WHERE client_id = $1),
+			EXISTS (SELECT 1 FROM sessions WHERE client_id = $1 AND user_agent = $2)
+	`
+	if err := tx.QueryRow(query, clientID, userAgent).Scan(&hasSessions, &knownDevice); err != nil {
+		return "", false, fmt.Errorf("failed to check known devices: %w", err)
+	}
+
+	query = `
+		INSERT INTO sessions (client_id, user_agent, ip_address)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+	if err := tx.QueryRow(query, clientID, userAgent, ipAddress).Scan(&sessionID); err != nil {
+		return "", false, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	query = `INSERT INTO refresh_tokens (client_id, token_hash, family_id, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(query, clientID, hashToken(token), sessionID, expiresAt); err != nil {
+		return "", false, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", false, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return sessionID, hasSessions && !knownDevice, nil
+}
+
+// ListActiveSessions returns a client's active sessions, most recently seen first
+func (r *SessionRepository) ListActiveSessions(clientID string) ([]models.Session, error) {
+	query := `
+		SELECT s.id, s.user_agent, s.ip_address, s.created_at, s.last_seen_at
+		FROM sessions s
+		WHERE s.client_id = $1 AND ` + liveSessionCondition + `
+		ORDER BY s.last_seen_at DESC, s.id
+	`
+	rows, err := r.db.Query(query, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the refresh tokens of one of the client's sessions; false means no such active session
+func (r *SessionRepository) RevokeSession(clientID, sessionID string) (bool, error) {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND client_id = $2 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, sessionID, clientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return revoked > 0, nil
+}
+
+// RevokeClientSessions revokes every session of a client and returns how many refresh tokens were live
+func (r *SessionRepository) RevokeClientSessions(clientID string) (int64, error) {
+	result, err := r.db.Exec(`UPDATE refresh_tokens SET revoked_at = NOW() WHERE client_id = $1 AND revoked_at IS NULL`, clientID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteStaleSessions removes ended sessions not seen within the retention period.
+// Until then their user agents still count as known devices.
+func (r *SessionRepository) DeleteStaleSessions(retention time.Duration) (int64, error) {
+	query := `DELETE FROM sessions s WHERE s.last_seen_at < $1 AND NOT ` + liveSessionCondition
+	result, err := r.db.Exec(query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale sessions: %w", err)
+	}
+
+	return result.RowsAffected()
+}
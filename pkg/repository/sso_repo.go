@@ -0,0 +1,632 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"file-service/pkg/models"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrSSOSlugTaken is returned when another connection uses the slug
+	ErrSSOSlugTaken = errors.New("slug is already in use")
+	// ErrSSODomainTaken is returned when another connection already claims one of the domains
+	ErrSSODomainTaken = errors.New("domain is already claimed by another SSO connection")
+	// ErrSSOProjectNotOwned is returned when a group mapping names a project the connection owner does not own
+	ErrSSOProjectNotOwned = errors.New("group mappings may only grant roles in projects you own")
+	// ErrSSOStateInvalid is returned for login states that are unknown, used or expired
+	ErrSSOStateInvalid = errors.New("invalid or expired SSO login state")
+	// ErrSSOEmailInUse is returned when a new identity's email belongs to an account it is not linked to
+	ErrSSOEmailInUse = errors.New("an account with this email already exists; sign in and link SSO from your account")
+	// ErrSSOIdentityLinked is returned when the identity is already linked to another account
+	ErrSSOIdentityLinked = errors.New("this SSO identity is already linked to another account")
+)
+
+// SSOLoginState is a started login. LinkClientID is set when a signed-in client links an identity
+// to its account instead of logging in.
+type SSOLoginState struct {
+	ConnectionID string
+	CodeVerifier string
+	Nonce        string
+	LinkClientID string
+}
+
+const ssoConnectionColumns = `c.id, c.client_id, c.slug, c.name, c.issuer, c.oidc_client_id, c.oidc_client_secret, c.groups_claim, c.trust_unverified_email, c.enabled, c.created_at, c.updated_at,
+	COALESCE((SELECT array_agg(d.domain ORDER BY d.domain) FROM sso_domains d WHERE d.connection_id = c.id), '{}'),
+	COALESCE((SELECT array_agg(d.domain ORDER BY d.domain) FROM sso_domains d WHERE d.connection_id = c.id AND d.verified_at IS NOT NULL), '{}')`
+
+// ssoDomainRecordPrefix and ssoDomainValuePrefix form the TXT record that proves control of a domain
+const (
+	ssoDomainRecordPrefix = "_file-service-sso."
+	ssoDomainValuePrefix  = "file-service-sso-verification="
+)
+
+// SSORepository stores OpenID Connect connections, pending logins and the identities they provision
+type SSORepository struct {
+	db *sql.DB
+}
+
+func NewSSORepository(db *sql.DB) *SSORepository {
+	return &SSORepository{db: db}
+}
+
+func scanSSOConnection(row interface{ Scan(...any) error }) (*models.SSOConnection, error) {
+	var conn models.SSOConnection
+	var domains, verified pq.StringArray
+	err := row.Scan(
+		&conn.ID,
+		&conn.ClientID,
+		&conn.Slug,
+		&conn.Name,
+		&conn.Issuer,
+		&conn.OIDCClientID,
+		&conn.OIDCClientSecret,
+		&conn.GroupsClaim,
+		&conn.TrustUnverifiedEmail,
+		&conn.Enabled,
+		&conn.CreatedAt,
+		&conn.UpdatedAt,
+		&domains,
+		&verified,
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.AllowedDomains = []string(domains)
+	conn.VerifiedDomains = []string(verified)
+	conn.Domains = []models.SSODomain{}
+	conn.GroupMappings = []models.SSOGroupMapping{}
+	return &conn, nil
+}
+
+// ssoConstraintError maps unique violations on the slug and domains to their errors
+func ssoConstraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if pqErr.Table == "sso_domains" {
+			return ErrSSODomainTaken
+		}
+		return ErrSSOSlugTaken
+	}
+	return err
+}
+
+// replaceSSODomains sets the domains a connection claims. Domains it already claims keep their
+// verification; new ones are verified right away when verified is set, otherwise they wait for their TXT record.
+func replaceSSODomains(tx *sql.Tx, connectionID string, domains []string, verified bool) error {
+	if _, err := tx.Exec(`DELETE FROM sso_domains WHERE connection_id = $1 AND domain <> ALL($2)`, connectionID, pq.Array(domains)); err != nil {
+		return fmt.Errorf("failed to replace domains: %w", err)
+	}
+	query := `
+		INSERT INTO sso_domains (domain, connection_id, verification_token, verified_at)
+		VALUES ($1, $2, replace(gen_random_uuid()::text, '-', ''), CASE WHEN $3 THEN NOW() END)
+		ON CONFLICT (connection_id, domain) DO UPDATE SET verified_at = COALESCE(sso_domains.verified_at, EXCLUDED.verified_at)
+	`
+	for _, domain := range domains {
+		if _, err := tx.Exec(query, domain, connectionID, verified); err != nil {
+			if errors.Is(ssoConstraintError(err), ErrSSODomainTaken) {
+				return ErrSSODomainTaken
+			}
+			return fmt.Errorf("failed to store domain: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateConnection stores a connection with its domains, verified when domainsVerified is set; the
+// client secret must already be encrypted
+func (r *SSORepository) CreateConnection(conn *models.SSOConnection, domainsVerified bool) (*models.SSOConnection, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSO connection: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id string
+	query := `
+		INSERT INTO sso_connections (client_id, slug, name, issuer, oidc_client_id, oidc_client_secret, groups_claim, trust_unverified_email, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	err = tx.QueryRow(query, conn.ClientID, conn.Slug, conn.Name, conn.Issuer, conn.OIDCClientID, conn.OIDCClientSecret, conn.GroupsClaim, conn.TrustUnverifiedEmail, conn.Enabled).Scan(&id)
+	if err != nil {
+		if errors.Is(ssoConstraintError(err), ErrSSOSlugTaken) {
+			return nil, ErrSSOSlugTaken
+		}
+		return nil, fmt.Errorf("failed to create SSO connection: %w", err)
+	}
+
+	if err := replaceSSODomains(tx, id, conn.AllowedDomains, domainsVerified); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create SSO connection: %w", err)
+	}
+
+	return r.GetConnection(id, conn.ClientID)
+}
+
+// GetConnection returns a connection of the client with its group mappings
+func (r *SSORepository) GetConnection(id, clientID string) (*models.SSOConnection, error) {
+	query := `SELECT ` + ssoConnectionColumns + ` FROM sso_connections c WHERE c.id = $1 AND c.client_id = $2`
+	conn, err := scanSSOConnection(r.db.QueryRow(query, id, clientID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("SSO connection not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO connection: %w", err)
+	}
+
+	mappings, err := r.getGroupMappings(conn.ID)
+	if err != nil {
+		return nil, err
+	}
+	conn.GroupMappings = mappings
+
+	domains, err := r.getDomains(conn.ID)
+	if err != nil {
+		return nil, err
+	}
+	conn.Domains = domains
+
+	return conn, nil
+}
+
+// GetConnectionBySlug returns a connection by its slug, for starting logins
+func (r *SSORepository) GetConnectionBySlug(slug string) (*models.SSOConnection, error) {
+	query := `SELECT ` + ssoConnectionColumns + ` FROM sso_connections c WHERE c.slug = $1`
+	conn, err := scanSSOConnection(r.db.QueryRow(query, slug))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("SSO connection not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO connection: %w", err)
+	}
+	return conn, nil
+}
+
+// GetConnectionByID returns a connection regardless of its owner, for completing logins
+func (r *SSORepository) GetConnectionByID(id string) (*models.SSOConnection, error) {
+	query := `SELECT ` + ssoConnectionColumns + ` FROM sso_connections c WHERE c.id = $1`
+	conn, err := scanSSOConnection(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("SSO connection not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO connection: %w", err)
+	}
+	return conn, nil
+}
+
+// FindConnectionByDomain returns the enabled connection with a verified claim on an email domain
+func (r *SSORepository) FindConnectionByDomain(domain string) (*models.SSOConnection, error) {
+	query := `
+		SELECT ` + ssoConnectionColumns + `
+		FROM sso_connections c
+		JOIN sso_domains sd ON sd.connection_id = c.id
+		WHERE sd.domain = $1 AND sd.verified_at IS NOT NULL AND c.enabled
+	`
+	conn, err := scanSSOConnection(r.db.QueryRow(query, domain))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("SSO connection not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO connection: %w", err)
+	}
+	return conn, nil
+}
+
+// ListConnections returns the client's connections, oldest first
+func (r *SSORepository) ListConnections(clientID string) ([]models.SSOConnection, error) {
+	query := `SELECT ` + ssoConnectionColumns + ` FROM sso_connections c WHERE c.client_id = $1 ORDER BY c.created_at`
+	rows, err := r.db.Query(query, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSO connections: %w", err)
+	}
+	defer rows.Close()
+
+	connections := make([]models.SSOConnection, 0)
+	for rows.Next() {
+		conn, err := scanSSOConnection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan SSO connection: %w", err)
+		}
+		connections = append(connections, *conn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list SSO connections: %w", err)
+	}
+
+	for i := range connections {
+		mappings, err := r.getGroupMappings(connections[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		connections[i].GroupMappings = mappings
+
+		domains, err := r.getDomains(connections[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		connections[i].Domains = domains
+	}
+
+	return connections, nil
+}
+
+// UpdateConnection changes the non-nil fields of a client's connection; a new client secret must already be
+// encrypted and new domains are verified when domainsVerified is set
+func (r *SSORepository) UpdateConnection(id, clientID string, update models.SSOConnectionUpdate, domainsVerified bool) (*models.SSOConnection, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update SSO connection: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE sso_connections
+		SET name = COALESCE($3, name),
+			issuer = COALESCE($4, issuer),
+			oidc_client_id = COALESCE($5, oidc_client_id),
+			oidc_client_secret = COALESCE($6, oidc_client_secret),
+			groups_claim = COALESCE($7, groups_claim),
+			enabled = COALESCE($8, enabled),
+			trust_unverified_email = COALESCE($9, trust_unverified_email),
+			updated_at = NOW()
+		WHERE id = $1 AND client_id = $2
+	`
+	result, err := tx.Exec(query, id, clientID, update.Name, update.Issuer, update.OIDCClientID, update.OIDCClientSecret, update.GroupsClaim, update.Enabled, update.TrustUnverifiedEmail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update SSO connection: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update SSO connection: %w", err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("SSO connection not found")
+	}
+
+	if update.AllowedDomains != nil {
+		if err := replaceSSODomains(tx, id, *update.AllowedDomains, domainsVerified); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update SSO connection: %w", err)
+	}
+
+	return r.GetConnection(id, clientID)
+}
+
+// DeleteConnection removes a client's connection. Identities it provisioned are unlinked, their
+// clients are kept, and memberships it granted stay as regular memberships.
+func (r *SSORepository) DeleteConnection(id, clientID string) error {
+	result, err := r.db.Exec(`DELETE FROM sso_connections WHERE id = $1 AND client_id = $2`, id, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete SSO connection: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete SSO connection: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("SSO connection not found")
+	}
+	return nil
+}
+
+func scanSSODomain(row interface{ Scan(...any) error }) (*models.SSODomain, error) {
+	var domain models.SSODomain
+	var token string
+	if err := row.Scan(&domain.Domain, &token, &domain.VerifiedAt); err != nil {
+		return nil, err
+	}
+	domain.Verified = domain.VerifiedAt != nil
+	if !domain.Verified {
+		domain.TXTRecord = ssoDomainRecordPrefix + domain.Domain
+		domain.TXTValue = ssoDomainValuePrefix + token
+	}
+	return &domain, nil
+}
+
+func (r *SSORepository) getDomains(connectionID string) ([]models.SSODomain, error) {
+	query := `
+		SELECT domain, verification_token, verified_at
+		FROM sso_domains
+		WHERE connection_id = $1
+		ORDER BY domain
+	`
+	rows, err := r.db.Query(query, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domains: %w", err)
+	}
+	defer rows.Close()
+
+	domains := make([]models.SSODomain, 0)
+	for rows.Next() {
+		domain, err := scanSSODomain(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan domain: %w", err)
+		}
+		domains = append(domains, *domain)
+	}
+
+	return domains, rows.Err()
+}
+
+// GetDomain returns a domain claimed by a client's connection
+func (r *SSORepository) GetDomain(connectionID, clientID, domain string) (*models.SSODomain, error) {
+	query := `
+		SELECT d.domain, d.verification_token, d.verified_at
+		FROM sso_domains d
+		JOIN sso_connections c ON c.id = d.connection_id
+		WHERE d.connection_id = $1 AND c.client_id = $2 AND d.domain = $3
+	`
+	claimed, err := scanSSODomain(r.db.QueryRow(query, connectionID, clientID, domain))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("domain not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+	return claimed, nil
+}
+
+// MarkDomainVerified records that the connection proved control of the domain. It returns
+// ErrSSODomainTaken when another connection has verified it first.
+func (r *SSORepository) MarkDomainVerified(connectionID, domain string) error {
+	query := `
+		UPDATE sso_domains SET verified_at = COALESCE(verified_at, NOW())
+		WHERE connection_id = $1 AND domain = $2
+	`
+	if _, err := r.db.Exec(query, connectionID, domain); err != nil {
+		if errors.Is(ssoConstraintError(err), ErrSSODomainTaken) {
+			return ErrSSODomainTaken
+		}
+		return fmt.Errorf("failed to verify domain: %w", err)
+	}
+	return nil
+}
+
+func (r *SSORepository) getGroupMappings(connectionID string) ([]models.SSOGroupMapping, error) {
+	query := `
+		SELECT group_name, project_id, role
+		FROM sso_group_mappings
+		WHERE connection_id = $1
+		ORDER BY group_name, project_id
+	`
+	rows, err := r.db.Query(query, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group mappings: %w", err)
+	}
+	defer rows.Close()
+
+	mappings := make([]models.SSOGroupMapping, 0)
+	for rows.Next() {
+		var mapping models.SSOGroupMapping
+		if err := rows.Scan(&mapping.Group, &mapping.ProjectID, &mapping.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan group mapping: %w", err)
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, rows.Err()
+}
+
+// ReplaceGroupMappings sets the group mappings of a client's connection. Every mapped project must
+// be owned by the client. Memberships follow the new mappings at each member's next SSO login.
+func (r *SSORepository) ReplaceGroupMappings(id, clientID string, mappings []models.SSOGroupMapping) (*models.SSOConnection, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace group mappings: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM sso_connections WHERE id = $1 AND client_id = $2)`, id, clientID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to replace group mappings: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("SSO connection not found")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM sso_group_mappings WHERE connection_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to delete group mappings: %w", err)
+	}
+
+	query := `
+		INSERT INTO sso_group_mappings (connection_id, group_name, project_id, role)
+		SELECT $1::uuid, $2::text, p.id, $4::varchar
+		FROM projects p
+		WHERE p.id = $3 AND p.client_id = $5
+		ON CONFLICT (connection_id, group_name, project_id) DO UPDATE SET role = EXCLUDED.role
+	`
+	for _, mapping := range mappings {
+		result, err := tx.Exec(query, id, mapping.Group, mapping.ProjectID, mapping.Role, clientID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store group mapping: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to store group mapping: %w", err)
+		}
+		if rows == 0 {
+			return nil, ErrSSOProjectNotOwned
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to replace group mappings: %w", err)
+	}
+
+	return r.GetConnection(id, clientID)
+}
+
+// CreateLoginState records a pending login under the hash of its state parameter
+func (r *SSORepository) CreateLoginState(state string, login SSOLoginState, ttl time.Duration) error {
+	query := `
+		INSERT INTO sso_login_states (state_hash, connection_id, code_verifier, nonce, link_client_id, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, NOW() + make_interval(secs => $6))
+	`
+	if _, err := r.db.Exec(query, hashToken(state), login.ConnectionID, login.CodeVerifier, login.Nonce, login.LinkClientID, ttl.Seconds()); err != nil {
+		return fmt.Errorf("failed to store SSO login state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLoginState removes a pending login and returns it
+func (r *SSORepository) ConsumeLoginState(state string) (*SSOLoginState, error) {
+	var login SSOLoginState
+	query := `
+		DELETE FROM sso_login_states
+		WHERE state_hash = $1
+		RETURNING connection_id, code_verifier, nonce, COALESCE(link_client_id::text, ''), expires_at > NOW()
+	`
+	var live bool
+	err := r.db.QueryRow(query, hashToken(state)).Scan(&login.ConnectionID, &login.CodeVerifier, &login.Nonce, &login.LinkClientID, &live)
+	if err == sql.ErrNoRows || (err == nil && !live) {
+		return nil, ErrSSOStateInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO login state: %w", err)
+	}
+
+	return &login, nil
+}
+
+// DeleteExpiredLoginStates removes logins that were started but never completed
+func (r *SSORepository) DeleteExpiredLoginStates() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM sso_login_states WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete SSO login states: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ProvisionClient returns the client linked to the provider subject. On a subject's first login it
+// creates a client with the given unusable password hash and reports created; the provider vouches
+// for the email, so the client counts as verified. An existing account is never taken over by email:
+// its owner has to link the identity while signed in, so ErrSSOEmailInUse is returned instead.
+func (r *SSORepository) ProvisionClient(connectionID, subject, email, name, passwordHash string) (string, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to provision client: %w", err)
+	}
+	defer tx.Rollback()
+
+	var clientID string
+	err = tx.QueryRow(`
+		UPDATE sso_identities SET last_login_at = NOW()
+		WHERE connection_id = $1 AND subject = $2
+		RETURNING client_id
+	`, connectionID, subject).Scan(&clientID)
+	if err == nil {
+		if err := tx.Commit(); err != nil {
+			return "", false, fmt.Errorf("failed to provision client: %w", err)
+		}
+		return clientID, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", false, fmt.Errorf("failed to get SSO identity: %w", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO clients (name, email, password_hash, email_verified_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id
+	`, name, email, passwordHash).Scan(&clientID)
+	if err == sql.ErrNoRows {
+		return "", false, ErrSSOEmailInUse
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to provision client: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO sso_identities (connection_id, subject, client_id) VALUES ($1, $2, $3)`, connectionID, subject, clientID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to link SSO identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", false, fmt.Errorf("failed to provision client: %w", err)
+	}
+
+	return clientID, true, nil
+}
+
+// LinkIdentity links the provider subject to a signed-in client that asked for it. Linking an
+// identity again to the same client succeeds; one linked to another client gives ErrSSOIdentityLinked.
+func (r *SSORepository) LinkIdentity(connectionID, subject, clientID string) error {
+	query := `
+		INSERT INTO sso_identities (connection_id, subject, client_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (connection_id, subject) DO UPDATE SET last_login_at = NOW()
+		WHERE sso_identities.client_id = EXCLUDED.client_id
+	`
+	result, err := r.db.Exec(query, connectionID, subject, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to link SSO identity: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to link SSO identity: %w", err)
+	}
+	if rows == 0 {
+		return ErrSSOIdentityLinked
+	}
+	return nil
+}
+
+// SyncGroupRoles gives the client the roles its groups map to and removes memberships the connection
+// granted earlier for groups it no longer has. A project mapped from several groups gets the highest
+// role. Memberships the client got any other way are left alone.
+func (r *SSORepository) SyncGroupRoles(connectionID, clientID string, groups []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to sync group roles: %w", err)
+	}
+	defer tx.Rollback()
+
+	grant := `
+		WITH desired AS (
+			SELECT project_id, CASE WHEN bool_or(role = 'editor') THEN 'editor' ELSE 'viewer' END AS role
+			FROM sso_group_mappings
+			WHERE connection_id = $1 AND group_name = ANY($3)
+			GROUP BY project_id
+		)
+		INSERT INTO project_members (project_id, client_id, role, invited_by, sso_connection_id)
+		SELECT d.project_id, $2::uuid, d.role, c.client_id, c.id
+		FROM desired d
+		JOIN sso_connections c ON c.id = $1
+		ON CONFLICT (project_id, client_id) DO UPDATE SET role = EXCLUDED.role
+		WHERE project_members.sso_connection_id = EXCLUDED.sso_connection_id
+	`
+	if _, err := tx.Exec(grant, connectionID, clientID, pq.Array(groups)); err != nil {
+		return fmt.Errorf("failed to grant group roles: %w", err)
+	}
+
+	revoke := `
+		DELETE FROM project_members
+		WHERE client_id = $2 AND sso_connection_id = $1
+		  AND project_id NOT IN (
+			SELECT project_id FROM sso_group_mappings
+			WHERE connection_id = $1 AND group_name = ANY($3)
+		  )
+	`
+	if _, err := tx.Exec(revoke, connectionID, clientID, pq.Array(groups)); err != nil {
+		return fmt.Errorf("failed to revoke group roles: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to sync group roles: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"file-service/pkg/models"
+	"file-service/pkg/workflow"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type WorkflowRepository struct {
+	db *sql.DB
+}
+
+func NewWorkflowRepository(db *sql.DB) *WorkflowRepository {
+	return &WorkflowRepository{db: db}
+}
+
+// ErrStateChanged is returned when an asset left the expected state before a transition was recorded
+var ErrStateChanged = errors.New("asset state changed, reload and try again")
+
+// GetProjectWorkflow returns the project's workflow, or the default when it has none.
+// The boolean reports whether the project configured its own.
+func (r *WorkflowRepository) GetProjectWorkflow(projectID string) (workflow.Definition, bool, error) {
+	var definition []byte
+	err := r.db.QueryRow(`SELECT workflow FROM projects WHERE id = $1`, projectID).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return workflow.Definition{}, false, fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return workflow.Definition{}, false, fmt.Errorf("failed to get workflow: %w", err)
+	}
+
+	if definition == nil {
+		return workflow.Default(), false, nil
+	}
+
+	var def workflow.Definition
+	if err := json.Unmarshal(definition, &def); err != nil {
+		return workflow.Definition{}, false, fmt.Errorf("failed to decode workflow: %w", err)
+	}
+
+	return def, true, nil
+}
+
+// SetProjectWorkflow stores the project's workflow; nil restores the default
+func (r *WorkflowRepository) SetProjectWorkflow(projectID string, def *workflow.Definition) error {
+	var definition []byte
+	if def != nil {
+		var err error
+		if definition, err = json.Marshal(def); err != nil {
+			return fmt.Errorf("failed to encode workflow: %w", err)
+		}
+	}
+
+	result, err := r.db.Exec(`UPDATE projects SET workflow = $2, updated_at = NOW() WHERE id = $1`, projectID, definition)
+	if err != nil {
+		return fmt.Errorf("failed to update workflow: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("project not found")
+	}
+
+	return nil
+}
+
+// TransitionAsset moves an asset from one state to another and records the change.
+// ErrStateChanged is returned when the asset is no longer in the from state.
+func (r *WorkflowRepository) TransitionAsset(assetID string, from, to workflow.State, changedBy, note string) (*Asset, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE assets
+		SET state = $3, updated_at = NOW()
+		WHERE id = $1 AND state = $2
+		RETURNING ` + assetColumns
+
+	asset, err := scanAsset(tx.QueryRow(query, assetID, from, to))
+	if err == sql.ErrNoRows {
+		return nil, ErrStateChanged
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update asset state: %w", err)
+	}
+
+	query = `
+		INSERT INTO asset_state_history (asset_id, from_state, to_state, changed_by, note)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(query, assetID, from, to, changedBy, note); err != nil {
+		return nil, fmt.Errorf("failed to record state change: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return asset, nil
+}
+
+// GetStateHistory returns one page of the workflow transitions of an asset, newest first
+func (r *WorkflowRepository) GetStateHistory(assetID string, page PageRequest) ([]models.AssetStateChange, *PageInfo, error) {
+	if err := page.checkCursor(newestFirstCursorSort); err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"h.asset_id = $1"}
+	args := []any{assetID}
+
+	info := &PageInfo{}
+	if page.IncludeTotal {
+		total, err := countRows(r.db, "asset_state_history h", conditions, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count state changes: %w", err)
+		}
+		info.Total = &total
+	}
+
+	conditions, args = appendKeysetOn(conditions, args, page.Cursor, "h.created_at", "timestamp", "DESC", "h.id")
+
+	limit := page.pageLimit()
+	args = append(args, limit+1)
+	query := `
+		SELECT h.id, h.asset_id, h.from_state, h.to_state, h.changed_by, COALESCE(c.name, ''), h.note, h.created_at
+		FROM asset_state_history h
+		LEFT JOIN clients c ON c.id = h.changed_by
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY h.created_at DESC, h.id DESC
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get state history: %w", err)
+	}
+	defer rows.Close()
+
+	changes := make([]models.AssetStateChange, 0)
+	for rows.Next() {
+		var change models.AssetStateChange
+		var changedBy sql.NullString
+
+		err := rows.Scan(
+			&change.ID,
+			&change.AssetID,
+			&change.FromState,
+			&change.ToState,
+			&changedBy,
+			&change.ChangedByName,
+			&change.Note,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan state change: %w", err)
+		}
+
+		if changedBy.Valid {
+			change.ChangedBy = &changedBy.String
+		}
+
+		changes = append(changes, change)
+	}
+
+	if len(changes) > limit {
+		changes = changes[:limit]
+		last := changes[limit-1]
+		info.HasMore = true
+		info.NextCursor = EncodeCursor(Cursor{Sort: newestFirstCursorSort, Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID})
+	}
+
+	return changes, info, nil
+}
@@ -1,5 +1,7 @@
 package s3
 
+import "time"
+
 const (
 	// MaxBatchSize is the maximum number of files allowed per batch operation
 	MaxBatchSize = 100
@@ -7,6 +9,18 @@ const (
 	// DefaultMaxWorkers is the default number of concurrent workers for batch operations
 	DefaultMaxWorkers = 10
 
+	// MaxPresignExpiry is the longest lifetime S3 accepts for a SigV4 presigned URL
+	MaxPresignExpiry = 7 * 24 * time.Hour
+
+	// MaxSingleUploadSize is the largest object a single PUT can create
+	MaxSingleUploadSize int64 = 5 * 1024 * 1024 * 1024
+
+	// UserMetadataHeaderPrefix prefixes user metadata keys in object request headers
+	UserMetadataHeaderPrefix = "x-amz-meta-"
+
+	// MaxUserMetadataSize is the total size S3 allows for user metadata keys and values
+	MaxUserMetadataSize = 2 * 1024
+
 	ErrorUploadCancelled   = "upload cancelled"
 	ErrorDownloadCancelled = "download cancelled"
 	ErrorMaxBatchExceeded  = "maximum %d files allowed per batch"
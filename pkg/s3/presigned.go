@@ -8,21 +8,50 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// PresignedPostInput describes a presigned upload to generate
+type PresignedPostInput struct {
+	Key           string
+	MaxFileSize   int64
+	ContentLength int64 // when > 0 the exact size is signed and enforced by S3
+	ExpiresIn     time.Duration
+	Metadata      map[string]string // signed as x-amz-meta-* headers the uploader must send
+}
+
 // PresignedPostResponse contains the URL and fields for browser upload
 type PresignedPostResponse struct {
-	URL    string            `json:"url"`
-	Fields map[string]string `json:"fields"`
+	URL         string            `json:"url"`
+	Fields      map[string]string `json:"fields"`
+	MaxFileSize int64             `json:"max_file_size"`
+	Headers     map[string]string `json:"headers,omitempty"`
 }
 
 // GeneratePresignedPost creates a presigned POST for direct browser → S3 upload
-func (s *S3) GeneratePresignedPost(s3Key string, maxFileSize int64, expiresIn time.Duration) (*PresignedPostResponse, error) {
-	// Create presigned POST request
-	req, _ := s.svc.PutObjectRequest(&s3.PutObjectInput{
+func (s *S3) GeneratePresignedPost(input PresignedPostInput) (*PresignedPostResponse, error) {
+	if input.ContentLength > 0 && input.MaxFileSize > 0 && input.ContentLength > input.MaxFileSize {
+		return nil, fmt.Errorf("file size %d exceeds maximum of %d bytes", input.ContentLength, input.MaxFileSize)
+	}
+
+	putInput := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(s3Key),
-	})
+		Key:    aws.String(input.Key),
+	}
+	if input.ContentLength > 0 {
+		putInput.ContentLength = aws.Int64(input.ContentLength)
+	}
+
+	var headers map[string]string
+	if len(input.Metadata) > 0 {
+		putInput.Metadata = aws.StringMap(input.Metadata)
+		headers = make(map[string]string, len(input.Metadata))
+		for key, value := range input.Metadata {
+			headers[UserMetadataHeaderPrefix+key] = value
+		}
+	}
+
+	// Create presigned POST request
+	req, _ := s.svc.PutObjectRequest(putInput)
 
-	url, err := req.Presign(expiresIn)
+	url, err := req.Presign(ClampPresignExpiry(input.ExpiresIn))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate presigned POST: %w", err)
 	}
@@ -31,7 +60,9 @@ func (s *S3) GeneratePresignedPost(s3Key string, maxFileSize int64, expiresIn ti
 	return &PresignedPostResponse{
 		URL: url,
 		Fields: map[string]string{
-			"key": s3Key,
+			"key": input.Key,
 		},
+		MaxFileSize: input.MaxFileSize,
+		Headers:     headers,
 	}, nil
 }
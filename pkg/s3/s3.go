@@ -4,7 +4,9 @@ import (
 	"context"
 	"file-service/config"
 	"file-service/pkg/cache"
+	"fmt"
 	"io"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -18,8 +20,11 @@ import (
 
 // S3 represents the Amazon S3 service.
 type S3 struct {
-	bucketName string
-	svc        *s3.S3
+	bucketName     string
+	svc            *s3.S3
+	downloadExpiry time.Duration
+	uploadExpiry   time.Duration
+	maxUploadSize  int64
 }
 
 // NewS3 creates a new S3 instance with the specified bucket name and AWS session.
@@ -42,11 +47,40 @@ func NewClient(config *config.Config) (*S3, error) {
 	svc := s3.New(sess)
 
 	return &S3{
-		bucketName: config.BucketName,
-		svc:        svc,
+		bucketName:     config.BucketName,
+		svc:            svc,
+		downloadExpiry: ClampPresignExpiry(time.Duration(config.DownloadURLTimeLimit) * time.Minute),
+		uploadExpiry:   ClampPresignExpiry(time.Duration(config.UploadURLTimeLimit) * time.Minute),
+		maxUploadSize:  int64(config.MaxUploadSizeMB) * 1024 * 1024,
 	}, nil
 }
 
+// DownloadURLExpiry returns the globally configured download URL lifetime.
+func (s *S3) DownloadURLExpiry() time.Duration {
+	return s.downloadExpiry
+}
+
+// UploadURLExpiry returns the globally configured upload URL lifetime.
+func (s *S3) UploadURLExpiry() time.Duration {
+	return s.uploadExpiry
+}
+
+// MaxUploadSize returns the globally configured upload size cap in bytes.
+func (s *S3) MaxUploadSize() int64 {
+	return s.maxUploadSize
+}
+
+// ClampPresignExpiry keeps a presigned URL lifetime within what S3 accepts.
+func ClampPresignExpiry(expiry time.Duration) time.Duration {
+	if expiry <= 0 {
+		return time.Minute
+	}
+	if expiry > MaxPresignExpiry {
+		return MaxPresignExpiry
+	}
+	return expiry
+}
+
 // CreateFolder creates a folder (empty object) in the specified bucket and folder path
 func (s *S3) CreateFolder(folderPath string) error {
 	// Add a trailing slash to the folder path if not already present
@@ -70,12 +104,22 @@ func (s *S3) CreateFolder(folderPath string) error {
 
 // UploadFile uploads a file to the S3 bucket.
 func (s *S3) UploadFile(src io.Reader, objectKey string) error {
-	// Upload the file to S3
-	_, err := s.svc.PutObject(&s3.PutObjectInput{
+	return s.UploadFileWithMetadata(src, objectKey, nil)
+}
+
+// UploadFileWithMetadata uploads a file and stores the given pairs as S3 user metadata (x-amz-meta-*).
+func (s *S3) UploadFileWithMetadata(src io.Reader, objectKey string, metadata map[string]string) error {
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(objectKey),
 		Body:   aws.ReadSeekCloser(src),
-	})
+	}
+	if len(metadata) > 0 {
+		input.Metadata = aws.StringMap(metadata)
+	}
+
+	// Upload the file to S3
+	_, err := s.svc.PutObject(input)
 	if err != nil {
 		return err
 	}
@@ -270,15 +314,23 @@ func (s *S3) GetFile(bucket, key string) (io.Reader, error) {
 
 // Function to generate a signed download URL for the object
 func (s *S3) GenerateDownloadLink(objectKey string, cache *cache.URLCache) (string, error) {
-	url, found := cache.Get(objectKey)
+	return s.GenerateDownloadLinkWithExpiry(objectKey, cache, s.downloadExpiry)
+}
+
+// GenerateDownloadLinkWithExpiry generates a signed download URL valid for the given lifetime.
+// Cached URLs are keyed by lifetime and only reused for the first half of it, so a
+// caller never receives a URL with less than half of the lifetime it asked for.
+func (s *S3) GenerateDownloadLinkWithExpiry(objectKey string, cache *cache.URLCache, expiryTime time.Duration) (string, error) {
+	expiryTime = ClampPresignExpiry(expiryTime)
+	cacheKey := fmt.Sprintf("%s|%d", objectKey, int64(expiryTime.Seconds()))
+
+	url, found := cache.Get(cacheKey)
 
 	// Check if the URL is already in the cache and valid
 	if found {
 		return url, nil
 	}
 
-	expiryTime := 15 * time.Minute
-
 	req, _ := s.svc.GetObjectRequest(&s3.GetObjectInput{
 		Bucket:              aws.String(s.bucketName),
 		Key:                 aws.String(objectKey),
@@ -290,12 +342,86 @@ func (s *S3) GenerateDownloadLink(objectKey string, cache *cache.URLCache) (stri
 		return "", err
 	}
 
-	// Cache the URL with its expiration time
-	cache.Set(objectKey, downloadURL, time.Now().Add(expiryTime))
+	// Cache the URL for half of its validity period
+	cache.Set(cacheKey, downloadURL, time.Now().Add(expiryTime/2))
 
 	return downloadURL, nil
 }
 
+// GetObjectSize returns the size in bytes of an object in the bucket.
+func (s *S3) GetObjectSize(objectKey string) (int64, error) {
+	stat, err := s.StatObject(objectKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return stat.Size, nil
+}
+
+// StatObject returns the size and user metadata of an object in the bucket.
+// Metadata keys are lowercased, without the x-amz-meta- prefix.
+func (s *S3) StatObject(objectKey string) (*ObjectStat, error) {
+	head, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stat := &ObjectStat{
+		Size:     aws.Int64Value(head.ContentLength),
+		Metadata: make(map[string]string, len(head.Metadata)),
+	}
+	for key, value := range head.Metadata {
+		stat.Metadata[strings.ToLower(key)] = aws.StringValue(value)
+	}
+
+	return stat, nil
+}
+
+// ReplaceObjectMetadata rewrites the user metadata of an object by copying it onto itself.
+// The content type is carried over since a metadata replace would otherwise reset it.
+func (s *S3) ReplaceObjectMetadata(objectKey string, metadata map[string]string) error {
+	head, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	source := (&url.URL{Path: s.bucketName + "/" + objectKey}).EscapedPath()
+	_, err = s.svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucketName),
+		Key:               aws.String(objectKey),
+		CopySource:        aws.String(source),
+		ContentType:       head.ContentType,
+		Metadata:          aws.StringMap(metadata),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	})
+	return err
+}
+
+// OpenObject starts reading an object from the bucket.
+func (s *S3) OpenObject(objectKey string) (*ObjectReader, error) {
+	result, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectReader{
+		Body:          result.Body,
+		ContentType:   aws.StringValue(result.ContentType),
+		ContentLength: aws.Int64Value(result.ContentLength),
+		ETag:          aws.StringValue(result.ETag),
+		LastModified:  aws.TimeValue(result.LastModified),
+	}, nil
+}
+
 // DeleteObject deletes an object from the S3 bucket.
 func (s *S3) DeleteObject(objectKey string) error {
 	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
@@ -44,6 +44,21 @@ type S3UploadPayload struct {
 	FolderPath string `json:"folderPath"`
 }
 
+// ObjectStat holds the size and user metadata of a stored object
+type ObjectStat struct {
+	Size     int64
+	Metadata map[string]string
+}
+
+// ObjectReader streams an object's content along with the headers needed to serve it.
+// The caller must close Body.
+type ObjectReader struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	ETag          string
+	LastModified  time.Time
+}
 
 type FileInfo struct {
 	Name     string `json:"name"`
@@ -58,6 +73,11 @@ type FilterOptions struct {
 	FilenameFilterType string
 	FileSize           int64
 	FileSizeFilterType string
+	MimeTypes          []string // exact ("image/png") or wildcard ("image/*"), resolved from the extension
+	SizeGreaterThan    *int64
+	SizeLessThan       *int64
+	ModifiedAfter      *time.Time
+	ModifiedBefore     *time.Time
 }
 
 type FilterSizeRange struct {
@@ -65,7 +85,6 @@ type FilterSizeRange struct {
 	MaxSize int64
 }
 
-
 // FileUploadInput represents input for a single file in batch upload
 type FileUploadInput struct {
 	Reader    io.Reader
@@ -2,12 +2,12 @@ package s3
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
-
-	"github.com/labstack/echo/v4"
 )
 
 func GetFailureResponse(err error) FailureResponse {
@@ -43,61 +43,49 @@ func GetSuccessResponseWithData(data interface{}) SuccessResponse {
 	}
 }
 
+// MatchMimeType reports whether a mime type matches a pattern such as "image/png" or "image/*".
+func MatchMimeType(mimeType, pattern string) bool {
+	mimeType = strings.ToLower(mimeType)
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))
+	}
+	return mimeType == pattern
+}
+
 // formatPanicError formats a panic recovery value into a user-friendly error message
 func formatPanicError(r interface{}) string {
 	return fmt.Sprintf("panic: %v", r)
 }
 
-// custom function to sort the files by name or last modified
-func SortFiles(files []ObjectDetails, c echo.Context) *[]ObjectDetails {
-	sortBy := c.QueryParam("sortBy")
-	order := c.QueryParam("order")
-
+// custom function to sort the files by name, last modified, type (folders first) or size
+func SortFiles(files []ObjectDetails, sortBy string, order string) *[]ObjectDetails {
 	if sortBy == "" {
 		sortBy = "name"
 	}
+	desc := order != "asc"
+
+	var less func(a, b ObjectDetails) bool
+	switch sortBy {
+	case "name":
+		less = func(a, b ObjectDetails) bool { return a.Name < b.Name }
+	case "date", "created_at":
+		less = func(a, b ObjectDetails) bool { return a.LastModified.Before(b.LastModified) }
+	case "type":
+		// ascending puts folders first
+		less = func(a, b ObjectDetails) bool { return a.IsFolder && !b.IsFolder }
+	case "size":
+		less = func(a, b ObjectDetails) bool { return a.Size < b.Size }
+	default:
+		return &files
+	}
 
-	if sortBy == "name" {
-		if order == "asc" {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].Name < files[j].Name
-			})
-		} else {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].Name > files[j].Name
-			})
+	sort.SliceStable(files, func(i, j int) bool {
+		if desc {
+			return less(files[j], files[i])
 		}
-	} else if sortBy == "date" {
-		if order == "asc" {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].LastModified.Before(files[j].LastModified)
-			})
-		} else {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].LastModified.After(files[j].LastModified)
-			})
-		}
-	} else if sortBy == "type" {
-		if order == "asc" {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].IsFolder
-			})
-		} else {
-			sort.Slice(files, func(i, j int) bool {
-				return !files[i].IsFolder
-			})
-		}
-	} else if sortBy == "size" {
-		if order == "asc" {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].Size < files[j].Size
-			})
-		} else {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].Size > files[j].Size
-			})
-		}
-	}
+		return less(files[i], files[j])
+	})
 
 	return &files
 }
@@ -108,7 +96,7 @@ func FilterFiles(files []ObjectDetails, options FilterOptions) *[]ObjectDetails
 	filterFilesBySizeRange := func(sizeRange string, files []ObjectDetails) *[]ObjectDetails {
 		rangeValues, found := sizeRanges[sizeRange]
 		if !found {
-			return nil // Invalid size range
+			return &[]ObjectDetails{} // Invalid size range matches nothing
 		}
 
 		var filesInRange []ObjectDetails
@@ -123,7 +111,7 @@ func FilterFiles(files []ObjectDetails, options FilterOptions) *[]ObjectDetails
 	filterFilesByTimeRange := func(dateRange string, files []ObjectDetails) *[]ObjectDetails {
 		duration, found := timeRanges[dateRange]
 		if !found {
-			return nil // Invalid date range
+			return &[]ObjectDetails{} // Invalid date range matches nothing
 		}
 
 		var filesInRange []ObjectDetails
@@ -140,13 +128,13 @@ func FilterFiles(files []ObjectDetails, options FilterOptions) *[]ObjectDetails
 	filterFilesByTypes := func(fileTypes []string, files []ObjectDetails) *[]ObjectDetails {
 		var filesInRange []ObjectDetails
 		for _, file := range files {
-			// get the file extension by splitting the file name and picking the last element
-			ext := strings.Split(file.Name, ".")[len(strings.Split(file.Name, "."))-1]
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Name), "."))
 
 			// check if the file extension is present in the fileTypes array
 			for _, fileType := range fileTypes {
-				if fileType == ext {
+				if strings.ToLower(strings.TrimPrefix(fileType, ".")) == ext {
 					filesInRange = append(filesInRange, file)
+					break
 				}
 			}
 		}
@@ -185,11 +173,11 @@ func FilterFiles(files []ObjectDetails, options FilterOptions) *[]ObjectDetails
 		for _, file := range files {
 			switch filterType {
 			case "gt":
-				if file.Size >= fileSize {
+				if file.Size > fileSize {
 					filesInRange = append(filesInRange, file)
 				}
 			case "gte":
-				if file.Size > fileSize {
+				if file.Size >= fileSize {
 					filesInRange = append(filesInRange, file)
 				}
 			case "lt":
@@ -210,6 +198,42 @@ func FilterFiles(files []ObjectDetails, options FilterOptions) *[]ObjectDetails
 		return &filesInRange
 	}
 
+	filterFilesByMimeTypes := func(mimeTypes []string, files []ObjectDetails) *[]ObjectDetails {
+		var filesInRange []ObjectDetails
+		for _, file := range files {
+			fileType := mime.TypeByExtension(filepath.Ext(file.Name))
+			if fileType == "" {
+				continue
+			}
+			// drop parameters such as "; charset=utf-8"
+			fileType = strings.TrimSpace(strings.SplitN(fileType, ";", 2)[0])
+
+			for _, mimeType := range mimeTypes {
+				if MatchMimeType(fileType, mimeType) {
+					filesInRange = append(filesInRange, file)
+					break
+				}
+			}
+		}
+
+		return &filesInRange
+	}
+
+	filterFilesByModified := func(after, before *time.Time, files []ObjectDetails) *[]ObjectDetails {
+		var filesInRange []ObjectDetails
+		for _, file := range files {
+			if after != nil && !file.LastModified.After(*after) {
+				continue
+			}
+			if before != nil && !file.LastModified.Before(*before) {
+				continue
+			}
+			filesInRange = append(filesInRange, file)
+		}
+
+		return &filesInRange
+	}
+
 	// Filter by size range
 	if options.SizeRange != "" {
 		filteredFiles = *filterFilesBySizeRange(options.SizeRange, files)
@@ -237,5 +261,27 @@ func FilterFiles(files []ObjectDetails, options FilterOptions) *[]ObjectDetails
 		filteredFiles = *filterFilesByFileSize(options.FileSize, options.FileSizeFilterType, filteredFiles)
 	}
 
+	// Filter by size bounds
+	if options.SizeGreaterThan != nil {
+		filteredFiles = *filterFilesByFileSize(*options.SizeGreaterThan, "gt", filteredFiles)
+	}
+	if options.SizeLessThan != nil {
+		filteredFiles = *filterFilesByFileSize(*options.SizeLessThan, "lt", filteredFiles)
+	}
+
+	// Filter by mime type
+	if len(options.MimeTypes) > 0 {
+		filteredFiles = *filterFilesByMimeTypes(options.MimeTypes, filteredFiles)
+	}
+
+	// Filter by last modified bounds
+	if options.ModifiedAfter != nil || options.ModifiedBefore != nil {
+		filteredFiles = *filterFilesByModified(options.ModifiedAfter, options.ModifiedBefore, filteredFiles)
+	}
+
+	if filteredFiles == nil {
+		filteredFiles = []ObjectDetails{}
+	}
+
 	return &filteredFiles
 }
@@ -0,0 +1,143 @@
+// Package workflow defines the publishing lifecycle of assets: a fixed set of
+// states and a per-project list of transitions, each limited to member roles.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+)
+
+// State is a step in an asset's publishing lifecycle.
+type State string
+
+const (
+	StateDraft     State = "draft"
+	StateInReview  State = "in_review"
+	StateApproved  State = "approved"
+	StateRejected  State = "rejected"
+	StatePublished State = "published"
+	StateArchived  State = "archived"
+)
+
+// InitialState is the state of every new asset and version.
+const InitialState = StateDraft
+
+var states = map[State]bool{
+	StateDraft:     true,
+	StateInReview:  true,
+	StateApproved:  true,
+	StateRejected:  true,
+	StatePublished: true,
+	StateArchived:  true,
+}
+
+// Roles are the project member roles a transition can be granted to.
+var roles = map[string]bool{
+	"owner":  true,
+	"editor": true,
+	"viewer": true,
+}
+
+var (
+	// ErrTransitionNotDefined is returned when the workflow has no transition between two states.
+	ErrTransitionNotDefined = errors.New("transition not allowed by the project workflow")
+	// ErrRoleNotAllowed is returned when the transition exists but not for the member's role.
+	ErrRoleNotAllowed = errors.New("your role cannot perform this transition")
+)
+
+// ValidState reports whether s is a known state.
+func ValidState(s State) bool {
+	return states[s]
+}
+
+// Transition moves an asset from one state to another. Only members whose
+// role is listed may perform it.
+type Transition struct {
+	From  State    `json:"from"`
+	To    State    `json:"to"`
+	Roles []string `json:"roles"`
+}
+
+// Definition is a project's workflow.
+type Definition struct {
+	Transitions []Transition `json:"transitions"`
+}
+
+// Default returns the workflow used by projects that have not configured one.
+func Default() Definition {
+	return Definition{Transitions: []Transition{
+		{From: StateDraft, To: StateInReview, Roles: []string{"owner", "editor"}},
+		{From: StateInReview, To: StateDraft, Roles: []string{"owner", "editor"}},
+		{From: StateInReview, To: StateApproved, Roles: []string{"owner"}},
+		{From: StateInReview, To: StateRejected, Roles: []string{"owner"}},
+		{From: StateRejected, To: StateDraft, Roles: []string{"owner", "editor"}},
+		{From: StateApproved, To: StatePublished, Roles: []string{"owner"}},
+		{From: StatePublished, To: StateArchived, Roles: []string{"owner"}},
+		{From: StateArchived, To: StateDraft, Roles: []string{"owner"}},
+	}}
+}
+
+// Check reports problems with the definition, one message per transition.
+func (d Definition) Check() []string {
+	var problems []string
+	if len(d.Transitions) == 0 {
+		problems = append(problems, "declare at least one transition")
+	}
+
+	seen := make(map[[2]State]bool)
+	for i, t := range d.Transitions {
+		label := fmt.Sprintf("transitions[%d]", i)
+		if !states[t.From] {
+			problems = append(problems, fmt.Sprintf("%s: unknown state %q", label, t.From))
+		}
+		if !states[t.To] {
+			problems = append(problems, fmt.Sprintf("%s: unknown state %q", label, t.To))
+		}
+		if t.From == t.To {
+			problems = append(problems, fmt.Sprintf("%s: from and to must differ", label))
+		}
+		key := [2]State{t.From, t.To}
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate transition %s -> %s", label, t.From, t.To))
+		}
+		seen[key] = true
+		if len(t.Roles) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: list at least one role", label))
+		}
+		for _, role := range t.Roles {
+			if !roles[role] {
+				problems = append(problems, fmt.Sprintf("%s: unknown role %q", label, role))
+			}
+		}
+	}
+
+	return problems
+}
+
+// Authorize returns nil when a member with role may move an asset from one
+// state to another, ErrTransitionNotDefined or ErrRoleNotAllowed otherwise.
+func (d Definition) Authorize(from, to State, role string) error {
+	for _, t := range d.Transitions {
+		if t.From != from || t.To != to {
+			continue
+		}
+		for _, allowed := range t.Roles {
+			if allowed == role {
+				return nil
+			}
+		}
+		return ErrRoleNotAllowed
+	}
+	return ErrTransitionNotDefined
+}
+
+// Available returns the states a member with role may move an asset to from the given state.
+func (d Definition) Available(from State, role string) []State {
+	next := make([]State, 0)
+	for _, t := range d.Transitions {
+		if t.From == from && d.Authorize(t.From, t.To, role) == nil {
+			next = append(next, t.To)
+		}
+	}
+	return next
+}
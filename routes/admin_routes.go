@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"file-service/pkg/middleware"
+	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// allowTenantPathsParam explicitly overrides the tenant prefix guard on storage routes.
+const allowTenantPathsParam = "allow_tenant_paths"
+
+type AdminRoutes struct {
+	auditRepo *repository.AuditRepository
+}
+
+func NewAdminRoutes(auditRepo *repository.AuditRepository) *AdminRoutes {
+	return &AdminRoutes{auditRepo: auditRepo}
+}
+
+// isTenantPath reports whether a bucket path lives under a tenant prefix.
+// Multi-tenant objects are keyed as <client-uuid>/<project-uuid>/..., see buildS3Key.
+func isTenantPath(path string) bool {
+	first := strings.SplitN(strings.TrimLeft(path, "/"), "/", 2)[0]
+	if first == "" {
+		return false
+	}
+	_, err := uuid.Parse(first)
+	return err == nil
+}
+
+// guardStoragePaths refuses bucket paths inside tenant prefixes unless the caller
+// passed allow_tenant_paths=true. The targets and any override are added to the audit entry.
+func guardStoragePaths(c echo.Context, paths ...string) error {
+	middleware.AddAuditDetail(c, "paths", paths)
+
+	override, _ := strconv.ParseBool(c.QueryParam(allowTenantPathsParam))
+	for _, path := range paths {
+		if !isTenantPath(path) {
+			continue
+		}
+		if !override {
+			return fmt.Errorf("path %q is inside a tenant prefix; pass %s=true to override", path, allowTenantPathsParam)
+		}
+		middleware.AddAuditDetail(c, "tenant_override", true)
+	}
+
+	return nil
+}
+
+// hideTenantObjects drops listed objects inside tenant prefixes unless the caller passed
+// allow_tenant_paths=true. Listings from the bucket root pass guardStoragePaths, so their results are filtered instead.
+func hideTenantObjects(c echo.Context, objects []s3.ObjectDetails) []s3.ObjectDetails {
+	if override, _ := strconv.ParseBool(c.QueryParam(allowTenantPathsParam)); override {
+		return objects
+	}
+
+	visible := make([]s3.ObjectDetails, 0, len(objects))
+	for _, object := range objects {
+		if !isTenantPath(object.Name) {
+			visible = append(visible, object)
+		}
+	}
+	return visible
+}
+
+// ListAuditLog returns the admin audit trail, newest first
+func (ar *AdminRoutes) ListAuditLog(c echo.Context) error {
+	limit := parseIntQueryParam(c.QueryParam("limit"), 50)
+	offset := parseIntQueryParam(c.QueryParam("offset"), 0)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := ar.auditRepo.ListAuditEntries(strings.TrimSpace(c.QueryParam("action")), limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list audit entries"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"entries": entries,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,286 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/cache"
+	"file-service/pkg/models"
+	"file-service/pkg/rbac"
+	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// latestAliasMaxAge is how long clients may cache an alias that follows the latest version
+	latestAliasMaxAge = time.Minute
+	// versionedAliasMaxAge is how long clients may cache a stream of an explicit version, which never changes
+	versionedAliasMaxAge = 365 * 24 * time.Hour
+)
+
+type AliasRoutes struct {
+	aliasRepo   *repository.AliasRepository
+	assetRepo   *repository.AssetRepository
+	projectRepo *repository.ProjectRepository
+	memberRepo  *repository.MemberRepository
+	access      *folderAccess
+	s3Client    *s3.S3
+	urlCache    *cache.URLCache
+}
+
+func NewAliasRoutes(aliasRepo *repository.AliasRepository, assetRepo *repository.AssetRepository, projectRepo *repository.ProjectRepository, memberRepo *repository.MemberRepository, aclRepo *repository.FolderACLRepository, checker *rbac.RBACChecker, s3Client *s3.S3, urlCache *cache.URLCache) *AliasRoutes {
+	return &AliasRoutes{
+		aliasRepo:   aliasRepo,
+		assetRepo:   assetRepo,
+		projectRepo: projectRepo,
+		memberRepo:  memberRepo,
+		access:      newFolderAccess(memberRepo, aclRepo, checker),
+		s3Client:    s3Client,
+		urlCache:    urlCache,
+	}
+}
+
+// aliasPath returns the stable path that resolves to the asset's chain
+func aliasPath(project *models.Project, asset *repository.Asset) string {
+	segments := strings.Split(strings.Trim(asset.FolderPath, "/"), "/")
+	escaped := make([]string, 0, len(segments)+1)
+	for _, segment := range segments {
+		if segment != "" {
+			escaped = append(escaped, url.PathEscape(segment))
+		}
+	}
+	escaped = append(escaped, url.PathEscape(asset.OriginalFilename))
+	return "/p/" + project.Slug + "/" + strings.Join(escaped, "/")
+}
+
+// splitAliasPath turns the wildcard part of an alias into a folder path and filename
+func splitAliasPath(raw string) (string, string, error) {
+	unescaped, err := url.PathUnescape(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid path")
+	}
+
+	unescaped = strings.TrimPrefix(unescaped, "/")
+	if unescaped == "" || strings.HasSuffix(unescaped, "/") {
+		return "", "", fmt.Errorf("path must name a file")
+	}
+	for _, segment := range strings.Split(unescaped, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", "", fmt.Errorf("invalid path")
+		}
+	}
+
+	dir, file := path.Split(unescaped)
+	return normalizeFolderPath(dir), file, nil
+}
+
+// ResolveAlias serves the asset at /p/:project_slug/<folder path>/<original filename>.
+// It follows the latest version unless the chain is pinned or ?v=<version> names one,
+// and redirects to a presigned URL unless ?stream=true asks for the content itself.
+func (ar *AliasRoutes) ResolveAlias(c echo.Context) error {
+	project, err := ar.projectRepo.GetProjectBySlug(c.Param("project_slug"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+
+	if clientID, _ := c.Get("client_id").(string); !project.PublicAliases && clientID == "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+
+	folderPath, filename, err := splitAliasPath(c.Param("*"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	asset, err := ar.aliasRepo.ResolvePath(project.ID, folderPath, filename)
+	if err != nil || !ar.canRead(c, project, asset) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+
+	versioned := false
+	if raw := c.QueryParam("v"); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil || version <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "v must be a positive version number"})
+		}
+		if asset, err = ar.aliasRepo.GetChainVersion(rootAssetID(asset), version); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "version not found"})
+		}
+		versioned = true
+	} else {
+		pinned, err := ar.aliasRepo.GetPinnedVersion(rootAssetID(asset))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to resolve alias"})
+		}
+		if pinned != nil {
+			asset = pinned
+		}
+	}
+	// Versions of a chain may live in other folders than the one the path resolved in
+	if !ar.canRead(c, project, asset) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+
+	visibility := "public"
+	if !project.PublicAliases {
+		visibility = "private"
+		c.Response().Header().Add("Vary", "Authorization, X-API-Key")
+	}
+	c.Response().Header().Set("X-Asset-Id", asset.ID)
+	c.Response().Header().Set("X-Asset-Version", strconv.Itoa(asset.Version))
+
+	if stream, _ := strconv.ParseBool(c.QueryParam("stream")); stream {
+		maxAge := latestAliasMaxAge
+		if versioned {
+			maxAge = versionedAliasMaxAge
+		}
+		return ar.streamAsset(c, asset, fmt.Sprintf("%s, max-age=%d", visibility, int(maxAge.Seconds())))
+	}
+
+	ttl := resolveURLLimits(ar.s3Client, project).downloadTTL
+	presignedURL, err := ar.s3Client.GenerateDownloadLinkWithExpiry(asset.S3Key, ar.urlCache, ttl)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate download url"})
+	}
+
+	// The presigned URL may be reused from cache for up to half its lifetime, so the redirect must expire sooner
+	maxAge := ttl / 2
+	if !versioned && maxAge > latestAliasMaxAge {
+		maxAge = latestAliasMaxAge
+	}
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, int(maxAge.Seconds())))
+
+	return c.Redirect(http.StatusFound, presignedURL)
+}
+
+// canRead reports whether the caller may read the asset through an alias of the project.
+// Public aliases are open to anyone; private ones need read access to the asset's folder.
+func (ar *AliasRoutes) canRead(c echo.Context, project *models.Project, asset *repository.Asset) bool {
+	if project.PublicAliases {
+		return true
+	}
+	_, err := ar.access.authorizeAsset(c, asset, folderRead)
+	return err == nil
+}
+
+// streamAsset copies the object to the response with validators for conditional requests
+func (ar *AliasRoutes) streamAsset(c echo.Context, asset *repository.Asset, cacheControl string) error {
+	object, err := ar.s3Client.OpenObject(asset.S3Key)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+	defer object.Body.Close()
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", cacheControl)
+	if object.ETag != "" {
+		header.Set("ETag", object.ETag)
+	}
+	if !object.LastModified.IsZero() {
+		header.Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if object.ETag != "" && c.Request().Header.Get("If-None-Match") == object.ETag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	contentType := asset.MimeType
+	if contentType == "" {
+		contentType = object.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"filename": asset.OriginalFilename}))
+	if object.ContentLength > 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(object.ContentLength, 10))
+	}
+
+	c.Response().WriteHeader(http.StatusOK)
+	if c.Request().Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(c.Response(), object.Body); err != nil {
+		log.Printf("alias stream failed for %s: %v", asset.ID, err)
+	}
+	return nil
+}
+
+// loadChain fetches the asset named by :id and checks the caller may write to its folder
+func (ar *AliasRoutes) loadChain(c echo.Context) (*repository.Asset, *models.Project, bool, error) {
+	asset, err := ar.assetRepo.FindAssetByID(c.Param("id"))
+	if err != nil {
+		return nil, nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if _, err := ar.access.authorizeAsset(c, asset, folderWrite); err != nil {
+		if errors.Is(err, rbac.ErrDenied) {
+			return nil, nil, false, c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		}
+		return nil, nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	project, err := ar.projectRepo.FindProjectByID(asset.ProjectID)
+	if err != nil {
+		return nil, nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	return asset, project, true, nil
+}
+
+// chainAliasPath returns the alias of a chain, which follows the path of its latest version
+func (ar *AliasRoutes) chainAliasPath(project *models.Project, asset *repository.Asset) string {
+	if latest, err := ar.aliasRepo.GetLatestVersion(rootAssetID(asset)); err == nil {
+		asset = latest
+	}
+	return aliasPath(project, asset)
+}
+
+// PinVersion makes the alias of an asset's chain resolve to this version
+func (ar *AliasRoutes) PinVersion(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	asset, project, ok, err := ar.loadChain(c)
+	if !ok {
+		return err
+	}
+
+	if err := ar.aliasRepo.PinVersion(rootAssetID(asset), asset.ID, clientID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to pin version"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"message":        "version pinned",
+		"alias":          ar.chainAliasPath(project, asset),
+		"pinned_version": asset.Version,
+		"asset_id":       asset.ID,
+	})
+}
+
+// UnpinVersion makes the alias of an asset's chain follow the latest version again
+func (ar *AliasRoutes) UnpinVersion(c echo.Context) error {
+	asset, project, ok, err := ar.loadChain(c)
+	if !ok {
+		return err
+	}
+
+	if err := ar.aliasRepo.UnpinVersion(rootAssetID(asset)); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to unpin version"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"message": "alias follows the latest version",
+		"alias":   ar.chainAliasPath(project, asset),
+	})
+}
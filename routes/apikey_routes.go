@@ -1,19 +1,55 @@
 package routes
 
 import (
+	"errors"
+	mailerpkg "file-service/pkg/mailer"
+	mailerproviders "file-service/pkg/mailer/providers"
+	"file-service/pkg/middleware"
+	"file-service/pkg/models"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
 	"file-service/pkg/repository"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+// maxRotationGrace bounds how long a rotated key may keep working next to its successor
+const maxRotationGrace = 30 * 24 * time.Hour
+
+// usageIntervals are the bucket sizes of the usage endpoint with the longest range each may cover
+var usageIntervals = map[string]time.Duration{
+	"hour": 31 * 24 * time.Hour,
+	"day":  366 * 24 * time.Hour,
+}
+
 type APIKeyRoutes struct {
-	apiKeyRepo *repository.APIKeyRepository
+	apiKeyRepo    *repository.APIKeyRepository
+	usageRepo     *repository.APIKeyUsageRepository
+	verifier      *middleware.RequestVerifier
+	access        *projectAccess
+	mailer        *mailerpkg.EmailService
+	rotationGrace time.Duration
+	expiryWarning time.Duration
+	appName       string
 }
 
-func NewAPIKeyRoutes(apiKeyRepo *repository.APIKeyRepository) *APIKeyRoutes {
-	return &APIKeyRoutes{apiKeyRepo: apiKeyRepo}
+func NewAPIKeyRoutes(apiKeyRepo *repository.APIKeyRepository, usageRepo *repository.APIKeyUsageRepository, verifier *middleware.RequestVerifier, memberRepo *repository.MemberRepository, checker *rbac.RBACChecker, mailer *mailerpkg.EmailService, rotationGrace time.Duration, expiryWarning time.Duration, appName string) *APIKeyRoutes {
+	return &APIKeyRoutes{
+		apiKeyRepo:    apiKeyRepo,
+		usageRepo:     usageRepo,
+		verifier:      verifier,
+		access:        newProjectAccess(memberRepo, checker),
+		mailer:        mailer,
+		rotationGrace: rotationGrace,
+		expiryWarning: expiryWarning,
+		appName:       appName,
+	}
 }
 
 // CreateAPIKey generates a new API key
@@ -25,6 +61,7 @@ func (ar *APIKeyRoutes) CreateAPIKey(c echo.Context) error {
 		Name        string   `json:"name"`
 		Permissions []string `json:"permissions"`
 		ExpiresIn   *int     `json:"expires_in_days"` // optional, days until expiration
+		models.APIKeyScopes
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -34,18 +71,38 @@ func (ar *APIKeyRoutes) CreateAPIKey(c echo.Context) error {
 	if req.ProjectID == "" || req.Name == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id and name required"})
 	}
+	if req.ExpiresIn != nil && *req.ExpiresIn < 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in_days must be at least 1"})
+	}
+
+	if _, err := ar.access.authorize(c, req.ProjectID, presets.ResourceAPIKey, presets.ActionWrite); err != nil {
+		return ar.access.respond(c, err)
+	}
 
 	if len(req.Permissions) == 0 {
 		req.Permissions = []string{"read"} // default permission
 	}
 
+	permissions := make([]rbac.Permission, len(req.Permissions))
+	for i, perm := range req.Permissions {
+		permissions[i] = rbac.Permission(perm)
+	}
+	if err := ar.access.checker.ValidatePermissions(permissions); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error() + " (read, write, delete)"})
+	}
+
+	scopes, err := normalizeAPIKeyScopes(req.APIKeyScopes)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	var expiresAt *time.Time
 	if req.ExpiresIn != nil {
 		exp := time.Now().AddDate(0, 0, *req.ExpiresIn)
 		expiresAt = &exp
 	}
 
-	key, apiKey, err := ar.apiKeyRepo.CreateAPIKey(clientID, req.ProjectID, req.Name, req.Permissions, expiresAt)
+	key, apiKey, err := ar.apiKeyRepo.CreateAPIKey(clientID, req.ProjectID, req.Name, req.Permissions, scopes, expiresAt)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create API key"})
 	}
@@ -56,27 +113,387 @@ func (ar *APIKeyRoutes) CreateAPIKey(c echo.Context) error {
 	})
 }
 
-// GetAPIKeys retrieves all API keys for authenticated client
+// apiKeyMethods are the HTTP methods a key can be restricted to
+var apiKeyMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// normalizeAPIKeyScopes validates requested key scopes and brings them into their stored form:
+// folders as normalized paths, bare addresses as single-host networks and methods in upper case
+func normalizeAPIKeyScopes(scopes models.APIKeyScopes) (models.APIKeyScopes, error) {
+	normalized := models.APIKeyScopes{RateLimitPerMinute: scopes.RateLimitPerMinute}
+
+	for _, folder := range scopes.AllowedFolders {
+		for _, segment := range strings.Split(strings.Trim(folder, "/"), "/") {
+			if segment == "." || segment == ".." {
+				return normalized, fmt.Errorf("invalid folder in allowed_folders: %q", folder)
+			}
+		}
+		normalized.AllowedFolders = append(normalized.AllowedFolders, normalizeFolderPath(strings.TrimSpace(folder)))
+	}
+
+	for _, cidr := range scopes.AllowedCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			cidr = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return normalized, fmt.Errorf("invalid network in allowed_cidrs: %q", cidr)
+		}
+		normalized.AllowedCIDRs = append(normalized.AllowedCIDRs, network.String())
+	}
+
+	for _, method := range scopes.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !apiKeyMethods[method] {
+			return normalized, fmt.Errorf("invalid method in allowed_methods: %q", method)
+		}
+		normalized.AllowedMethods = append(normalized.AllowedMethods, method)
+	}
+
+	if scopes.RateLimitPerMinute != nil && *scopes.RateLimitPerMinute <= 0 {
+		return normalized, fmt.Errorf("rate_limit_per_minute must be positive")
+	}
+
+	return normalized, nil
+}
+
+// GetAPIKeys retrieves the API keys of the authenticated client.
+// With project_id it lists that project's keys: all of them for roles that manage keys, otherwise the caller's own.
 func (ar *APIKeyRoutes) GetAPIKeys(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
+	projectID := c.QueryParam("project_id")
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	owner := clientID
+	if projectID != "" {
+		role, err := ar.access.authorize(c, projectID, presets.ResourceAPIKey, presets.ActionRead)
+		if err != nil {
+			return ar.access.respond(c, err)
+		}
+		if ar.access.allows(role, presets.ResourceAPIKey, presets.ActionManage) == nil {
+			owner = ""
+		}
+	}
 
-	keys, err := ar.apiKeyRepo.GetAPIKeysByClientID(clientID)
+	keys, info, err := ar.apiKeyRepo.GetAPIKeys(owner, projectID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get API keys"})
 	}
 
-	return c.JSON(http.StatusOK, keys)
+	return c.JSON(http.StatusOK, pageResponse("api_keys", keys, page, info))
 }
 
-// RevokeAPIKey deactivates an API key
-func (ar *APIKeyRoutes) RevokeAPIKey(c echo.Context) error {
+// loadManagedKey fetches the API key named by :id when the caller created it or manages the project's keys.
+// When it cannot, the error response has already been written.
+func (ar *APIKeyRoutes) loadManagedKey(c echo.Context) (*models.APIKey, bool, error) {
 	clientID := c.Get("client_id").(string)
-	keyID := c.Param("id")
 
-	err := ar.apiKeyRepo.RevokeAPIKey(keyID, clientID)
+	key, err := ar.apiKeyRepo.GetAPIKeyByID(c.Param("id"))
 	if err != nil {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+
+	if key.ClientID != clientID {
+		if key.ProjectID == nil {
+			return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+		}
+		if _, err := ar.access.authorize(c, *key.ProjectID, presets.ResourceAPIKey, presets.ActionManage); err != nil {
+			if errors.Is(err, errNotMember) {
+				return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+			}
+			return nil, false, ar.access.respond(c, err)
+		}
+	}
+
+	return key, true, nil
+}
+
+// RevokeAPIKey deactivates an API key; its creator or a role that manages the project's keys may revoke it
+func (ar *APIKeyRoutes) RevokeAPIKey(c echo.Context) error {
+	key, ok, err := ar.loadManagedKey(c)
+	if !ok {
+		return err
+	}
+
+	if err := ar.apiKeyRepo.RevokeAPIKey(key.ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "API key revoked"})
 }
+
+// GetAPIKeyUsage returns a key's requests, errors and uploaded bytes per hour or day bucket, and per route and status.
+// Buckets without traffic are included with zero counts so gaps show up in the series.
+func (ar *APIKeyRoutes) GetAPIKeyUsage(c echo.Context) error {
+	key, ok, err := ar.loadManagedKey(c)
+	if !ok {
+		return err
+	}
+
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "hour"
+	}
+	maxRange, ok := usageIntervals[interval]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "interval must be hour or day"})
+	}
+
+	to := time.Now().UTC()
+	if raw := c.QueryParam("to"); raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be an RFC 3339 timestamp"})
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if interval == "day" {
+		from = to.AddDate(0, 0, -30)
+	}
+	if raw := c.QueryParam("from"); raw != "" {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be an RFC 3339 timestamp"})
+		}
+	}
+	from, to = truncateUsageBucket(from.UTC(), interval), to.UTC()
+	if !from.Before(to) || to.Sub(from) > maxRange {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("from must be before to and at most %d days earlier for %s buckets", int(maxRange.Hours()/24), interval)})
+	}
+
+	points, err := ar.usageRepo.GetUsageSeries(key.ID, from, to, interval)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get API key usage"})
+	}
+	routes, err := ar.usageRepo.GetUsageByRoute(key.ID, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get API key usage"})
+	}
+
+	var totals models.APIKeyUsagePoint
+	totals.Bucket = from
+	byBucket := make(map[time.Time]models.APIKeyUsagePoint, len(points))
+	for _, point := range points {
+		byBucket[point.Bucket.UTC()] = point
+		totals.Requests += point.Requests
+		totals.ClientErrors += point.ClientErrors
+		totals.ServerErrors += point.ServerErrors
+		totals.BytesUploaded += point.BytesUploaded
+	}
+
+	series := make([]models.APIKeyUsagePoint, 0)
+	for bucket := from; bucket.Before(to); bucket = nextUsageBucket(bucket, interval) {
+		point := byBucket[bucket]
+		point.Bucket = bucket
+		series = append(series, point)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"api_key_id":   key.ID,
+		"last_used_at": key.LastUsedAt,
+		"interval":     interval,
+		"from":         from,
+		"to":           to,
+		"totals":       totals,
+		"series":       series,
+		"routes":       routes,
+	})
+}
+
+// truncateUsageBucket returns the start of the hour or day bucket containing t
+func truncateUsageBucket(t time.Time, interval string) time.Time {
+	if interval == "day" {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// nextUsageBucket returns the start of the bucket after the one starting at t
+func nextUsageBucket(t time.Time, interval string) time.Time {
+	if interval == "day" {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// RotateAPIKey issues a successor with the same name, project, permissions and scopes.
+// The old key keeps working for grace_period_hours (API_KEY_ROTATION_GRACE_HOURS by default) and is then deactivated.
+func (ar *APIKeyRoutes) RotateAPIKey(c echo.Context) error {
+	key, ok, err := ar.loadManagedKey(c)
+	if !ok {
+		return err
+	}
+	if key.ProjectID == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "API keys without a project cannot be rotated"})
+	}
+
+	// The creator still needs to be allowed to create keys in the project
+	if _, err := ar.access.authorize(c, *key.ProjectID, presets.ResourceAPIKey, presets.ActionWrite); err != nil {
+		return ar.access.respond(c, err)
+	}
+
+	var req struct {
+		GracePeriodHours *int `json:"grace_period_hours"`
+		ExpiresIn        *int `json:"expires_in_days"` // optional; defaults to the old key's lifetime
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	// A successor that is already expired would leave nothing working once the grace period ends
+	if req.ExpiresIn != nil && *req.ExpiresIn < 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in_days must be at least 1"})
+	}
+
+	grace := ar.rotationGrace
+	if req.GracePeriodHours != nil {
+		grace = time.Duration(*req.GracePeriodHours) * time.Hour
+		if grace < 0 || grace > maxRotationGrace {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("grace_period_hours must be between 0 and %d", int(maxRotationGrace.Hours()))})
+		}
+	}
+
+	var expiresAt *time.Time
+	switch {
+	case req.ExpiresIn != nil:
+		exp := time.Now().AddDate(0, 0, *req.ExpiresIn)
+		expiresAt = &exp
+	case key.ExpiresAt != nil:
+		exp := time.Now().Add(key.ExpiresAt.Sub(key.CreatedAt))
+		expiresAt = &exp
+	}
+
+	secret, successor, previous, err := ar.apiKeyRepo.RotateAPIKey(key.ID, grace, expiresAt)
+	if errors.Is(err, repository.ErrAPIKeyRotated) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to rotate API key"})
+	}
+
+	response := map[string]interface{}{
+		"api_key":  secret, // Only shown once!
+		"details":  successor,
+		"previous": previous,
+	}
+	if successor.SigningEnabled {
+		response["signing_secret"] = ar.verifier.SigningSecret(successor)
+	}
+
+	return c.JSON(http.StatusCreated, response)
+}
+
+// EnableSigning issues a new request signing secret for a key, replacing any previous one.
+// With require_signed the key stops accepting the raw X-API-Key header.
+func (ar *APIKeyRoutes) EnableSigning(c echo.Context) error {
+	key, ok, err := ar.loadManagedKey(c)
+	if !ok {
+		return err
+	}
+
+	var req struct {
+		RequireSigned bool `json:"require_signed"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	updated, err := ar.apiKeyRepo.EnableSigning(key.ID, req.RequireSigned)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"key_id":         updated.ID,
+		"signing_secret": ar.verifier.SigningSecret(updated), // Only shown once!
+		"details":        updated,
+	})
+}
+
+// DisableSigning drops a key's signing secret so it only works through X-API-Key
+func (ar *APIKeyRoutes) DisableSigning(c echo.Context) error {
+	key, ok, err := ar.loadManagedKey(c)
+	if !ok {
+		return err
+	}
+
+	updated, err := ar.apiKeyRepo.DisableSigning(key.ID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeactivateRotatedKeys deactivates rotated keys whose grace period has ended
+func (ar *APIKeyRoutes) DeactivateRotatedKeys() (int64, error) {
+	return ar.apiKeyRepo.DeactivateRotatedKeys()
+}
+
+// DeleteExpiredNonces forgets signed request nonces that can no longer be replayed
+func (ar *APIKeyRoutes) DeleteExpiredNonces() (int64, error) {
+	return ar.apiKeyRepo.DeleteExpiredNonces()
+}
+
+// SendExpiryWarnings emails the owners of keys expiring within API_KEY_EXPIRY_WARNING_DAYS, once per key
+func (ar *APIKeyRoutes) SendExpiryWarnings() (int, error) {
+	if ar.mailer == nil {
+		return 0, nil
+	}
+
+	keys, err := ar.apiKeyRepo.ClaimExpiringKeys(ar.expiryWarning)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, key := range keys {
+		if ar.sendExpiryWarning(key) {
+			sent++
+		}
+	}
+
+	if failures := len(keys) - sent; failures > 0 {
+		return sent, fmt.Errorf("failed to send %d expiry warning(s)", failures)
+	}
+
+	return sent, nil
+}
+
+func (ar *APIKeyRoutes) sendExpiryWarning(key repository.ExpiringAPIKey) bool {
+	expires := key.ExpiresAt.UTC().Format("2006-01-02 15:04 MST")
+
+	html := fmt.Sprintf(`
+		<h2>API key expiring - %s</h2>
+		<p>Your API key <strong>%s</strong> (%s) for project <strong>%s</strong> expires on %s.</p>
+		<p>Rotate it to issue a successor before it stops working.</p>
+	`, mailerpkg.EscapeHTML(ar.appName), mailerpkg.EscapeHTML(key.Name), mailerpkg.EscapeHTML(key.KeyPrefix), mailerpkg.EscapeHTML(key.ProjectName), expires)
+	text := fmt.Sprintf("%s API key expiring\n\nYour API key %s (%s) for project %s expires on %s.\nRotate it to issue a successor before it stops working.", ar.appName, key.Name, key.KeyPrefix, key.ProjectName, expires)
+
+	_, err := ar.mailer.Send(&mailerproviders.EmailData{
+		To:      []string{key.OwnerEmail},
+		Subject: fmt.Sprintf("API key %s expires on %s", key.Name, expires),
+		HTML:    html,
+		Text:    text,
+	})
+	if err != nil {
+		log.Printf("expiry warning email failed for key %s: %v", key.KeyID, err)
+		return false
+	}
+
+	return true
+}
@@ -1,12 +1,18 @@
 package routes
 
 import (
+	"errors"
 	"file-service/pkg/cache"
+	"file-service/pkg/middleware"
+	"file-service/pkg/models"
+	"file-service/pkg/rbac"
 	"file-service/pkg/repository"
 	"file-service/pkg/s3"
 	"fmt"
+	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,15 +25,19 @@ type AssetRoutes struct {
 	assetRepo   *repository.AssetRepository
 	projectRepo *repository.ProjectRepository
 	memberRepo  *repository.MemberRepository
+	schemaRepo  *repository.MetadataSchemaRepository
+	access      *folderAccess
 	urlCache    *cache.URLCache
 }
 
-func NewAssetRoutes(s3Client *s3.S3, assetRepo *repository.AssetRepository, projectRepo *repository.ProjectRepository, memberRepo *repository.MemberRepository, urlCache *cache.URLCache) *AssetRoutes {
+func NewAssetRoutes(s3Client *s3.S3, assetRepo *repository.AssetRepository, projectRepo *repository.ProjectRepository, memberRepo *repository.MemberRepository, schemaRepo *repository.MetadataSchemaRepository, aclRepo *repository.FolderACLRepository, checker *rbac.RBACChecker, urlCache *cache.URLCache) *AssetRoutes {
 	return &AssetRoutes{
 		s3Client:    s3Client,
 		assetRepo:   assetRepo,
 		projectRepo: projectRepo,
 		memberRepo:  memberRepo,
+		schemaRepo:  schemaRepo,
+		access:      newFolderAccess(memberRepo, aclRepo, checker),
 		urlCache:    urlCache,
 	}
 }
@@ -52,24 +62,126 @@ func normalizeFolderPath(folderPath string) string {
 	return folderPath
 }
 
-func (ar *AssetRoutes) verifyProjectAccess(projectID, clientID string) error {
-	_, err := ar.projectRepo.GetProjectByID(projectID, clientID)
-	return err
+// authorizeFolder checks the caller's effective role on a folder allows the action and returns the project.
+// Listings are not refused for API keys scoped to folders; callers narrow them with keyFolderScopes instead.
+// When it does not, the error response has already been written.
+func (ar *AssetRoutes) authorizeFolder(c echo.Context, projectID, folderPath string, action folderAction) (*models.Project, bool, error) {
+	role, err := ar.access.authorizeFolder(c, projectID, folderPath, action)
+	switch {
+	case errors.Is(err, errKeyFolderDenied):
+		return nil, false, c.JSON(http.StatusForbidden, map[string]any{
+			"error":           err.Error(),
+			"folder_path":     folderPath,
+			"allowed_folders": keyFolderScopes(c),
+		})
+	case errors.Is(err, errKeyProjectMismatch), errors.Is(err, errNotMember), errors.Is(err, repository.ErrMFARequired):
+		return nil, false, c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, rbac.ErrDenied):
+		return nil, false, c.JSON(http.StatusForbidden, map[string]any{
+			"error":       err.Error(),
+			"folder_path": folderPath,
+			"role":        role,
+		})
+	case err != nil:
+		return nil, false, c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check folder access"})
+	}
+
+	project, err := ar.projectRepo.FindProjectByID(projectID)
+	if err != nil {
+		return nil, false, c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	}
+
+	return project, true, nil
+}
+
+// urlLimits holds the presigned URL lifetimes and upload cap that apply to a project.
+type urlLimits struct {
+	downloadTTL   time.Duration
+	uploadTTL     time.Duration
+	maxUploadSize int64
+}
+
+// projectURLLimits resolves the global defaults overridden by the project's settings.
+func (ar *AssetRoutes) projectURLLimits(project *models.Project) urlLimits {
+	return resolveURLLimits(ar.s3Client, project)
+}
+
+func resolveURLLimits(s3Client *s3.S3, project *models.Project) urlLimits {
+	limits := urlLimits{
+		downloadTTL:   s3Client.DownloadURLExpiry(),
+		uploadTTL:     s3Client.UploadURLExpiry(),
+		maxUploadSize: s3Client.MaxUploadSize(),
+	}
+	if project == nil {
+		return limits
+	}
+	if project.DownloadURLTTLSeconds != nil {
+		limits.downloadTTL = time.Duration(*project.DownloadURLTTLSeconds) * time.Second
+	}
+	if project.UploadURLTTLSeconds != nil {
+		limits.uploadTTL = time.Duration(*project.UploadURLTTLSeconds) * time.Second
+	}
+	if project.MaxUploadSizeBytes != nil {
+		limits.maxUploadSize = *project.MaxUploadSizeBytes
+	}
+	return limits
+}
+
+// parseExpiresIn reads a requested lifetime in seconds, defaulting to and bounded by max.
+func parseExpiresIn(raw string, max time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return max, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("expires_in must be a positive number of seconds")
+	}
+	requested := time.Duration(seconds) * time.Second
+	if requested > max {
+		return 0, fmt.Errorf("expires_in exceeds the project maximum of %d seconds", int(max.Seconds()))
+	}
+	return requested, nil
+}
+
+// downloadTTL resolves the download URL lifetime for a request against a project.
+func (ar *AssetRoutes) downloadTTL(c echo.Context, projectID string) (time.Duration, error) {
+	project, _ := ar.projectRepo.FindProjectByID(projectID)
+	return parseExpiresIn(c.QueryParam("expires_in"), ar.projectURLLimits(project).downloadTTL)
 }
 
 func (ar *AssetRoutes) UploadAsset(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
-	projectID := c.FormValue("project_id")
 	folderPath := normalizeFolderPath(c.FormValue("folder_path"))
 	createVersion := c.FormValue("create_version") == "true"
 	parentAssetID := c.FormValue("parent_asset_id")
+	inheritMetadata := c.FormValue("inherit_metadata") == "true"
 
+	projectID, err := requestProjectID(c, c.FormValue("project_id"))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
 	if projectID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id required"})
 	}
 
-	if err := ar.verifyProjectAccess(projectID, clientID); err != nil {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	form, err := c.FormParams()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid form"})
+	}
+	tags, metadata, err := parseTagsAndMetadata(form)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	project, ok, err := ar.authorizeFolder(c, projectID, folderPath, folderWrite)
+	if !ok {
+		return err
+	}
+
+	limits := ar.projectURLLimits(project)
+	expiresIn, err := parseExpiresIn(c.FormValue("expires_in"), limits.downloadTTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
 	file, err := c.FormFile("file")
@@ -77,6 +189,26 @@ func (ar *AssetRoutes) UploadAsset(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file required"})
 	}
 
+	if file.Size > limits.maxUploadSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]any{"error": "file exceeds maximum upload size", "max_file_size": limits.maxUploadSize})
+	}
+
+	if !createVersion {
+		parentAssetID = ""
+	}
+	attrs, schemaVersion, err := ar.resolveAssetAttributes(projectID, tags, metadata, parentAssetID, inheritMetadata)
+	if handled, respErr := respondMetadataInvalid(c, err, schemaVersion); handled {
+		return respErr
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	objectMetadata, err := s3UserMetadata(attrs.Tags, attrs.Metadata)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	src, err := file.Open()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to open file"})
@@ -86,23 +218,26 @@ func (ar *AssetRoutes) UploadAsset(c echo.Context) error {
 	assetID := uuid.New().String()
 	s3Key := buildS3Key(clientID, projectID, folderPath, assetID, file.Filename)
 
-	if err := ar.s3Client.UploadFile(src, s3Key); err != nil {
+	if err := ar.s3Client.UploadFileWithMetadata(src, s3Key, objectMetadata); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to upload file"})
 	}
 
 	var asset *repository.Asset
 	if createVersion && parentAssetID != "" {
-		asset, err = ar.assetRepo.CreateAssetVersion(clientID, projectID, folderPath, file.Filename, file.Filename, file.Size, file.Header.Get("Content-Type"), s3Key, parentAssetID)
+		asset, err = ar.assetRepo.CreateAssetVersion(clientID, projectID, folderPath, file.Filename, file.Filename, file.Size, file.Header.Get("Content-Type"), s3Key, parentAssetID, attrs)
 	} else {
-		asset, err = ar.assetRepo.CreateAsset(clientID, projectID, folderPath, file.Filename, file.Filename, file.Size, file.Header.Get("Content-Type"), s3Key)
+		asset, err = ar.assetRepo.CreateAsset(clientID, projectID, folderPath, file.Filename, file.Filename, file.Size, file.Header.Get("Content-Type"), s3Key, attrs)
 	}
 
 	if err != nil {
-		ar.s3Client.DeleteObject(s3Key)
+		if delErr := ar.s3Client.DeleteObject(s3Key); delErr != nil {
+			log.Printf("failed to delete unrecorded upload %s: %v", s3Key, delErr)
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to record asset"})
 	}
+	middleware.RecordUploadedBytes(c, file.Size)
 
-	presignedURL, err := ar.s3Client.GenerateDownloadLink(s3Key, ar.urlCache)
+	presignedURL, err := ar.s3Client.GenerateDownloadLinkWithExpiry(s3Key, ar.urlCache, expiresIn)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate download URL"})
 	}
@@ -115,15 +250,39 @@ func (ar *AssetRoutes) UploadAsset(c echo.Context) error {
 
 func (ar *AssetRoutes) GetAssets(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
-	projectID := c.QueryParam("project_id")
+	projectID, err := requestProjectID(c, c.QueryParam("project_id"))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
 	folderPath := c.QueryParam("folder_path")
 
 	if projectID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id required"})
 	}
 
-	if err := ar.verifyProjectAccess(projectID, clientID); err != nil {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	// Without a folder the listing spans the project and denied folders are filtered out below
+	target, action := "/", folderList
+	if folderPath != "" {
+		target, action = normalizeFolderPath(folderPath), folderRead
+	}
+	project, ok, err := ar.authorizeFolder(c, projectID, target, action)
+	if !ok {
+		return err
+	}
+
+	expiresIn, err := parseExpiresIn(c.QueryParam("expires_in"), ar.projectURLLimits(project).downloadTTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	listing, err := parseListingQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
 	var folderPtr *string
@@ -132,30 +291,45 @@ func (ar *AssetRoutes) GetAssets(c echo.Context) error {
 		folderPtr = &normalized
 	}
 
-	assets, err := ar.assetRepo.GetAssetsByProjectID(projectID, clientID, folderPtr)
+	filter := listing.AssetFilter(folderPtr)
+	filter.ReaderID = clientID
+	filter.FolderScopes = keyFolderScopes(c)
+
+	assets, info, err := ar.assetRepo.GetAssetsByProjectID(projectID, filter, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get assets"})
 	}
 
 	for i := range assets {
-		if presignedURL, err := ar.s3Client.GenerateDownloadLink(assets[i].S3Key, ar.urlCache); err == nil {
+		if presignedURL, err := ar.s3Client.GenerateDownloadLinkWithExpiry(assets[i].S3Key, ar.urlCache, expiresIn); err == nil {
 			assets[i].PresignedURL = presignedURL
 		}
 	}
 
-	return c.JSON(http.StatusOK, assets)
+	return c.JSON(http.StatusOK, pageResponse("assets", assets, page, info))
 }
 
 func (ar *AssetRoutes) GetAsset(c echo.Context) error {
-	clientID := c.Get("client_id").(string)
 	assetID := c.Param("id")
 
-	asset, err := ar.assetRepo.GetAssetByID(assetID, clientID)
+	asset, err := ar.assetRepo.FindAssetByID(assetID)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
 	}
 
-	presignedURL, err := ar.s3Client.GenerateDownloadLink(asset.S3Key, ar.urlCache)
+	if _, ok, err := ar.authorizeFolder(c, asset.ProjectID, asset.FolderPath, folderRead); !ok {
+		return err
+	}
+
+	expiresIn, err := ar.downloadTTL(c, asset.ProjectID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	presignedURL, err := ar.s3Client.GenerateDownloadLinkWithExpiry(asset.S3Key, ar.urlCache, expiresIn)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate download URL"})
 	}
@@ -167,19 +341,22 @@ func (ar *AssetRoutes) GetAsset(c echo.Context) error {
 }
 
 func (ar *AssetRoutes) DeleteAsset(c echo.Context) error {
-	clientID := c.Get("client_id").(string)
 	assetID := c.Param("id")
 
-	asset, err := ar.assetRepo.GetAssetByID(assetID, clientID)
+	asset, err := ar.assetRepo.FindAssetByID(assetID)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
 	}
 
+	if _, ok, err := ar.authorizeFolder(c, asset.ProjectID, asset.FolderPath, folderDelete); !ok {
+		return err
+	}
+
 	if err = ar.s3Client.DeleteObject(asset.S3Key); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete from storage"})
 	}
 
-	if err = ar.assetRepo.DeleteAsset(assetID, clientID); err != nil {
+	if err = ar.assetRepo.DeleteAsset(assetID); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete asset record"})
 	}
 
@@ -188,7 +365,10 @@ func (ar *AssetRoutes) DeleteAsset(c echo.Context) error {
 
 func (ar *AssetRoutes) GetUploadURL(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
-	projectID := c.QueryParam("project_id")
+	projectID, err := requestProjectID(c, c.QueryParam("project_id"))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
 	folderPath := normalizeFolderPath(c.QueryParam("folder_path"))
 	filename := c.QueryParam("filename")
 
@@ -196,8 +376,35 @@ func (ar *AssetRoutes) GetUploadURL(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id and filename required"})
 	}
 
-	if err := ar.verifyProjectAccess(projectID, clientID); err != nil {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	project, ok, err := ar.authorizeFolder(c, projectID, folderPath, folderWrite)
+	if !ok {
+		return err
+	}
+
+	limits := ar.projectURLLimits(project)
+	expiresIn, err := parseExpiresIn(c.QueryParam("expires_in"), limits.uploadTTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var fileSize int64
+	if raw := c.QueryParam("file_size"); raw != "" {
+		fileSize, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || fileSize <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "file_size must be a positive number of bytes"})
+		}
+		if fileSize > limits.maxUploadSize {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]any{"error": "file exceeds maximum upload size", "max_file_size": limits.maxUploadSize})
+		}
+	}
+
+	tags, metadata, err := parseTagsAndMetadata(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	objectMetadata, err := s3UserMetadata(tags, metadata)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
 	assetID := uuid.New().String()
@@ -205,18 +412,28 @@ func (ar *AssetRoutes) GetUploadURL(c echo.Context) error {
 	generatedFilename := assetID + ext
 	s3Key := buildS3Key(clientID, projectID, folderPath, assetID, generatedFilename)
 
-	presignedPost, err := ar.s3Client.GeneratePresignedPost(s3Key, 100*1024*1024, 15*time.Minute)
+	presignedPost, err := ar.s3Client.GeneratePresignedPost(s3.PresignedPostInput{
+		Key:           s3Key,
+		MaxFileSize:   limits.maxUploadSize,
+		ContentLength: fileSize,
+		ExpiresIn:     expiresIn,
+		Metadata:      objectMetadata,
+	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate upload URL"})
 	}
 
 	return c.JSON(http.StatusOK, map[string]any{
-		"upload_url": presignedPost.URL,
-		"fields":     presignedPost.Fields,
-		"asset_id":   assetID,
-		"s3_key":     s3Key,
-		"filename":   generatedFilename,
-		"expires_in": 900,
+		"upload_url":    presignedPost.URL,
+		"fields":        presignedPost.Fields,
+		"headers":       presignedPost.Headers,
+		"tags":          tags,
+		"metadata":      metadata,
+		"asset_id":      assetID,
+		"s3_key":        s3Key,
+		"filename":      generatedFilename,
+		"expires_in":    int(expiresIn.Seconds()),
+		"max_file_size": presignedPost.MaxFileSize,
 	})
 }
 
@@ -234,35 +451,97 @@ func (ar *AssetRoutes) ConfirmUpload(c echo.Context) error {
 		MimeType         string `json:"mime_type"`
 		CreateVersion    bool   `json:"create_version"`
 		ParentAssetID    string `json:"parent_asset_id"`
+		InheritMetadata  bool   `json:"inherit_metadata"`
+		// Tags and Metadata default to the values signed into the upload URL
+		Tags     []string          `json:"tags"`
+		Metadata map[string]string `json:"metadata"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
 
+	projectID, err := requestProjectID(c, req.ProjectID)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	req.ProjectID = projectID
+
 	if req.ProjectID == "" || req.S3Key == "" || req.Filename == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id, s3_key, and filename required"})
 	}
 
 	req.FolderPath = normalizeFolderPath(req.FolderPath)
 
-	if err := ar.verifyProjectAccess(req.ProjectID, clientID); err != nil {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	project, ok, err := ar.authorizeFolder(c, req.ProjectID, req.FolderPath, folderWrite)
+	if !ok {
+		return err
+	}
+
+	// The object must sit under the folder that was authorized, not one the caller cannot write to
+	if !strings.HasPrefix(req.S3Key, fmt.Sprintf("%s/%s%s", clientID, req.ProjectID, req.FolderPath)) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "s3_key does not belong to folder_path"})
+	}
+
+	limits := ar.projectURLLimits(project)
+	expiresIn, err := parseExpiresIn(c.QueryParam("expires_in"), limits.downloadTTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	object, err := ar.s3Client.StatObject(req.S3Key)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "uploaded object not found"})
+	}
+	if object.Size > limits.maxUploadSize {
+		if err := ar.s3Client.DeleteObject(req.S3Key); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete oversized upload"})
+		}
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]any{"error": "file exceeds maximum upload size", "max_file_size": limits.maxUploadSize})
+	}
+	req.FileSize = object.Size
+
+	signedTags, signedMetadata := fromS3UserMetadata(object.Metadata)
+	if req.Tags == nil {
+		req.Tags = signedTags
+	}
+	if req.Metadata == nil {
+		req.Metadata = signedMetadata
+	}
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	metadata, err := normalizeMetadata(req.Metadata)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if !req.CreateVersion {
+		req.ParentAssetID = ""
+	}
+	attrs, schemaVersion, err := ar.resolveAssetAttributes(req.ProjectID, tags, metadata, req.ParentAssetID, req.InheritMetadata)
+	if handled, respErr := respondMetadataInvalid(c, err, schemaVersion); handled {
+		return respErr
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
 	var asset *repository.Asset
-	var err error
 	if req.CreateVersion && req.ParentAssetID != "" {
-		asset, err = ar.assetRepo.CreateAssetVersion(clientID, req.ProjectID, req.FolderPath, req.Filename, req.OriginalFilename, req.FileSize, req.MimeType, req.S3Key, req.ParentAssetID)
+		asset, err = ar.assetRepo.CreateAssetVersion(clientID, req.ProjectID, req.FolderPath, req.Filename, req.OriginalFilename, req.FileSize, req.MimeType, req.S3Key, req.ParentAssetID, attrs)
 	} else {
-		asset, err = ar.assetRepo.CreateAsset(clientID, req.ProjectID, req.FolderPath, req.Filename, req.OriginalFilename, req.FileSize, req.MimeType, req.S3Key)
+		asset, err = ar.assetRepo.CreateAsset(clientID, req.ProjectID, req.FolderPath, req.Filename, req.OriginalFilename, req.FileSize, req.MimeType, req.S3Key, attrs)
 	}
 
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to record asset"})
 	}
+	middleware.RecordUploadedBytes(c, req.FileSize)
 
-	presignedURL, err := ar.s3Client.GenerateDownloadLink(req.S3Key, ar.urlCache)
+	presignedURL, err := ar.s3Client.GenerateDownloadLinkWithExpiry(req.S3Key, ar.urlCache, expiresIn)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate download URL"})
 	}
@@ -275,43 +554,73 @@ func (ar *AssetRoutes) ConfirmUpload(c echo.Context) error {
 
 func (ar *AssetRoutes) GetFolders(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
-	projectID := c.QueryParam("project_id")
+	projectID, err := requestProjectID(c, c.QueryParam("project_id"))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
 
 	if projectID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id required"})
 	}
 
-	if err := ar.verifyProjectAccess(projectID, clientID); err != nil {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	if _, ok, err := ar.authorizeFolder(c, projectID, "/", folderList); !ok {
+		return err
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	folders, err := ar.assetRepo.GetFoldersByProjectID(projectID, clientID)
+	folders, info, err := ar.assetRepo.GetFoldersByProjectID(projectID, clientID, keyFolderScopes(c), page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get folders"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]any{
-		"folders": folders,
-	})
+	return c.JSON(http.StatusOK, pageResponse("folders", folders, page, info))
 }
 
 func (ar *AssetRoutes) GetAssetVersions(c echo.Context) error {
-	clientID := c.Get("client_id").(string)
 	assetID := c.Param("id")
 
-	versions, err := ar.assetRepo.GetAssetVersions(assetID, clientID)
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	asset, err := ar.assetRepo.FindAssetByID(assetID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if _, ok, err := ar.authorizeFolder(c, asset.ProjectID, asset.FolderPath, folderRead); !ok {
+		return err
+	}
+
+	versions, info, err := ar.assetRepo.GetAssetVersions(assetID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
 	}
 
+	var expiresIn time.Duration
+	if len(versions) > 0 {
+		expiresIn, err = ar.downloadTTL(c, versions[0].ProjectID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
 	for i := range versions {
-		if presignedURL, err := ar.s3Client.GenerateDownloadLink(versions[i].S3Key, ar.urlCache); err == nil {
+		if presignedURL, err := ar.s3Client.GenerateDownloadLinkWithExpiry(versions[i].S3Key, ar.urlCache, expiresIn); err == nil {
 			versions[i].PresignedURL = presignedURL
 		}
 	}
 
-	return c.JSON(http.StatusOK, map[string]any{
-		"versions": versions,
-		"total":    len(versions),
-	})
+	return c.JSON(http.StatusOK, pageResponse("versions", versions, page, info))
 }
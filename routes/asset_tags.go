@@ -0,0 +1,374 @@
+package routes
+
+import (
+	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxAssetTags           = 50
+	maxMetadataKeys        = 50
+	maxMetadataValueLength = 1024
+
+	// metadataParamPrefix marks metadata pairs in query strings and form fields (meta.<key>=<value>)
+	metadataParamPrefix = "meta."
+
+	// s3TagsMetadataKey holds the comma-joined tags in S3 user metadata, so it is not a valid metadata key
+	s3TagsMetadataKey = "tags"
+)
+
+var (
+	tagPattern         = regexp.MustCompile(`^[a-z0-9][a-z0-9 _:./-]{0,63}$`)
+	metadataKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// normalizeTags lowercases, trims, validates and de-duplicates tags
+func normalizeTags(raw []string) ([]string, error) {
+	tags := make([]string, 0, len(raw))
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use up to 64 lowercase letters, digits, spaces or _ : . / -", tag)
+		}
+		tags = append(tags, tag)
+	}
+
+	tags = repository.MergeTags(tags)
+	if len(tags) > maxAssetTags {
+		return nil, fmt.Errorf("at most %d tags allowed", maxAssetTags)
+	}
+	return tags, nil
+}
+
+// normalizeMetadata lowercases and validates metadata keys and values
+func normalizeMetadata(raw map[string]string) (map[string]string, error) {
+	if len(raw) > maxMetadataKeys {
+		return nil, fmt.Errorf("at most %d metadata keys allowed", maxMetadataKeys)
+	}
+
+	metadata := make(map[string]string, len(raw))
+	for key, value := range raw {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if err := validateMetadataKey(key); err != nil {
+			return nil, err
+		}
+		if len(value) > maxMetadataValueLength {
+			return nil, fmt.Errorf("metadata value for %q exceeds %d bytes", key, maxMetadataValueLength)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
+func validateMetadataKey(key string) error {
+	if !metadataKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid metadata key %q: use up to 64 lowercase letters, digits, _ or -", key)
+	}
+	if key == s3TagsMetadataKey {
+		return fmt.Errorf("metadata key %q is reserved", key)
+	}
+	return nil
+}
+
+// splitTags splits a comma-separated tag list
+func splitTags(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, ",")
+}
+
+// metadataFromValues collects meta.<key>=<value> pairs from a query string or form
+func metadataFromValues(values url.Values) map[string]string {
+	metadata := make(map[string]string)
+	for name, vals := range values {
+		if strings.HasPrefix(name, metadataParamPrefix) && len(vals) > 0 {
+			metadata[strings.TrimPrefix(name, metadataParamPrefix)] = vals[0]
+		}
+	}
+	return metadata
+}
+
+// parseTagsAndMetadata reads tags (comma-separated) and meta.<key> pairs from a query string or form
+func parseTagsAndMetadata(values url.Values) ([]string, map[string]string, error) {
+	tags, err := normalizeTags(splitTags(values.Get("tags")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata, err := normalizeMetadata(metadataFromValues(values))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tags, metadata, nil
+}
+
+// s3UserMetadata mirrors tags and metadata into S3 user metadata, enforcing the S3 size and charset limits
+func s3UserMetadata(tags []string, metadata map[string]string) (map[string]string, error) {
+	mirrored := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		mirrored[key] = value
+	}
+	if len(tags) > 0 {
+		mirrored[s3TagsMetadataKey] = strings.Join(tags, ",")
+	}
+
+	size := 0
+	for key, value := range mirrored {
+		if !isPrintableASCII(value) {
+			return nil, fmt.Errorf("metadata value for %q must be printable ASCII to be stored with the object", key)
+		}
+		size += len(key) + len(value)
+	}
+	if size > s3.MaxUserMetadataSize {
+		return nil, fmt.Errorf("tags and metadata exceed the %d byte object metadata limit", s3.MaxUserMetadataSize)
+	}
+
+	return mirrored, nil
+}
+
+// fromS3UserMetadata splits object user metadata back into tags and metadata
+func fromS3UserMetadata(objectMetadata map[string]string) ([]string, map[string]string) {
+	metadata := make(map[string]string)
+	var tags []string
+	for key, value := range objectMetadata {
+		if key == s3TagsMetadataKey {
+			tags = splitTags(value)
+			continue
+		}
+		metadata[key] = value
+	}
+	return tags, metadata
+}
+
+func isPrintableASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveAssetAttributes builds the attributes of a new asset or version. With inherit and a parent,
+// the parent's tags and metadata are carried over beneath the given ones. The resulting metadata is
+// validated against the project's current schema; on failure the error is a *metadata.ValidationError
+// and the returned int is the schema version that rejected it.
+func (ar *AssetRoutes) resolveAssetAttributes(projectID string, tags []string, values map[string]string, parentAssetID string, inherit bool) (repository.AssetAttributes, int, error) {
+	attrs := repository.AssetAttributes{Tags: tags, Metadata: values}
+
+	if inherit && parentAssetID != "" {
+		parent, err := ar.assetRepo.FindAssetByID(parentAssetID)
+		if err != nil || parent.ProjectID != projectID {
+			return attrs, 0, fmt.Errorf("parent asset not found")
+		}
+
+		merged := make(map[string]string, len(parent.Metadata)+len(values))
+		for key, value := range parent.Metadata {
+			merged[key] = value
+		}
+		for key, value := range values {
+			merged[key] = value
+		}
+		attrs.Metadata = merged
+
+		if attrs.Tags, err = normalizeTags(repository.MergeTags(parent.Tags, tags)); err != nil {
+			return attrs, 0, err
+		}
+	}
+
+	schema, err := ar.schemaRepo.GetCurrentSchema(projectID)
+	if err != nil {
+		return attrs, 0, fmt.Errorf("failed to load metadata schema")
+	}
+	if schema == nil {
+		return attrs, 0, nil
+	}
+
+	if err := schema.Schema.Validate(attrs.Metadata); err != nil {
+		return attrs, schema.Version, err
+	}
+	attrs.SchemaVersion = &schema.Version
+
+	return attrs, schema.Version, nil
+}
+
+// UpdateAssetTags replaces, adds or removes tags on an asset version
+func (ar *AssetRoutes) UpdateAssetTags(c echo.Context) error {
+	assetID := c.Param("id")
+
+	var req struct {
+		Tags   *[]string `json:"tags"`
+		Add    []string  `json:"add"`
+		Remove []string  `json:"remove"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.Tags == nil && len(req.Add) == 0 && len(req.Remove) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nothing to update"})
+	}
+
+	asset, err := ar.assetRepo.FindAssetByID(assetID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if _, ok, err := ar.authorizeFolder(c, asset.ProjectID, asset.FolderPath, folderWrite); !ok {
+		return err
+	}
+
+	update := repository.TagUpdate{}
+	if update.Add, err = normalizeTags(req.Add); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	for _, tag := range req.Remove {
+		update.Remove = append(update.Remove, strings.ToLower(strings.TrimSpace(tag)))
+	}
+
+	base := asset.Tags
+	if req.Tags != nil {
+		set, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		update.Set = &set
+		base = set
+	}
+
+	after := tagsAfter(base, update.Add, update.Remove)
+	if len(after) > maxAssetTags {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d tags allowed", maxAssetTags)})
+	}
+	if _, err := s3UserMetadata(after, asset.Metadata); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	asset, err = ar.assetRepo.UpdateAssetTags(assetID, update)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if err := syncObjectMetadata(ar.s3Client, asset); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update object metadata"})
+	}
+
+	return c.JSON(http.StatusOK, asset)
+}
+
+// UpdateAssetMetadata sets or removes metadata keys on an asset version
+func (ar *AssetRoutes) UpdateAssetMetadata(c echo.Context) error {
+	assetID := c.Param("id")
+
+	var req struct {
+		Set    map[string]string `json:"set"`
+		Remove []string          `json:"remove"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if len(req.Set) == 0 && len(req.Remove) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nothing to update"})
+	}
+
+	set, err := normalizeMetadata(req.Set)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	remove := make([]string, 0, len(req.Remove))
+	for _, key := range req.Remove {
+		remove = append(remove, strings.ToLower(strings.TrimSpace(key)))
+	}
+
+	asset, err := ar.assetRepo.FindAssetByID(assetID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if _, ok, err := ar.authorizeFolder(c, asset.ProjectID, asset.FolderPath, folderWrite); !ok {
+		return err
+	}
+
+	result := make(map[string]string, len(asset.Metadata)+len(set))
+	for key, value := range asset.Metadata {
+		result[key] = value
+	}
+	for _, key := range remove {
+		delete(result, key)
+	}
+	for key, value := range set {
+		result[key] = value
+	}
+	if len(result) > maxMetadataKeys {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d metadata keys allowed", maxMetadataKeys)})
+	}
+	if _, err := s3UserMetadata(asset.Tags, result); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var schemaVersion *int
+	schema, err := ar.schemaRepo.GetCurrentSchema(asset.ProjectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get metadata schema"})
+	}
+	if schema != nil {
+		err := schema.Schema.Validate(result)
+		if handled, respErr := respondMetadataInvalid(c, err, schema.Version); handled {
+			return respErr
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to validate metadata"})
+		}
+		schemaVersion = &schema.Version
+	}
+
+	asset, err = ar.assetRepo.UpdateAssetMetadata(assetID, set, remove, schemaVersion)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if err := syncObjectMetadata(ar.s3Client, asset); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update object metadata"})
+	}
+
+	return c.JSON(http.StatusOK, asset)
+}
+
+// tagsAfter returns the tags that remain once add and remove are applied to base
+func tagsAfter(base, add, remove []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		removed[tag] = true
+	}
+
+	tags := make([]string, 0, len(base)+len(add))
+	for _, tag := range repository.MergeTags(base, add) {
+		if !removed[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// syncObjectMetadata rewrites the S3 user metadata of an asset's object to match its tags and metadata
+func syncObjectMetadata(client *s3.S3, asset *repository.Asset) error {
+	objectMetadata, err := s3UserMetadata(asset.Tags, asset.Metadata)
+	if err != nil {
+		return err
+	}
+	return client.ReplaceObjectMetadata(asset.S3Key, objectMetadata)
+}
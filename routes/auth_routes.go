@@ -1,34 +1,219 @@
 package routes
 
 import (
+	"errors"
 	"file-service/pkg/auth"
 	mailerpkg "file-service/pkg/mailer"
 	mailerproviders "file-service/pkg/mailer/providers"
+	"file-service/pkg/mailer/registry"
+	mailertemplates "file-service/pkg/mailer/templates"
+	"file-service/pkg/models"
 	"file-service/pkg/repository"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+// sessionRetention is how long ended sessions are kept; their user agents count as known devices meanwhile
+const sessionRetention = 90 * 24 * time.Hour
+
+const passwordResetTTL = registry.PasswordResetExpiryHours * time.Hour
+
+// loginFailureRetention is how long failed login counters are kept after the last failure
+const loginFailureRetention = 24 * time.Hour
+
 type AuthRoutes struct {
-	clientRepo *repository.ClientRepository
-	jwtSecret  string
-	mailer     *mailerpkg.EmailService
-	appBaseURL string
-	appName    string
+	clientRepo  *repository.ClientRepository
+	refreshRepo *repository.RefreshTokenRepository
+	sessionRepo *repository.SessionRepository
+	resetRepo   *repository.PasswordResetRepository
+	loginRepo   *repository.LoginAttemptRepository
+	auditRepo   *repository.AuditRepository
+	emailVerify *EmailVerificationRoutes
+	mfa         *MFARoutes
+	jwtSecret   string
+	mailer      *mailerpkg.EmailService
+	appBaseURL  string
+	appName     string
+	// forgotThrottle limits reset emails per address
+	forgotThrottle *emailThrottle
 }
 
-func NewAuthRoutes(clientRepo *repository.ClientRepository, jwtSecret string, mailer *mailerpkg.EmailService, appBaseURL string, appName string) *AuthRoutes {
+func NewAuthRoutes(clientRepo *repository.ClientRepository, refreshRepo *repository.RefreshTokenRepository, sessionRepo *repository.SessionRepository, resetRepo *repository.PasswordResetRepository, loginRepo *repository.LoginAttemptRepository, auditRepo *repository.AuditRepository, emailVerify *EmailVerificationRoutes, mfa *MFARoutes, jwtSecret string, mailer *mailerpkg.EmailService, appBaseURL string, appName string) *AuthRoutes {
 	return &AuthRoutes{
-		clientRepo: clientRepo,
-		jwtSecret:  jwtSecret,
-		mailer:     mailer,
-		appBaseURL: strings.TrimRight(appBaseURL, "/"),
-		appName:    appName,
+		clientRepo:  clientRepo,
+		refreshRepo: refreshRepo,
+		sessionRepo: sessionRepo,
+		resetRepo:   resetRepo,
+		loginRepo:   loginRepo,
+		auditRepo:   auditRepo,
+		emailVerify: emailVerify,
+		mfa:         mfa,
+		jwtSecret:   jwtSecret,
+		mailer:      mailer,
+		appBaseURL:  strings.TrimRight(appBaseURL, "/"),
+		appName:     appName,
+
+		forgotThrottle: newEmailThrottle(forgotPasswordLimit, forgotPasswordWindow),
+	}
+}
+
+// issueTokens starts a session for the request's device and returns its access and refresh tokens.
+// newDevice reports a login from a user agent the client has not used before.
+func (ar *AuthRoutes) issueTokens(c echo.Context, clientID, email string) (accessToken, refreshToken string, newDevice bool, err error) {
+	refreshToken, expiresAt, err := auth.GenerateRefreshToken(clientID, email, ar.jwtSecret)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	sessionID, newDevice, err := ar.sessionRepo.CreateSession(clientID, c.Request().UserAgent(), c.RealIP(), refreshToken, expiresAt)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	accessToken, err = auth.GenerateAccessToken(clientID, email, sessionID, ar.jwtSecret)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	return accessToken, refreshToken, newDevice, nil
+}
+
+// audit records an authentication event in the audit trail; clientID may be empty for unknown accounts
+func (ar *AuthRoutes) audit(c echo.Context, action, clientID string, status int, details map[string]any) {
+	entry := &models.AuditEntry{
+		Action:     action,
+		Resource:   c.Request().URL.Path,
+		Details:    details,
+		IPAddress:  c.RealIP(),
+		UserAgent:  c.Request().UserAgent(),
+		StatusCode: status,
+	}
+	if clientID != "" {
+		entry.ActorClientID = &clientID
+	}
+
+	if err := ar.auditRepo.Record(entry); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// loginBlockedFor returns how long login attempts for the email or from the IP address are still refused
+func (ar *AuthRoutes) loginBlockedFor(email, ipAddress string) (time.Duration, error) {
+	accountWait, err := ar.loginRepo.LoginBlockedFor(repository.LoginScopeAccount, email)
+	if err != nil {
+		return 0, err
+	}
+
+	ipWait, err := ar.loginRepo.LoginBlockedFor(repository.LoginScopeIP, ipAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(accountWait, ipWait), nil
+}
+
+// recordLoginFailure counts a failed login against the email and the IP address and delays or locks them.
+// client is nil when no account has the email; such addresses are throttled all the same.
+func (ar *AuthRoutes) recordLoginFailure(c echo.Context, email string, client *models.Client) {
+	ipAddress := c.RealIP()
+	clientID := ""
+	if client != nil {
+		clientID = client.ID
+	}
+
+	accountFailures, err := ar.loginRepo.RecordLoginFailure(repository.LoginScopeAccount, email, loginFailureWindow)
+	if err != nil {
+		log.Printf("login failure tracking failed for %s: %v", email, err)
+		return
+	}
+	ipFailures, err := ar.loginRepo.RecordLoginFailure(repository.LoginScopeIP, ipAddress, loginFailureWindow)
+	if err != nil {
+		log.Printf("login failure tracking failed for %s: %v", ipAddress, err)
+		return
+	}
+
+	ar.audit(c, "auth.login-failed", clientID, http.StatusUnauthorized, map[string]any{
+		"email":            email,
+		"account_failures": accountFailures,
+		"ip_failures":      ipFailures,
+	})
+
+	if delay := loginBackoff(ipFailures, ipBackoffAfter); delay > 0 {
+		if err := ar.loginRepo.BlockLogin(repository.LoginScopeIP, ipAddress, delay); err != nil {
+			log.Printf("login backoff failed for %s: %v", ipAddress, err)
+		}
+	}
+
+	if accountFailures < loginLockoutAfter {
+		if delay := loginBackoff(accountFailures, accountBackoffAfter); delay > 0 {
+			if err := ar.loginRepo.BlockLogin(repository.LoginScopeAccount, email, delay); err != nil {
+				log.Printf("login backoff failed for %s: %v", email, err)
+			}
+		}
+		return
+	}
+
+	if err := ar.loginRepo.BlockLogin(repository.LoginScopeAccount, email, loginLockoutDuration); err != nil {
+		log.Printf("account lockout failed for %s: %v", email, err)
+		return
+	}
+
+	ar.audit(c, "auth.account-locked", clientID, http.StatusUnauthorized, map[string]any{
+		"email":            email,
+		"account_failures": accountFailures,
+		"locked_for":       int(loginLockoutDuration.Seconds()),
+	})
+
+	if client != nil {
+		ar.sendLockoutEmail(client, ipAddress)
+	}
+}
+
+// sendLockoutEmail tells the client its account was locked and links to unlock it right away
+func (ar *AuthRoutes) sendLockoutEmail(client *models.Client, ipAddress string) {
+	if ar.mailer == nil {
+		return
+	}
+
+	token, err := ar.loginRepo.CreateUnlockToken(client.ID, unlockTokenTTL)
+	if err != nil {
+		log.Printf("unlock token failed for %s: %v", client.Email, err)
+		return
+	}
+
+	unlockURL := fmt.Sprintf("%s/unlock-account?token=%s", ar.appBaseURL, url.QueryEscape(token))
+	safeUnlockURL := mailerpkg.SanitizeURL(unlockURL)
+	if safeUnlockURL == "" {
+		safeUnlockURL = unlockURL
+	}
+	lockedMinutes := int(loginLockoutDuration.Minutes())
+
+	html := fmt.Sprintf(`
+		<h2>Your %s account was locked</h2>
+		<p>Hi %s,</p>
+		<p>After %d failed login attempts, the last one from IP address %s, your account is locked for %d minutes.</p>
+		<p>If this was you, <a href="%s">unlock your account</a> now.</p>
+		<p>If it wasn't, someone may be guessing your password. Leave the account locked and reset your password.</p>
+	`, mailerpkg.EscapeHTML(ar.appName), mailerpkg.EscapeHTML(strings.TrimSpace(client.Name)), loginLockoutAfter, mailerpkg.EscapeHTML(ipAddress), lockedMinutes, safeUnlockURL)
+	text := fmt.Sprintf("Your %s account was locked\n\nHi %s,\nAfter %d failed login attempts, the last one from IP address %s, your account is locked for %d minutes.\nIf this was you, unlock it now: %s\nIf it wasn't, someone may be guessing your password. Reset your password.",
+		ar.appName, strings.TrimSpace(client.Name), loginLockoutAfter, ipAddress, lockedMinutes, unlockURL)
+
+	_, err = ar.mailer.Send(&mailerproviders.EmailData{
+		To:      []string{client.Email},
+		Subject: fmt.Sprintf("Your %s account was locked", ar.appName),
+		HTML:    html,
+		Text:    text,
+	})
+	if err != nil {
+		log.Printf("lockout email failed for %s: %v", client.Email, err)
 	}
 }
 
@@ -77,6 +262,41 @@ func (ar *AuthRoutes) sendWelcomeEmail(name, email string) {
 	}
 }
 
+func (ar *AuthRoutes) sendNewDeviceEmail(name, email, userAgent, ipAddress string) {
+	if ar.mailer == nil {
+		return
+	}
+
+	if userAgent == "" {
+		userAgent = "unknown device"
+	}
+	loggedInAt := time.Now().UTC().Format("2006-01-02 15:04 MST")
+	sessionsURL := mailerpkg.SanitizeURL(ar.appBaseURL + "/settings/sessions")
+	if sessionsURL == "" {
+		sessionsURL = ar.appBaseURL + "/settings/sessions"
+	}
+
+	html := fmt.Sprintf(`
+		<h2>New login to %s</h2>
+		<p>Hi %s,</p>
+		<p>Your account was just signed in from a new device.</p>
+		<p>Device: %s<br>IP address: %s<br>Time: %s</p>
+		<p>If this was you, there is nothing to do. Otherwise <a href="%s">review your sessions</a> and change your password.</p>
+	`, mailerpkg.EscapeHTML(ar.appName), mailerpkg.EscapeHTML(strings.TrimSpace(name)), mailerpkg.EscapeHTML(userAgent), mailerpkg.EscapeHTML(ipAddress), loggedInAt, sessionsURL)
+	text := fmt.Sprintf("New login to %s\n\nHi %s,\nYour account was just signed in from a new device.\nDevice: %s\nIP address: %s\nTime: %s\n\nIf this wasn't you, review your sessions and change your password: %s",
+		ar.appName, strings.TrimSpace(name), userAgent, ipAddress, loggedInAt, sessionsURL)
+
+	_, err := ar.mailer.Send(&mailerproviders.EmailData{
+		To:      []string{email},
+		Subject: fmt.Sprintf("New login to your %s account", ar.appName),
+		HTML:    html,
+		Text:    text,
+	})
+	if err != nil {
+		log.Printf("new device email failed for %s: %v", email, err)
+	}
+}
+
 // Register handles client signup
 func (ar *AuthRoutes) Register(c echo.Context) error {
 	var req struct {
@@ -105,10 +325,17 @@ func (ar *AuthRoutes) Register(c echo.Context) error {
 		return c.JSON(http.StatusConflict, map[string]string{"error": "email already exists"})
 	}
 
-	accessToken, _ := auth.GenerateAccessToken(client.ID, client.Email, ar.jwtSecret)
-	refreshToken, _ := auth.GenerateRefreshToken(client.ID, client.Email, ar.jwtSecret)
+	accessToken, refreshToken, _, err := ar.issueTokens(c, client.ID, client.Email)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to issue tokens"})
+	}
 
 	ar.sendWelcomeEmail(client.Name, client.Email)
+	if ar.mailer != nil {
+		if err := ar.emailVerify.sendSignupVerification(client); err != nil {
+			log.Printf("verification email failed for %s: %v", client.Email, err)
+		}
+	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"client":        client,
@@ -122,7 +349,8 @@ func (ar *AuthRoutes) CreateClient(c echo.Context) error {
 	return ar.Register(c)
 }
 
-// Login handles client authentication
+// Login handles client authentication.
+// Clients with two-factor authentication get an MFA challenge token to exchange at VerifyMFALogin instead of tokens.
 func (ar *AuthRoutes) Login(c echo.Context) error {
 	var req struct {
 		Email    string `json:"email"`
@@ -134,8 +362,19 @@ func (ar *AuthRoutes) Login(c echo.Context) error {
 	}
 
 	req.Email = normalizeEmail(req.Email)
+
+	wait, err := ar.loginBlockedFor(req.Email, c.RealIP())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check login attempts"})
+	}
+	if wait > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many failed login attempts; try again later"})
+	}
+
 	client, err := ar.clientRepo.GetClientByEmail(req.Email)
 	if err != nil {
+		ar.recordLoginFailure(c, req.Email, nil)
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
 	}
 	if client.Status != "active" {
@@ -143,11 +382,111 @@ func (ar *AuthRoutes) Login(c echo.Context) error {
 	}
 
 	if !auth.VerifyPassword(req.Password, client.PasswordHash) {
+		ar.recordLoginFailure(c, req.Email, client)
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
 	}
 
-	accessToken, _ := auth.GenerateAccessToken(client.ID, client.Email, ar.jwtSecret)
-	refreshToken, _ := auth.GenerateRefreshToken(client.ID, client.Email, ar.jwtSecret)
+	if err := ar.loginRepo.ClearLoginFailures(repository.LoginScopeAccount, req.Email); err != nil {
+		log.Printf("clearing login failures failed for %s: %v", req.Email, err)
+	}
+
+	challenge, err := ar.mfaChallenge(client)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if challenge != nil {
+		return c.JSON(http.StatusOK, challenge)
+	}
+
+	accessToken, refreshToken, newDevice, err := ar.issueTokens(c, client.ID, client.Email)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to issue tokens"})
+	}
+	if newDevice {
+		ar.sendNewDeviceEmail(client.Name, client.Email, c.Request().UserAgent(), c.RealIP())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"client":        client,
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+// mfaChallenge returns the response asking a client with two-factor authentication for a second factor,
+// or nil when tokens can be issued right away
+func (ar *AuthRoutes) mfaChallenge(client *models.Client) (map[string]interface{}, error) {
+	mfaEnabled, err := ar.mfa.enabled(client.ID)
+	if err != nil {
+		return nil, errors.New("failed to check two-factor status")
+	}
+	if !mfaEnabled {
+		return nil, nil
+	}
+
+	mfaToken, err := auth.GenerateMFAChallengeToken(client.ID, client.Email, ar.jwtSecret)
+	if err != nil {
+		return nil, errors.New("failed to issue tokens")
+	}
+
+	return map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(auth.MFAChallengeTTL.Seconds()),
+	}, nil
+}
+
+// VerifyMFALogin completes a two-step login with the MFA challenge token and a TOTP or recovery code
+func (ar *AuthRoutes) VerifyMFALogin(c echo.Context) error {
+	var req struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.MFAToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "mfa_token required"})
+	}
+
+	claims, err := auth.ValidateMFAChallengeToken(req.MFAToken, ar.jwtSecret)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired mfa token"})
+	}
+
+	client, err := ar.clientRepo.GetClientByID(claims.ClientID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired mfa token"})
+	}
+	if client.Status != "active" {
+		return c.JSON(http.StatusForbidden, accountPausedResponse(ar.clientRepo, client.ID))
+	}
+
+	if ok, err := ar.mfa.allowAttempt(c, client.ID); !ok {
+		return err
+	}
+
+	ok, err := ar.mfa.verifySecondFactor(client.ID, req.Code, req.RecoveryCode)
+	if errors.Is(err, errSecondFactorRequired) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify code"})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid code"})
+	}
+
+	accessToken, refreshToken, newDevice, err := ar.issueTokens(c, client.ID, client.Email)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to issue tokens"})
+	}
+	if newDevice {
+		ar.sendNewDeviceEmail(client.Name, client.Email, c.Request().UserAgent(), c.RealIP())
+	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"client":        client,
@@ -156,7 +495,8 @@ func (ar *AuthRoutes) Login(c echo.Context) error {
 	})
 }
 
-// RefreshToken generates new access token from refresh token
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// The presented token stops working; presenting it again revokes every token of that login.
 func (ar *AuthRoutes) RefreshToken(c echo.Context) error {
 	var req struct {
 		RefreshToken string `json:"refresh_token"`
@@ -166,7 +506,7 @@ func (ar *AuthRoutes) RefreshToken(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
 
-	claims, err := auth.ValidateToken(req.RefreshToken, ar.jwtSecret)
+	claims, err := auth.ValidateRefreshToken(req.RefreshToken, ar.jwtSecret)
 	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
 	}
@@ -184,13 +524,154 @@ func (ar *AuthRoutes) RefreshToken(c echo.Context) error {
 		email = client.Email
 	}
 
-	accessToken, _ := auth.GenerateAccessToken(claims.ClientID, email, ar.jwtSecret)
+	refreshToken, expiresAt, err := auth.GenerateRefreshToken(claims.ClientID, email, ar.jwtSecret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to issue tokens"})
+	}
+
+	sessionID, err := ar.refreshRepo.RotateRefreshToken(claims.ClientID, req.RefreshToken, refreshToken, expiresAt, c.RealIP())
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenReused):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "refresh token was already used; this login has been signed out"})
+	case errors.Is(err, repository.ErrRefreshTokenInvalid):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to refresh token"})
+	}
+
+	accessToken, err := auth.GenerateAccessToken(claims.ClientID, email, sessionID, ar.jwtSecret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to issue tokens"})
+	}
 
 	return c.JSON(http.StatusOK, map[string]string{
-		"access_token": accessToken,
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+// Logout revokes the refresh token and every token rotated from the same login,
+// which ends the session and with it the access tokens issued for it.
+func (ar *AuthRoutes) Logout(c echo.Context) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	claims, err := auth.ValidateRefreshToken(req.RefreshToken, ar.jwtSecret)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+	}
+
+	if err := ar.refreshRepo.RevokeRefreshTokenFamily(claims.ClientID, req.RefreshToken); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to log out"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "logged out"})
+}
+
+// LogoutAll revokes every refresh token of the authenticated client, signing out all logins
+func (ar *AuthRoutes) LogoutAll(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	revoked, err := ar.sessionRepo.RevokeClientSessions(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to log out"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"message": "logged out everywhere",
+		"revoked": revoked,
 	})
 }
 
+// ListSessions returns the authenticated client's active sessions, marking the one making the request
+func (ar *AuthRoutes) ListSessions(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	currentID, _ := c.Get("session_id").(string)
+
+	sessions, err := ar.sessionRepo.ListActiveSessions(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list sessions"})
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"sessions": sessions})
+}
+
+// RevokeSession signs out one of the authenticated client's sessions.
+// Its refresh and access tokens stop working.
+func (ar *AuthRoutes) RevokeSession(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+	}
+
+	revoked, err := ar.sessionRepo.RevokeSession(clientID, sessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke session"})
+	}
+	if !revoked {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "session revoked"})
+}
+
+// CleanupSessions deletes expired refresh tokens, then sessions that ended and were last seen before the retention period
+func (ar *AuthRoutes) CleanupSessions() (int64, int64, error) {
+	tokens, err := ar.refreshRepo.DeleteExpiredRefreshTokens()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sessions, err := ar.sessionRepo.DeleteStaleSessions(sessionRetention)
+	if err != nil {
+		return tokens, 0, err
+	}
+
+	return tokens, sessions, nil
+}
+
+// UnlockAccount lifts a lockout with the token from a lockout email; each token works once
+func (ar *AuthRoutes) UnlockAccount(c echo.Context) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token required"})
+	}
+
+	clientID, email, err := ar.loginRepo.UnlockAccount(req.Token)
+	if errors.Is(err, repository.ErrUnlockTokenInvalid) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid or expired unlock token"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to unlock account"})
+	}
+
+	ar.audit(c, "auth.account-unlocked", clientID, http.StatusOK, map[string]any{"email": email})
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "account unlocked"})
+}
+
+// CleanupLoginFailures deletes failed login counters that no longer matter
+func (ar *AuthRoutes) CleanupLoginFailures() (int64, error) {
+	return ar.loginRepo.DeleteStaleLoginFailures(loginFailureRetention)
+}
+
 // ForgotPassword sends password reset email with a short-lived token.
 func (ar *AuthRoutes) ForgotPassword(c echo.Context) error {
 	var req struct {
@@ -210,6 +691,11 @@ func (ar *AuthRoutes) ForgotPassword(c echo.Context) error {
 		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "email service not configured"})
 	}
 
+	if retryAfter, ok := ar.forgotThrottle.allow(req.Email, time.Now()); !ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many password reset requests for this email; try again later"})
+	}
+
 	client, err := ar.clientRepo.GetClientByEmail(req.Email)
 	if err != nil {
 		return c.JSON(http.StatusOK, map[string]string{"message": "if this email exists, password reset instructions were sent"})
@@ -218,30 +704,24 @@ func (ar *AuthRoutes) ForgotPassword(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"message": "if this email exists, password reset instructions were sent"})
 	}
 
-	token, err := auth.GeneratePasswordResetToken(client.ID, client.Email, ar.jwtSecret)
+	token, err := ar.resetRepo.CreateResetToken(client.ID, passwordResetTTL)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create reset token"})
 	}
 
-	resetURL := fmt.Sprintf("%s/reset-password?token=%s", ar.appBaseURL, url.QueryEscape(token))
-	safeResetURL := mailerpkg.SanitizeURL(resetURL)
-	if safeResetURL == "" {
-		safeResetURL = resetURL
+	template, err := mailerpkg.PasswordResetTemplate()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to send reset email"})
 	}
-	html := fmt.Sprintf(`
-		<h2>%s password reset</h2>
-		<p>Hi %s,</p>
-		<p>We got a request to reset your password.</p>
-		<p><a href="%s">Reset Password</a></p>
-		<p>This link expires in 1 hour.</p>
-	`, mailerpkg.EscapeHTML(ar.appName), mailerpkg.EscapeHTML(client.Name), safeResetURL)
-	text := fmt.Sprintf("%s password reset\n\nHi %s,\nReset your password: %s\nThis link expires in 1 hour.", ar.appName, client.Name, resetURL)
 
-	_, err = ar.mailer.Send(&mailerproviders.EmailData{
+	_, err = mailerpkg.SendWithTypedTemplate(ar.mailer, template, mailertemplates.PasswordResetContext{
+		Company:     ar.appName,
+		UserName:    client.Name,
+		ResetURL:    fmt.Sprintf("%s/reset-password?token=%s", ar.appBaseURL, url.QueryEscape(token)),
+		ExpiryHours: registry.PasswordResetExpiryHours,
+	}, &mailerproviders.EmailData{
 		To:      []string{client.Email},
 		Subject: fmt.Sprintf("%s password reset", ar.appName),
-		HTML:    html,
-		Text:    text,
 	})
 	if err != nil {
 		log.Printf("forgot password email failed for %s: %v", client.Email, err)
@@ -251,7 +731,7 @@ func (ar *AuthRoutes) ForgotPassword(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"message": "if this email exists, password reset instructions were sent"})
 }
 
-// ResetPassword resets account password using a valid reset token.
+// ResetPassword resets account password using a valid reset token; each token works once.
 func (ar *AuthRoutes) ResetPassword(c echo.Context) error {
 	var req struct {
 		Token       string `json:"token"`
@@ -266,26 +746,28 @@ func (ar *AuthRoutes) ResetPassword(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token and new_password required"})
 	}
 
-	claims, err := auth.ValidatePasswordResetToken(req.Token, ar.jwtSecret)
+	passwordHash, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to process password"})
 	}
 
-	client, err := ar.clientRepo.GetClientByID(claims.ClientID)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "account not found"})
-	}
-	if client.Status != "active" {
-		return c.JSON(http.StatusForbidden, accountPausedResponse(ar.clientRepo, client.ID))
+	clientID, err := ar.resetRepo.ResetPassword(strings.TrimSpace(req.Token), passwordHash)
+	if errors.Is(err, repository.ErrResetTokenInvalid) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
 	}
-
-	passwordHash, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to process password"})
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update password"})
 	}
 
-	if err := ar.clientRepo.UpdateClientPassword(claims.ClientID, passwordHash); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to update password"})
+	// Whoever knew the old password may hold a refresh token
+	if _, err := ar.sessionRepo.RevokeClientSessions(clientID); err != nil {
+		log.Printf("failed to revoke sessions after password reset for %s: %v", clientID, err)
+	}
+	// The new password was set from the account's inbox, so a lockout no longer protects anything
+	if client, err := ar.clientRepo.GetClientByID(clientID); err == nil {
+		if err := ar.loginRepo.ClearLoginFailures(repository.LoginScopeAccount, client.Email); err != nil {
+			log.Printf("clearing login failures failed for %s: %v", client.Email, err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "password updated successfully"})
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// forgotPasswordLimit is how many reset emails one address may request per forgotPasswordWindow
+	forgotPasswordLimit  = 3
+	forgotPasswordWindow = 15 * time.Minute
+)
+
+// Failed logins are counted per account and per IP address in the database, so the limits hold across instances.
+// Past a threshold each further failure doubles the wait before the next attempt; an account locks outright
+// after loginLockoutAfter failures and its owner is emailed an unlock link.
+const (
+	// loginFailureWindow is how long a failure counts; a failure after a quieter period starts the count over
+	loginFailureWindow = time.Hour
+	// accountBackoffAfter is how many failures an account takes before attempts are delayed
+	accountBackoffAfter = 3
+	// ipBackoffAfter is how many failures an IP address takes before attempts are delayed; it is higher
+	// than the account limit because offices and mobile carriers share addresses
+	ipBackoffAfter = 20
+	// maxLoginBackoff caps the delay between attempts
+	maxLoginBackoff = 15 * time.Minute
+	// loginLockoutAfter is how many failures lock an account for loginLockoutDuration
+	loginLockoutAfter    = 10
+	loginLockoutDuration = 30 * time.Minute
+	// unlockTokenTTL is how long the link in a lockout email works
+	unlockTokenTTL = 24 * time.Hour
+)
+
+// loginBackoff returns the delay before the next login attempt after the given number of failures:
+// nothing below the threshold, then one second doubling with each failure up to maxLoginBackoff
+func loginBackoff(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	if failures-threshold >= 10 {
+		return maxLoginBackoff
+	}
+	delay := time.Second << (failures - threshold)
+	if delay > maxLoginBackoff {
+		return maxLoginBackoff
+	}
+	return delay
+}
+
+// emailThrottle counts requests per email address in fixed windows.
+// Addresses are throttled whether or not they belong to an account, so responses do not reveal which do.
+// Counts live in memory, so each instance enforces the limit on its own.
+type emailThrottle struct {
+	limit     int
+	window    time.Duration
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newEmailThrottle(limit int, window time.Duration) *emailThrottle {
+	return &emailThrottle{limit: limit, window: window, windows: make(map[string]*rateWindow)}
+}
+
+// allow records a request for the address, or returns false with the time until its window resets
+func (t *emailThrottle) allow(email string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Drop windows that have ended so the map does not grow with every address ever seen
+	if now.Sub(t.lastSweep) >= t.window {
+		for address, window := range t.windows {
+			if now.Sub(window.start) >= t.window {
+				delete(t.windows, address)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	window, ok := t.windows[email]
+	if !ok || now.Sub(window.start) >= t.window {
+		window = &rateWindow{start: now}
+		t.windows[email] = window
+	}
+
+	if window.count >= t.limit {
+		return window.start.Add(t.window).Sub(now), false
+	}
+	window.count++
+
+	return 0, true
+}
@@ -5,6 +5,7 @@ import (
 	"file-service/pkg/repository"
 	"file-service/pkg/s3"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,16 +17,20 @@ import (
 const accountDeletionGraceDays = 90
 
 type ClientRoutes struct {
-	clientRepo *repository.ClientRepository
-	assetRepo  *repository.AssetRepository
-	s3Client   *s3.S3
+	clientRepo        *repository.ClientRepository
+	assetRepo         *repository.AssetRepository
+	sessionRepo       *repository.SessionRepository
+	emailVerification *EmailVerificationRoutes
+	s3Client          *s3.S3
 }
 
-func NewClientRoutes(clientRepo *repository.ClientRepository, assetRepo *repository.AssetRepository, s3Client *s3.S3) *ClientRoutes {
+func NewClientRoutes(clientRepo *repository.ClientRepository, assetRepo *repository.AssetRepository, sessionRepo *repository.SessionRepository, emailVerification *EmailVerificationRoutes, s3Client *s3.S3) *ClientRoutes {
 	return &ClientRoutes{
-		clientRepo: clientRepo,
-		assetRepo:  assetRepo,
-		s3Client:   s3Client,
+		clientRepo:        clientRepo,
+		assetRepo:         assetRepo,
+		sessionRepo:       sessionRepo,
+		emailVerification: emailVerification,
+		s3Client:          s3Client,
 	}
 }
 
@@ -163,7 +168,7 @@ func (cr *ClientRoutes) UpdateMyClient(c echo.Context) error {
 
 	needsProfileUpdate := false
 	newName := current.Name
-	newEmail := current.Email
+	pendingEmail := ""
 
 	if req.Name != nil {
 		trimmedName := strings.TrimSpace(*req.Name)
@@ -179,44 +184,62 @@ func (cr *ClientRoutes) UpdateMyClient(c echo.Context) error {
 		if normalizedEmail == "" {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "email cannot be empty"})
 		}
-		newEmail = normalizedEmail
-		needsProfileUpdate = true
-	}
-
-	if !needsProfileUpdate && req.Password == nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nothing to update"})
-	}
-
-	if needsProfileUpdate {
-		_, err := cr.clientRepo.UpdateClientProfile(clientID, newName, newEmail)
-		if err != nil {
-			if strings.Contains(strings.ToLower(err.Error()), "duplicate") {
+		if normalizedEmail != current.Email {
+			if cr.emailVerification.mailer == nil {
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "email service not configured; email changes need confirmation"})
+			}
+			if _, err := cr.clientRepo.GetClientByEmail(normalizedEmail); err == nil {
 				return c.JSON(http.StatusConflict, map[string]string{"error": "email already exists"})
 			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update client profile"})
+			pendingEmail = normalizedEmail
 		}
 	}
 
+	passwordHash := ""
 	if req.Password != nil {
 		trimmedPassword := strings.TrimSpace(*req.Password)
 		if trimmedPassword == "" {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "password cannot be empty"})
 		}
-
-		passwordHash, err := auth.HashPassword(trimmedPassword)
+		passwordHash, err = auth.HashPassword(trimmedPassword)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to process password"})
 		}
+	}
+
+	if !needsProfileUpdate && pendingEmail == "" && req.Password == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nothing to update"})
+	}
+
+	if needsProfileUpdate {
+		if _, err := cr.clientRepo.UpdateClientProfile(clientID, newName); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update client profile"})
+		}
+	}
 
+	// The new address takes over only once it is confirmed through the emailed link
+	if pendingEmail != "" {
+		if err := cr.emailVerification.requestEmailChange(current, pendingEmail); err != nil {
+			log.Printf("email change confirmation failed for %s: %v", clientID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to send email change confirmation"})
+		}
+	}
+
+	if req.Password != nil {
 		if err := cr.clientRepo.UpdateClientPassword(clientID, passwordHash); err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update password"})
 		}
+
+		if _, err := cr.sessionRepo.RevokeClientSessions(clientID); err != nil {
+			log.Printf("failed to revoke sessions after password change for %s: %v", clientID, err)
+		}
 	}
 
 	updated, err := cr.clientRepo.GetClientByID(clientID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch updated client"})
 	}
+	updated.PendingEmail = pendingEmail
 
 	return c.JSON(http.StatusOK, updated)
 }
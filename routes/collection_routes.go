@@ -0,0 +1,338 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/cache"
+	"file-service/pkg/models"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxCollectionAssetsPerRequest caps how many assets one add or reorder request may list
+const maxCollectionAssetsPerRequest = 1000
+
+type CollectionRoutes struct {
+	collectionRepo *repository.CollectionRepository
+	assetRepo      *repository.AssetRepository
+	projectRepo    *repository.ProjectRepository
+	memberRepo     *repository.MemberRepository
+	access         *projectAccess
+	s3Client       *s3.S3
+	urlCache       *cache.URLCache
+}
+
+func NewCollectionRoutes(collectionRepo *repository.CollectionRepository, assetRepo *repository.AssetRepository, projectRepo *repository.ProjectRepository, memberRepo *repository.MemberRepository, checker *rbac.RBACChecker, s3Client *s3.S3, urlCache *cache.URLCache) *CollectionRoutes {
+	return &CollectionRoutes{
+		collectionRepo: collectionRepo,
+		assetRepo:      assetRepo,
+		projectRepo:    projectRepo,
+		memberRepo:     memberRepo,
+		access:         newProjectAccess(memberRepo, checker),
+		s3Client:       s3Client,
+		urlCache:       urlCache,
+	}
+}
+
+// checkProjectAccess writes a 403 and returns false unless the client's project role allows the action on the project's files
+func (cr *CollectionRoutes) checkProjectAccess(c echo.Context, projectID string, action rbac.Action) (bool, error) {
+	if _, err := cr.access.authorize(c, projectID, presets.ResourceFile, action); err != nil {
+		return false, cr.access.respond(c, err)
+	}
+	return true, nil
+}
+
+// loadCollection fetches the collection named by :id and checks access to its project
+func (cr *CollectionRoutes) loadCollection(c echo.Context, action rbac.Action) (*models.Collection, bool, error) {
+	collection, err := cr.collectionRepo.GetCollection(c.Param("id"))
+	if err != nil {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "collection not found"})
+	}
+
+	ok, err := cr.checkProjectAccess(c, collection.ProjectID, action)
+	if !ok {
+		return nil, false, err
+	}
+
+	return collection, true, nil
+}
+
+// checkProjectAssets writes a 400 and returns false unless every asset belongs to the project
+func (cr *CollectionRoutes) checkProjectAssets(c echo.Context, projectID string, assetIDs []string) (bool, error) {
+	found, err := cr.assetRepo.FilterAssetIDsInProject(projectID, assetIDs)
+	if err != nil {
+		return false, c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check assets"})
+	}
+
+	present := make(map[string]bool, len(found))
+	for _, id := range found {
+		present[id] = true
+	}
+
+	missing := make([]string, 0)
+	for _, id := range assetIDs {
+		if !present[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return false, c.JSON(http.StatusBadRequest, map[string]any{
+			"error":     "assets not found in project",
+			"asset_ids": missing,
+		})
+	}
+
+	return true, nil
+}
+
+func (cr *CollectionRoutes) CreateCollection(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+
+	var req struct {
+		Name         string  `json:"name"`
+		Description  string  `json:"description"`
+		CoverAssetID *string `json:"cover_asset_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name required"})
+	}
+
+	if ok, err := cr.checkProjectAccess(c, projectID, presets.ActionWrite); !ok {
+		return err
+	}
+
+	if req.CoverAssetID != nil && *req.CoverAssetID == "" {
+		req.CoverAssetID = nil
+	}
+	if req.CoverAssetID != nil {
+		if ok, err := cr.checkProjectAssets(c, projectID, []string{*req.CoverAssetID}); !ok {
+			return err
+		}
+	}
+
+	collection, err := cr.collectionRepo.CreateCollection(projectID, clientID, req.Name, req.Description, req.CoverAssetID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create collection"})
+	}
+
+	return c.JSON(http.StatusCreated, collection)
+}
+
+func (cr *CollectionRoutes) GetCollections(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if ok, err := cr.checkProjectAccess(c, projectID, presets.ActionRead); !ok {
+		return err
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	collections, info, err := cr.collectionRepo.ListCollections(projectID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get collections"})
+	}
+
+	return c.JSON(http.StatusOK, pageResponse("collections", collections, page, info))
+}
+
+func (cr *CollectionRoutes) GetCollection(c echo.Context) error {
+	collection, ok, err := cr.loadCollection(c, presets.ActionRead)
+	if !ok {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, collection)
+}
+
+func (cr *CollectionRoutes) UpdateCollection(c echo.Context) error {
+	var req models.CollectionUpdate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "name cannot be empty"})
+		}
+		req.Name = &name
+	}
+
+	collection, ok, err := cr.loadCollection(c, presets.ActionWrite)
+	if !ok {
+		return err
+	}
+
+	if req.CoverAssetID != nil && *req.CoverAssetID != "" {
+		if ok, err := cr.checkProjectAssets(c, collection.ProjectID, []string{*req.CoverAssetID}); !ok {
+			return err
+		}
+	}
+
+	updated, err := cr.collectionRepo.UpdateCollection(collection.ID, req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update collection"})
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+func (cr *CollectionRoutes) DeleteCollection(c echo.Context) error {
+	collection, ok, err := cr.loadCollection(c, presets.ActionDelete)
+	if !ok {
+		return err
+	}
+
+	if err := cr.collectionRepo.DeleteCollection(collection.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete collection"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "collection deleted"})
+}
+
+// GetCollectionAssets lists a collection in order with presigned URLs, like GetAssets.
+// Assets in folders the caller is denied are left out.
+func (cr *CollectionRoutes) GetCollectionAssets(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	collection, ok, err := cr.loadCollection(c, presets.ActionRead)
+	if !ok {
+		return err
+	}
+
+	project, _ := cr.projectRepo.FindProjectByID(collection.ProjectID)
+	expiresIn, err := parseExpiresIn(c.QueryParam("expires_in"), resolveURLLimits(cr.s3Client, project).downloadTTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	assets, info, err := cr.collectionRepo.GetCollectionAssets(collection.ID, clientID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get collection assets"})
+	}
+
+	for i := range assets {
+		if presignedURL, err := cr.s3Client.GenerateDownloadLinkWithExpiry(assets[i].S3Key, cr.urlCache, expiresIn); err == nil {
+			assets[i].PresignedURL = presignedURL
+		}
+	}
+
+	return c.JSON(http.StatusOK, pageResponse("assets", assets, page, info))
+}
+
+// AddCollectionAssets adds assets at the end of a collection, or at position when given
+func (cr *CollectionRoutes) AddCollectionAssets(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		AssetIDs []string `json:"asset_ids"`
+		Position *int     `json:"position"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if len(req.AssetIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "asset_ids required"})
+	}
+	if len(req.AssetIDs) > maxCollectionAssetsPerRequest {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "too many asset_ids"})
+	}
+	if req.Position != nil && *req.Position < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "position must not be negative"})
+	}
+
+	collection, ok, err := cr.loadCollection(c, presets.ActionWrite)
+	if !ok {
+		return err
+	}
+
+	if ok, err := cr.checkProjectAssets(c, collection.ProjectID, req.AssetIDs); !ok {
+		return err
+	}
+
+	added, err := cr.collectionRepo.AddCollectionAssets(collection.ID, req.AssetIDs, req.Position, clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to add assets to collection"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"message": "assets added to collection",
+		"added":   added,
+	})
+}
+
+func (cr *CollectionRoutes) RemoveCollectionAsset(c echo.Context) error {
+	collection, ok, err := cr.loadCollection(c, presets.ActionWrite)
+	if !ok {
+		return err
+	}
+
+	if err := cr.collectionRepo.RemoveCollectionAsset(collection.ID, c.Param("asset_id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not in collection"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "asset removed from collection"})
+}
+
+// ReorderCollectionAssets replaces the order of a collection with the given list of every member
+func (cr *CollectionRoutes) ReorderCollectionAssets(c echo.Context) error {
+	var req struct {
+		AssetIDs []string `json:"asset_ids"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if len(req.AssetIDs) > maxCollectionAssetsPerRequest {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "too many asset_ids"})
+	}
+
+	seen := make(map[string]bool, len(req.AssetIDs))
+	for _, id := range req.AssetIDs {
+		if seen[id] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "duplicate asset id: " + id})
+		}
+		seen[id] = true
+	}
+
+	collection, ok, err := cr.loadCollection(c, presets.ActionWrite)
+	if !ok {
+		return err
+	}
+
+	err = cr.collectionRepo.ReorderCollectionAssets(collection.ID, req.AssetIDs)
+	if errors.Is(err, repository.ErrCollectionOrderMismatch) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to reorder collection"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "collection reordered"})
+}
@@ -0,0 +1,374 @@
+package routes
+
+import (
+	"errors"
+	mailerpkg "file-service/pkg/mailer"
+	mailerproviders "file-service/pkg/mailer/providers"
+	"file-service/pkg/models"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxCommentLength caps the body of a comment in characters
+const maxCommentLength = 10000
+
+// mentionPattern matches @email mentions in a comment body
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.])@([A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+type CommentRoutes struct {
+	commentRepo *repository.CommentRepository
+	assetRepo   *repository.AssetRepository
+	projectRepo *repository.ProjectRepository
+	memberRepo  *repository.MemberRepository
+	access      *folderAccess
+	mailer      *mailerpkg.EmailService
+	appBaseURL  string
+	appName     string
+}
+
+func NewCommentRoutes(commentRepo *repository.CommentRepository, assetRepo *repository.AssetRepository, projectRepo *repository.ProjectRepository, memberRepo *repository.MemberRepository, aclRepo *repository.FolderACLRepository, checker *rbac.RBACChecker, mailer *mailerpkg.EmailService, appBaseURL string, appName string) *CommentRoutes {
+	return &CommentRoutes{
+		commentRepo: commentRepo,
+		assetRepo:   assetRepo,
+		projectRepo: projectRepo,
+		memberRepo:  memberRepo,
+		access:      newFolderAccess(memberRepo, aclRepo, checker),
+		mailer:      mailer,
+		appBaseURL:  strings.TrimRight(appBaseURL, "/"),
+		appName:     appName,
+	}
+}
+
+// parseMentions returns the distinct lowercased emails mentioned in body
+func parseMentions(body string) []string {
+	seen := make(map[string]bool)
+	emails := make([]string, 0)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(strings.TrimRight(match[1], "."))
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// validateCommentBody trims a comment body and checks its length
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("body required")
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fmt.Errorf("body must be at most %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+// validateAnnotation checks that a region is only set on images and timestamps only on audio or video
+func validateAnnotation(asset *repository.Asset, region *models.CommentRegion, start, end *float64) error {
+	mimeType := strings.ToLower(asset.MimeType)
+
+	if region != nil {
+		if !strings.HasPrefix(mimeType, "image/") {
+			return fmt.Errorf("region annotations are only supported on images")
+		}
+		if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 ||
+			region.X+region.Width > 1 || region.Y+region.Height > 1 {
+			return fmt.Errorf("region must lie within the image, as fractions between 0 and 1")
+		}
+	}
+
+	if start == nil && end != nil {
+		return fmt.Errorf("timestamp_end requires timestamp_start")
+	}
+	if start != nil {
+		if !strings.HasPrefix(mimeType, "video/") && !strings.HasPrefix(mimeType, "audio/") {
+			return fmt.Errorf("timestamps are only supported on audio and video")
+		}
+		if *start < 0 {
+			return fmt.Errorf("timestamp_start must not be negative")
+		}
+		if end != nil && *end < *start {
+			return fmt.Errorf("timestamp_end must not be before timestamp_start")
+		}
+	}
+
+	return nil
+}
+
+// loadAsset fetches the asset named by :id and checks the client may read its folder and act on its comments
+func (cr *CommentRoutes) loadAsset(c echo.Context, action rbac.Action) (*repository.Asset, bool, error) {
+	asset, err := cr.assetRepo.FindAssetByID(c.Param("id"))
+	if err != nil {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	role, err := cr.access.authorizeAsset(c, asset, folderRead)
+	if err != nil {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+	if err := cr.access.allows(role, presets.ResourceComment, action); err != nil {
+		return nil, false, c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	return asset, true, nil
+}
+
+// loadComment fetches the comment named by :id with its asset, checking the client may read the asset's folder.
+// The role returned is the client's effective role on that folder.
+func (cr *CommentRoutes) loadComment(c echo.Context) (*models.Comment, *repository.Asset, string, bool, error) {
+	comment, err := cr.commentRepo.GetComment(c.Param("id"))
+	if err != nil {
+		return nil, nil, "", false, c.JSON(http.StatusNotFound, map[string]string{"error": "comment not found"})
+	}
+
+	asset, err := cr.assetRepo.FindAssetByID(comment.AssetID)
+	if err != nil {
+		return nil, nil, "", false, c.JSON(http.StatusNotFound, map[string]string{"error": "comment not found"})
+	}
+
+	role, err := cr.access.authorizeAsset(c, asset, folderRead)
+	if err != nil {
+		return nil, nil, "", false, c.JSON(http.StatusNotFound, map[string]string{"error": "comment not found"})
+	}
+
+	return comment, asset, role, true, nil
+}
+
+// resolveMentions maps mentioned emails to project members; unknown emails are ignored
+func (cr *CommentRoutes) resolveMentions(projectID, body string) ([]models.Client, error) {
+	emails := parseMentions(body)
+	if len(emails) == 0 {
+		return nil, nil
+	}
+	return cr.memberRepo.FindMembersByEmail(projectID, emails)
+}
+
+func (cr *CommentRoutes) sendMentionEmails(comment *models.Comment, mentioned []models.Client, asset *repository.Asset) {
+	if cr.mailer == nil || len(mentioned) == 0 {
+		return
+	}
+
+	authorName := comment.AuthorName
+	if authorName == "" {
+		authorName = "A project member"
+	}
+	body := comment.Body
+	projectName := "a project"
+	if project, err := cr.projectRepo.FindProjectByID(asset.ProjectID); err == nil {
+		projectName = project.Name
+	}
+
+	assetURL := mailerpkg.SanitizeURL(fmt.Sprintf("%s/projects/%s/assets/%s", cr.appBaseURL, asset.ProjectID, asset.ID))
+	if assetURL == "" {
+		assetURL = fmt.Sprintf("%s/projects/%s/assets/%s", cr.appBaseURL, asset.ProjectID, asset.ID)
+	}
+
+	for _, member := range mentioned {
+		if comment.AuthorID != nil && member.ID == *comment.AuthorID {
+			continue
+		}
+
+		html := fmt.Sprintf(`
+			<h2>You were mentioned - %s</h2>
+			<p>%s mentioned you on <strong>%s</strong> in <strong>%s</strong>:</p>
+			<blockquote>%s</blockquote>
+			<p><a href="%s">Open asset</a></p>
+		`, mailerpkg.EscapeHTML(cr.appName), mailerpkg.EscapeHTML(authorName), mailerpkg.EscapeHTML(asset.OriginalFilename), mailerpkg.EscapeHTML(projectName), mailerpkg.EscapeHTML(body), assetURL)
+		text := fmt.Sprintf("%s mention\n\n%s mentioned you on %s in %s:\n\n%s\n\nOpen asset: %s", cr.appName, authorName, asset.OriginalFilename, projectName, body, assetURL)
+
+		_, err := cr.mailer.Send(&mailerproviders.EmailData{
+			To:      []string{member.Email},
+			Subject: fmt.Sprintf("%s mentioned you on %s", authorName, asset.OriginalFilename),
+			HTML:    html,
+			Text:    text,
+		})
+		if err != nil {
+			log.Printf("mention email failed for %s: %v", member.Email, err)
+		}
+	}
+}
+
+// GetComments lists the comment threads on every version of an asset
+func (cr *CommentRoutes) GetComments(c echo.Context) error {
+	asset, ok, err := cr.loadAsset(c, presets.ActionRead)
+	if !ok {
+		return err
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	comments, info, err := cr.commentRepo.ListComments(rootAssetID(asset), page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get comments"})
+	}
+
+	return c.JSON(http.StatusOK, pageResponse("comments", comments, page, info))
+}
+
+// CreateComment adds a comment or reply to the asset version named by :id
+func (cr *CommentRoutes) CreateComment(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Body           string                `json:"body"`
+		ParentID       *string               `json:"parent_id"`
+		Region         *models.CommentRegion `json:"region"`
+		TimestampStart *float64              `json:"timestamp_start"`
+		TimestampEnd   *float64              `json:"timestamp_end"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	body, err := validateCommentBody(req.Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	asset, ok, err := cr.loadAsset(c, presets.ActionWrite)
+	if !ok {
+		return err
+	}
+
+	if err := validateAnnotation(asset, req.Region, req.TimestampStart, req.TimestampEnd); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	root := rootAssetID(asset)
+	if req.ParentID != nil {
+		parent, err := cr.commentRepo.GetComment(*req.ParentID)
+		if err != nil || parent.RootAssetID != root {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "parent comment not found on this asset"})
+		}
+		// Replies to replies join the thread of the top-level comment
+		if parent.ParentID != nil {
+			req.ParentID = parent.ParentID
+		}
+	}
+
+	mentioned, err := cr.resolveMentions(asset.ProjectID, body)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to resolve mentions"})
+	}
+	mentionIDs := make([]string, 0, len(mentioned))
+	for _, member := range mentioned {
+		mentionIDs = append(mentionIDs, member.ID)
+	}
+
+	comment, err := cr.commentRepo.CreateComment(models.Comment{
+		AssetID:        asset.ID,
+		RootAssetID:    root,
+		ParentID:       req.ParentID,
+		AuthorID:       &clientID,
+		Body:           body,
+		Region:         req.Region,
+		TimestampStart: req.TimestampStart,
+		TimestampEnd:   req.TimestampEnd,
+		Mentions:       mentionIDs,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create comment"})
+	}
+
+	cr.sendMentionEmails(comment, mentioned, asset)
+
+	return c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateComment edits the body of a comment; only its author may edit it
+func (cr *CommentRoutes) UpdateComment(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	body, err := validateCommentBody(req.Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	comment, asset, _, ok, err := cr.loadComment(c)
+	if !ok {
+		return err
+	}
+	if comment.AuthorID == nil || *comment.AuthorID != clientID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only the author can edit a comment"})
+	}
+
+	mentioned, err := cr.resolveMentions(asset.ProjectID, body)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to resolve mentions"})
+	}
+
+	previous := make(map[string]bool, len(comment.Mentions))
+	for _, id := range comment.Mentions {
+		previous[id] = true
+	}
+	mentionIDs := make([]string, 0, len(mentioned))
+	newlyMentioned := make([]models.Client, 0)
+	for _, member := range mentioned {
+		mentionIDs = append(mentionIDs, member.ID)
+		if !previous[member.ID] {
+			newlyMentioned = append(newlyMentioned, member)
+		}
+	}
+
+	updated, err := cr.commentRepo.UpdateCommentBody(comment.ID, body, mentionIDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update comment"})
+	}
+
+	cr.sendMentionEmails(updated, newlyMentioned, asset)
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeleteComment removes a comment; its author and the project owner may delete it
+func (cr *CommentRoutes) DeleteComment(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	comment, _, role, ok, err := cr.loadComment(c)
+	if !ok {
+		return err
+	}
+
+	isAuthor := comment.AuthorID != nil && *comment.AuthorID == clientID
+	if !isAuthor && cr.access.allows(role, presets.ResourceComment, presets.ActionManage) != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only the author or a project owner can delete a comment"})
+	}
+
+	if err := cr.commentRepo.DeleteComment(comment.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete comment"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "comment deleted"})
+}
+
+// rootAssetID returns the first version of the chain an asset belongs to
+func rootAssetID(asset *repository.Asset) string {
+	if asset.ParentAssetID != nil {
+		return *asset.ParentAssetID
+	}
+	return asset.ID
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"errors"
+	mailerpkg "file-service/pkg/mailer"
+	mailerproviders "file-service/pkg/mailer/providers"
+	"file-service/pkg/mailer/registry"
+	mailertemplates "file-service/pkg/mailer/templates"
+	"file-service/pkg/models"
+	"file-service/pkg/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	emailVerificationTTL = registry.EmailVerificationExpiryHours * time.Hour
+	// resendVerificationCooldown is how long a client waits between verification emails
+	resendVerificationCooldown = time.Minute
+)
+
+type EmailVerificationRoutes struct {
+	verificationRepo *repository.EmailVerificationRepository
+	clientRepo       *repository.ClientRepository
+	mailer           *mailerpkg.EmailService
+	appBaseURL       string
+	appName          string
+}
+
+func NewEmailVerificationRoutes(verificationRepo *repository.EmailVerificationRepository, clientRepo *repository.ClientRepository, mailer *mailerpkg.EmailService, appBaseURL string, appName string) *EmailVerificationRoutes {
+	return &EmailVerificationRoutes{
+		verificationRepo: verificationRepo,
+		clientRepo:       clientRepo,
+		mailer:           mailer,
+		appBaseURL:       strings.TrimRight(appBaseURL, "/"),
+		appName:          appName,
+	}
+}
+
+func (vr *EmailVerificationRoutes) verificationURL(token string) string {
+	return fmt.Sprintf("%s/verify-email?token=%s", vr.appBaseURL, url.QueryEscape(token))
+}
+
+// sendSignupVerification emails the client a link confirming its address
+func (vr *EmailVerificationRoutes) sendSignupVerification(client *models.Client) error {
+	if vr.mailer == nil {
+		return errors.New("email service not configured")
+	}
+
+	token, err := vr.verificationRepo.CreateVerificationToken(client.ID, client.Email, repository.EmailVerificationSignup, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	template, err := mailerpkg.VerifyEmailTemplate()
+	if err != nil {
+		return err
+	}
+
+	_, err = mailerpkg.SendWithTypedTemplate(vr.mailer, template, mailertemplates.VerifyEmailContext{
+		Company:         vr.appName,
+		UserName:        client.Name,
+		VerificationURL: vr.verificationURL(token),
+		ExpiryHours:     registry.EmailVerificationExpiryHours,
+	}, &mailerproviders.EmailData{
+		To:      []string{client.Email},
+		Subject: fmt.Sprintf("Verify your %s email address", vr.appName),
+	})
+	return err
+}
+
+// requestEmailChange emails a confirmation link to the new address; the client's email changes once it is used
+func (vr *EmailVerificationRoutes) requestEmailChange(client *models.Client, newEmail string) error {
+	if vr.mailer == nil {
+		return errors.New("email service not configured")
+	}
+
+	token, err := vr.verificationRepo.CreateVerificationToken(client.ID, newEmail, repository.EmailVerificationChange, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	confirmURL := vr.verificationURL(token)
+	safeConfirmURL := mailerpkg.SanitizeURL(confirmURL)
+	if safeConfirmURL == "" {
+		safeConfirmURL = confirmURL
+	}
+	html := fmt.Sprintf(`
+		<h2>Confirm your new %s email address</h2>
+		<p>Hi %s,</p>
+		<p>You asked to change the email address of your account to this one.</p>
+		<p><a href="%s">Confirm email change</a></p>
+		<p>This link expires in %d hours. Until then you keep logging in with your current address.</p>
+	`, mailerpkg.EscapeHTML(vr.appName), mailerpkg.EscapeHTML(client.Name), safeConfirmURL, registry.EmailVerificationExpiryHours)
+	text := fmt.Sprintf("Confirm your new %s email address\n\nHi %s,\nConfirm the email change: %s\nThis link expires in %d hours.",
+		vr.appName, client.Name, confirmURL, registry.EmailVerificationExpiryHours)
+
+	_, err = vr.mailer.Send(&mailerproviders.EmailData{
+		To:      []string{newEmail},
+		Subject: fmt.Sprintf("Confirm your new %s email address", vr.appName),
+		HTML:    html,
+		Text:    text,
+	})
+	return err
+}
+
+// VerifyEmail confirms an address with the token from a verification email
+func (vr *EmailVerificationRoutes) VerifyEmail(c echo.Context) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token required"})
+	}
+
+	verification, err := vr.verificationRepo.ConfirmEmailVerification(req.Token)
+	switch {
+	case errors.Is(err, repository.ErrVerificationTokenInvalid):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid or expired verification token"})
+	case errors.Is(err, repository.ErrEmailTaken):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "email already exists"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify email"})
+	}
+
+	message := "email verified"
+	if verification.Purpose == repository.EmailVerificationChange {
+		message = "email changed"
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": message,
+		"email":   verification.Email,
+	})
+}
+
+// ResendVerification sends the authenticated client a new signup verification email
+func (vr *EmailVerificationRoutes) ResendVerification(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	client, err := vr.clientRepo.GetClientByID(clientID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "client not found"})
+	}
+	if client.EmailVerifiedAt != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "email already verified"})
+	}
+	if vr.mailer == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "email service not configured"})
+	}
+
+	recentlySent, err := vr.verificationRepo.VerificationSentWithin(clientID, repository.EmailVerificationSignup, resendVerificationCooldown)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to send verification email"})
+	}
+	if recentlySent {
+		c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", int(resendVerificationCooldown.Seconds())))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "verification email sent recently; try again shortly"})
+	}
+
+	if err := vr.sendSignupVerification(client); err != nil {
+		log.Printf("verification email failed for %s: %v", client.Email, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to send verification email"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "verification email sent"})
+}
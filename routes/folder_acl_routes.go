@@ -0,0 +1,212 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// folderAction is what a request does to the assets of a folder
+type folderAction int
+
+const (
+	// folderList lists the project; folders the caller is denied are filtered out instead of refused
+	folderList folderAction = iota
+	folderRead
+	folderWrite
+	folderDelete
+)
+
+// folderCapabilities names the RBAC resource and action each folder action needs
+var folderCapabilities = map[folderAction]struct {
+	resource rbac.Resource
+	action   rbac.Action
+}{
+	folderList:   {presets.ResourceFolder, presets.ActionRead},
+	folderRead:   {presets.ResourceFile, presets.ActionRead},
+	folderWrite:  {presets.ResourceFile, presets.ActionWrite},
+	folderDelete: {presets.ResourceFile, presets.ActionDelete},
+}
+
+// folderACLRoles are the roles a folder entry can set; none denies the subtree
+var folderACLRoles = map[string]bool{
+	"viewer": true,
+	"editor": true,
+	"none":   true,
+}
+
+// allowsFolder returns nil when an effective folder role permits the action
+func (pa *projectAccess) allowsFolder(role string, action folderAction) error {
+	if role == "" {
+		return errNotMember
+	}
+	if role == "none" {
+		if action == folderList {
+			return nil
+		}
+		return fmt.Errorf("%w: folder access denied", rbac.ErrDenied)
+	}
+	capability := folderCapabilities[action]
+	return pa.allows(role, capability.resource, capability.action)
+}
+
+// folderAccess resolves the caller's effective folder role for routes that reach assets
+type folderAccess struct {
+	*projectAccess
+	aclRepo *repository.FolderACLRepository
+}
+
+func newFolderAccess(memberRepo *repository.MemberRepository, aclRepo *repository.FolderACLRepository, checker *rbac.RBACChecker) *folderAccess {
+	return &folderAccess{projectAccess: newProjectAccess(memberRepo, checker), aclRepo: aclRepo}
+}
+
+// authorizeFolder returns the caller's effective role on a folder when it permits the action.
+// The error is errKeyProjectMismatch or errKeyFolderDenied for API keys used outside their scopes,
+// errNotMember for non-members and wraps rbac.ErrDenied when the role falls short.
+func (fa *folderAccess) authorizeFolder(c echo.Context, projectID, folderPath string, action folderAction) (string, error) {
+	clientID := c.Get("client_id").(string)
+
+	if !keyAllowsProject(c, projectID) {
+		return "", errKeyProjectMismatch
+	}
+	if action != folderList && !keyAllowsFolder(c, folderPath) {
+		return "", errKeyFolderDenied
+	}
+
+	role, err := fa.aclRepo.EffectiveRole(projectID, clientID, folderPath)
+	if err != nil {
+		return "", err
+	}
+	if err := fa.allowsFolder(role, action); err != nil {
+		return role, err
+	}
+
+	return role, nil
+}
+
+// authorizeAsset is authorizeFolder on the folder of an asset
+func (fa *folderAccess) authorizeAsset(c echo.Context, asset *repository.Asset, action folderAction) (string, error) {
+	return fa.authorizeFolder(c, asset.ProjectID, asset.FolderPath, action)
+}
+
+type FolderACLRoutes struct {
+	aclRepo    *repository.FolderACLRepository
+	memberRepo *repository.MemberRepository
+	access     *projectAccess
+}
+
+func NewFolderACLRoutes(aclRepo *repository.FolderACLRepository, memberRepo *repository.MemberRepository, checker *rbac.RBACChecker) *FolderACLRoutes {
+	return &FolderACLRoutes{
+		aclRepo:    aclRepo,
+		memberRepo: memberRepo,
+		access:     newProjectAccess(memberRepo, checker),
+	}
+}
+
+// ListFolderACLs returns every folder entry of the project (owner only)
+func (fr *FolderACLRoutes) ListFolderACLs(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := fr.access.authorize(c, projectID, presets.ResourceMember, presets.ActionManage); err != nil {
+		return fr.access.respond(c, err)
+	}
+
+	entries, err := fr.aclRepo.ListFolderACLs(projectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list folder acls"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"acls": entries})
+}
+
+// SetFolderACL grants or denies a member a role on a folder and its subfolders (owner only)
+func (fr *FolderACLRoutes) SetFolderACL(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+
+	if _, err := fr.access.authorize(c, projectID, presets.ResourceMember, presets.ActionManage); err != nil {
+		return fr.access.respond(c, err)
+	}
+
+	var req struct {
+		FolderPath string `json:"folder_path"`
+		ClientID   string `json:"client_id"`
+		Role       string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.Role = strings.ToLower(strings.TrimSpace(req.Role))
+	if req.ClientID == "" || !folderACLRoles[req.Role] {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "client_id and role (viewer, editor or none) required"})
+	}
+	for _, segment := range strings.Split(strings.Trim(req.FolderPath, "/"), "/") {
+		if segment == "." || segment == ".." {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid folder_path"})
+		}
+	}
+	folderPath := normalizeFolderPath(req.FolderPath)
+
+	isMember, role, err := fr.memberRepo.CheckMemberAccess(projectID, req.ClientID)
+	if err != nil || !isMember {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "client is not a member of this project"})
+	}
+	if role == "owner" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "owners always have full access"})
+	}
+
+	entry, err := fr.aclRepo.SetFolderACL(projectID, folderPath, req.ClientID, req.Role, clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save folder acl"})
+	}
+
+	return c.JSON(http.StatusOK, entry)
+}
+
+// DeleteFolderACL removes a folder entry so the member inherits from the parent folder again (owner only)
+func (fr *FolderACLRoutes) DeleteFolderACL(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := fr.access.authorize(c, projectID, presets.ResourceMember, presets.ActionManage); err != nil {
+		return fr.access.respond(c, err)
+	}
+
+	if err := fr.aclRepo.DeleteFolderACL(projectID, c.Param("acl_id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "folder acl not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "folder acl removed"})
+}
+
+// GetFolderAccess reports the caller's effective role on a folder
+func (fr *FolderACLRoutes) GetFolderAccess(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+	folderPath := normalizeFolderPath(c.QueryParam("folder_path"))
+
+	role, err := fr.aclRepo.EffectiveRole(projectID, clientID, folderPath)
+	if errors.Is(err, repository.ErrMFARequired) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check folder access"})
+	}
+	if role == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"folder_path": folderPath,
+		"role":        role,
+		"can_read":    fr.access.allowsFolder(role, folderRead) == nil,
+		"can_write":   fr.access.allowsFolder(role, folderWrite) == nil,
+		"can_delete":  fr.access.allowsFolder(role, folderDelete) == nil,
+	})
+}
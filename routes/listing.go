@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"file-service/pkg/workflow"
+
+	"github.com/labstack/echo/v4"
+)
+
+// listingQuery holds the sort and filter parameters shared by the file listing endpoints
+type listingQuery struct {
+	Sort          string
+	Order         string
+	MimeTypes     []string
+	Extensions    []string
+	SizeGT        *int64
+	SizeLT        *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Query         string
+	Tags          []string
+	Metadata      map[string]string
+	States        []workflow.State
+}
+
+var listingSortFields = map[string]bool{
+	"name":       true,
+	"created_at": true,
+	"size":       true,
+	"type":       true,
+}
+
+// parseListingQuery reads sort, order, mime, ext, size_gt, size_lt, created_after, created_before, q, tag, state and meta.<key>
+func parseListingQuery(c echo.Context) (*listingQuery, error) {
+	query := &listingQuery{
+		Sort:       strings.ToLower(c.QueryParam("sort")),
+		Order:      strings.ToLower(c.QueryParam("order")),
+		MimeTypes:  splitListParam(c.QueryParam("mime")),
+		Extensions: splitListParam(c.QueryParam("ext")),
+		Query:      strings.TrimSpace(c.QueryParam("q")),
+	}
+
+	if query.Sort != "" && !listingSortFields[query.Sort] {
+		return nil, fmt.Errorf("sort must be one of name, created_at, size, type")
+	}
+	if query.Order != "" && query.Order != "asc" && query.Order != "desc" {
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	for _, mimeType := range query.MimeTypes {
+		if !strings.Contains(mimeType, "/") {
+			return nil, fmt.Errorf("invalid mime type: %s", mimeType)
+		}
+	}
+
+	for _, state := range splitListParam(c.QueryParam("state")) {
+		if !workflow.ValidState(workflow.State(state)) {
+			return nil, fmt.Errorf("unknown state: %s", state)
+		}
+		query.States = append(query.States, workflow.State(state))
+	}
+
+	var err error
+	if query.Tags, err = normalizeTags(splitTags(c.QueryParam("tag"))); err != nil {
+		return nil, err
+	}
+	query.Metadata = make(map[string]string)
+	for key, value := range metadataFromValues(c.QueryParams()) {
+		key = strings.ToLower(key)
+		if err := validateMetadataKey(key); err != nil {
+			return nil, err
+		}
+		query.Metadata[key] = value
+	}
+
+	if query.SizeGT, err = parseSizeParam(c, "size_gt"); err != nil {
+		return nil, err
+	}
+	if query.SizeLT, err = parseSizeParam(c, "size_lt"); err != nil {
+		return nil, err
+	}
+	if query.CreatedAfter, err = parseTimeParam(c, "created_after"); err != nil {
+		return nil, err
+	}
+	if query.CreatedBefore, err = parseTimeParam(c, "created_before"); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+// AssetFilter converts the query into a repository filter for the given folder
+func (q *listingQuery) AssetFilter(folderPath *string) repository.AssetFilter {
+	return repository.AssetFilter{
+		FolderPath:    folderPath,
+		MimeTypes:     q.MimeTypes,
+		Extensions:    q.Extensions,
+		SizeGT:        q.SizeGT,
+		SizeLT:        q.SizeLT,
+		CreatedAfter:  q.CreatedAfter,
+		CreatedBefore: q.CreatedBefore,
+		Query:         q.Query,
+		Tags:          q.Tags,
+		Metadata:      q.Metadata,
+		States:        q.States,
+		Sort:          q.Sort,
+		Order:         q.Order,
+	}
+}
+
+// FilterOptions converts the query into the in-memory filter used for bucket listings
+func (q *listingQuery) FilterOptions() s3.FilterOptions {
+	options := s3.FilterOptions{
+		MimeTypes:       q.MimeTypes,
+		SizeGreaterThan: q.SizeGT,
+		SizeLessThan:    q.SizeLT,
+		ModifiedAfter:   q.CreatedAfter,
+		ModifiedBefore:  q.CreatedBefore,
+	}
+	if len(q.Extensions) > 0 {
+		options.FileTypes = q.Extensions
+	}
+	if q.Query != "" {
+		options.FilenameQuery = q.Query
+		options.FilenameFilterType = "contains"
+	}
+	return options
+}
+
+func splitListParam(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseSizeParam(c echo.Context, name string) (*int64, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+
+	size, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number of bytes", name)
+	}
+	return &size, nil
+}
+
+// parseTimeParam accepts RFC3339 timestamps or plain YYYY-MM-DD dates (UTC midnight)
+func parseTimeParam(c echo.Context, name string) (*time.Time, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return &t, nil
+	}
+	return nil, fmt.Errorf("%s must be an RFC3339 timestamp or YYYY-MM-DD date", name)
+}
+
+// parsePageRequest reads limit, cursor and include_total
+func parsePageRequest(c echo.Context) (repository.PageRequest, error) {
+	page := repository.PageRequest{
+		Limit: parseIntQueryParam(c.QueryParam("limit"), repository.DefaultPageLimit),
+	}
+	if page.Limit <= 0 {
+		page.Limit = repository.DefaultPageLimit
+	}
+	if page.Limit > repository.MaxPageLimit {
+		page.Limit = repository.MaxPageLimit
+	}
+
+	if raw := c.QueryParam("cursor"); raw != "" {
+		cursor, err := repository.DecodeCursor(raw)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = cursor
+	}
+
+	includeTotal, _ := strconv.ParseBool(c.QueryParam("include_total"))
+	page.IncludeTotal = includeTotal
+
+	return page, nil
+}
+
+// pageResponse wraps a page of items with its pagination details
+func pageResponse(key string, items any, page repository.PageRequest, info *repository.PageInfo) map[string]any {
+	response := map[string]any{
+		key:           items,
+		"limit":       page.Limit,
+		"has_more":    info.HasMore,
+		"next_cursor": info.NextCursor,
+	}
+	if info.Total != nil {
+		response["total"] = *info.Total
+	}
+	return response
+}
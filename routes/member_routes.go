@@ -1,8 +1,11 @@
 package routes
 
 import (
+	"errors"
 	mailerpkg "file-service/pkg/mailer"
 	mailerproviders "file-service/pkg/mailer/providers"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
 	"file-service/pkg/repository"
 	"fmt"
 	"log"
@@ -16,16 +19,18 @@ type MemberRoutes struct {
 	memberRepo  *repository.MemberRepository
 	projectRepo *repository.ProjectRepository
 	clientRepo  *repository.ClientRepository
+	access      *projectAccess
 	mailer      *mailerpkg.EmailService
 	appBaseURL  string
 	appName     string
 }
 
-func NewMemberRoutes(memberRepo *repository.MemberRepository, projectRepo *repository.ProjectRepository, clientRepo *repository.ClientRepository, mailer *mailerpkg.EmailService, appBaseURL string, appName string) *MemberRoutes {
+func NewMemberRoutes(memberRepo *repository.MemberRepository, projectRepo *repository.ProjectRepository, clientRepo *repository.ClientRepository, checker *rbac.RBACChecker, mailer *mailerpkg.EmailService, appBaseURL string, appName string) *MemberRoutes {
 	return &MemberRoutes{
 		memberRepo:  memberRepo,
 		projectRepo: projectRepo,
 		clientRepo:  clientRepo,
+		access:      newProjectAccess(memberRepo, checker),
 		mailer:      mailer,
 		appBaseURL:  strings.TrimRight(appBaseURL, "/"),
 		appName:     appName,
@@ -87,13 +92,8 @@ func (mr *MemberRoutes) InviteMember(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid role (owner, editor, viewer)"})
 	}
 
-	hasAccess, role, err := mr.memberRepo.CheckMemberAccess(projectID, clientID)
-	if err != nil || !hasAccess {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
-	}
-
-	if role != "owner" {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "only project owner can invite members"})
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceMember, presets.ActionWrite); err != nil {
+		return mr.access.respond(c, err)
 	}
 
 	invitedClient, err := mr.clientRepo.GetClientByEmail(req.Email)
@@ -115,7 +115,7 @@ func (mr *MemberRoutes) InviteMember(c echo.Context) error {
 	}
 
 	projectName := "your project"
-	if project, lookupErr := mr.projectRepo.GetProjectByID(projectID, clientID); lookupErr == nil && strings.TrimSpace(project.Name) != "" {
+	if project, lookupErr := mr.projectRepo.FindProjectByID(projectID); lookupErr == nil && strings.TrimSpace(project.Name) != "" {
 		projectName = project.Name
 	}
 
@@ -126,34 +126,38 @@ func (mr *MemberRoutes) InviteMember(c echo.Context) error {
 
 // GetMembers retrieves all members of a project
 func (mr *MemberRoutes) GetMembers(c echo.Context) error {
-	clientID := c.Get("client_id").(string)
 	projectID := c.Param("project_id")
 
-	hasAccess, _, err := mr.memberRepo.CheckMemberAccess(projectID, clientID)
-	if err != nil || !hasAccess {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "project not found or access denied"})
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceMember, presets.ActionRead); err != nil {
+		return mr.access.respond(c, err)
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	members, err := mr.memberRepo.GetProjectMembers(projectID)
+	members, info, err := mr.memberRepo.GetProjectMembers(projectID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get members"})
 	}
 
-	return c.JSON(http.StatusOK, members)
+	return c.JSON(http.StatusOK, pageResponse("members", members, page, info))
 }
 
 // RemoveMember removes a member from a project
 func (mr *MemberRoutes) RemoveMember(c echo.Context) error {
-	clientID := c.Get("client_id").(string)
 	projectID := c.Param("project_id")
 	memberID := c.Param("member_id")
 
-	hasAccess, role, err := mr.memberRepo.CheckMemberAccess(projectID, clientID)
-	if err != nil || !hasAccess || role != "owner" {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "only project owner can remove members"})
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceMember, presets.ActionDelete); err != nil {
+		return mr.access.respond(c, err)
 	}
 
-	err = mr.memberRepo.RemoveMember(projectID, memberID)
+	err := mr.memberRepo.RemoveMember(projectID, memberID)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
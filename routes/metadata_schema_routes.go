@@ -0,0 +1,228 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/metadata"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// schemaMigrationBatchSize is how many assets a migration loads per query
+	schemaMigrationBatchSize = 500
+	// maxReportedMigrationFailures caps the per-asset failures listed in a migration response
+	maxReportedMigrationFailures = 100
+)
+
+type MetadataSchemaRoutes struct {
+	schemaRepo *repository.MetadataSchemaRepository
+	assetRepo  *repository.AssetRepository
+	access     *projectAccess
+	s3Client   *s3.S3
+}
+
+func NewMetadataSchemaRoutes(schemaRepo *repository.MetadataSchemaRepository, memberRepo *repository.MemberRepository, assetRepo *repository.AssetRepository, checker *rbac.RBACChecker, s3Client *s3.S3) *MetadataSchemaRoutes {
+	return &MetadataSchemaRoutes{
+		schemaRepo: schemaRepo,
+		assetRepo:  assetRepo,
+		access:     newProjectAccess(memberRepo, checker),
+		s3Client:   s3Client,
+	}
+}
+
+// respondMetadataInvalid writes a 422 with field-level errors when err is a metadata validation error
+func respondMetadataInvalid(c echo.Context, err error, schemaVersion int) (bool, error) {
+	var validationErr *metadata.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false, nil
+	}
+
+	return true, c.JSON(http.StatusUnprocessableEntity, map[string]any{
+		"error":          "metadata does not match the project schema",
+		"fields":         validationErr.Fields,
+		"schema_version": schemaVersion,
+	})
+}
+
+// GetSchema returns the current metadata schema of a project
+func (mr *MetadataSchemaRoutes) GetSchema(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionRead); err != nil {
+		return mr.access.respond(c, err)
+	}
+
+	schema, err := mr.schemaRepo.GetCurrentSchema(projectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get metadata schema"})
+	}
+	if schema == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project has no metadata schema"})
+	}
+
+	return c.JSON(http.StatusOK, schema)
+}
+
+// PutSchema stores a new version of the project's metadata schema
+func (mr *MetadataSchemaRoutes) PutSchema(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionManage); err != nil {
+		return mr.access.respond(c, err)
+	}
+
+	var schema metadata.Schema
+	if err := c.Bind(&schema); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if fieldErrs := schema.Check(); len(fieldErrs) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]any{
+			"error":  "invalid metadata schema",
+			"fields": fieldErrs,
+		})
+	}
+
+	created, err := mr.schemaRepo.CreateSchemaVersion(projectID, clientID, schema)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save metadata schema"})
+	}
+
+	return c.JSON(http.StatusCreated, created)
+}
+
+// ListSchemaVersions returns every version of the project's metadata schema
+func (mr *MetadataSchemaRoutes) ListSchemaVersions(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionRead); err != nil {
+		return mr.access.respond(c, err)
+	}
+
+	versions, err := mr.schemaRepo.ListSchemaVersions(projectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list metadata schemas"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"versions": versions,
+	})
+}
+
+// GetSchemaVersion returns one version of the project's metadata schema
+func (mr *MetadataSchemaRoutes) GetSchemaVersion(c echo.Context) error {
+	projectID := c.Param("id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid schema version"})
+	}
+
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionRead); err != nil {
+		return mr.access.respond(c, err)
+	}
+
+	schema, err := mr.schemaRepo.GetSchemaVersion(projectID, version)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "metadata schema version not found"})
+	}
+
+	return c.JSON(http.StatusOK, schema)
+}
+
+// MigrateAssets rewrites the metadata of assets validated against an older schema version
+// and stamps the ones that now conform with the current version. Non-conforming assets are reported, not changed.
+func (mr *MetadataSchemaRoutes) MigrateAssets(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := mr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionManage); err != nil {
+		return mr.access.respond(c, err)
+	}
+
+	var req struct {
+		metadata.Migration
+		DryRun bool `json:"dry_run"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	schema, err := mr.schemaRepo.GetCurrentSchema(projectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get metadata schema"})
+	}
+	if schema == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project has no metadata schema"})
+	}
+
+	type failure struct {
+		AssetID string                `json:"asset_id"`
+		Fields  []metadata.FieldError `json:"fields"`
+	}
+
+	migrated := 0
+	failedCount := 0
+	failures := make([]failure, 0)
+	afterID := ""
+
+	for {
+		assets, err := mr.assetRepo.GetAssetsBehindSchema(projectID, schema.Version, afterID, schemaMigrationBatchSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load assets"})
+		}
+
+		for _, asset := range assets {
+			values := req.Migration.Apply(asset.Metadata)
+
+			var fields []metadata.FieldError
+			var validationErr *metadata.ValidationError
+			err := schema.Schema.Validate(values)
+			if errors.As(err, &validationErr) {
+				fields = validationErr.Fields
+			} else if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]any{"error": "failed to validate asset metadata", "migrated": migrated})
+			} else if _, err := s3UserMetadata(asset.Tags, values); err != nil {
+				fields = []metadata.FieldError{{Field: "*", Message: err.Error()}}
+			}
+			if fields != nil {
+				failedCount++
+				if len(failures) < maxReportedMigrationFailures {
+					failures = append(failures, failure{AssetID: asset.ID, Fields: fields})
+				}
+				continue
+			}
+
+			if !req.DryRun {
+				// The object goes first so a failed run leaves the asset behind the schema to be retried
+				asset.Metadata = values
+				if err := syncObjectMetadata(mr.s3Client, &asset); err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]any{"error": "failed to update object metadata", "migrated": migrated})
+				}
+				if err := mr.assetRepo.ReplaceAssetMetadata(asset.ID, values, schema.Version); err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]any{"error": "failed to migrate asset metadata", "migrated": migrated})
+				}
+			}
+			migrated++
+		}
+
+		if len(assets) < schemaMigrationBatchSize {
+			break
+		}
+		afterID = assets[len(assets)-1].ID
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"schema_version": schema.Version,
+		"dry_run":        req.DryRun,
+		"migrated":       migrated,
+		"failed_count":   failedCount,
+		"failed":         failures,
+	})
+}
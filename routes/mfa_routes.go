@@ -0,0 +1,307 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/auth"
+	"file-service/pkg/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// mfaAttemptLimit is how many second-factor codes one account may try per mfaAttemptWindow,
+	// across logins, recovery code regeneration and disabling
+	mfaAttemptLimit  = 5
+	mfaAttemptWindow = 5 * time.Minute
+)
+
+// errSecondFactorRequired is returned when neither a TOTP code nor a recovery code was given
+var errSecondFactorRequired = errors.New("code or recovery_code required")
+
+type MFARoutes struct {
+	mfaRepo       *repository.MFARepository
+	clientRepo    *repository.ClientRepository
+	projectRepo   *repository.ProjectRepository
+	encryptionKey string
+	appName       string
+	// throttle limits second-factor attempts per account
+	throttle *emailThrottle
+}
+
+func NewMFARoutes(mfaRepo *repository.MFARepository, clientRepo *repository.ClientRepository, projectRepo *repository.ProjectRepository, encryptionKey string, appName string) *MFARoutes {
+	return &MFARoutes{
+		mfaRepo:       mfaRepo,
+		clientRepo:    clientRepo,
+		projectRepo:   projectRepo,
+		encryptionKey: encryptionKey,
+		appName:       appName,
+		throttle:      newEmailThrottle(mfaAttemptLimit, mfaAttemptWindow),
+	}
+}
+
+// allowAttempt counts a second-factor attempt of the client and answers 429 once it has used up its attempts
+func (mr *MFARoutes) allowAttempt(c echo.Context, clientID string) (bool, error) {
+	if retryAfter, ok := mr.throttle.allow(clientID, time.Now()); !ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		return false, c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many two-factor attempts; try again later"})
+	}
+	return true, nil
+}
+
+// enabled reports whether the client has confirmed two-factor enrolment
+func (mr *MFARoutes) enabled(clientID string) (bool, error) {
+	state, err := mr.mfaRepo.GetMFAState(clientID)
+	if err != nil {
+		return false, err
+	}
+	return state.EnabledAt != nil, nil
+}
+
+// checkTOTP validates a code against the client's secret and, once enrolment is confirmed, uses up its time step.
+// When pending is true the code is checked against a secret whose enrolment is not confirmed yet.
+func (mr *MFARoutes) checkTOTP(clientID, code string, pending bool) (int64, bool, error) {
+	state, err := mr.mfaRepo.GetMFAState(clientID)
+	if err != nil {
+		return 0, false, err
+	}
+	if state.Secret == "" || (state.EnabledAt == nil) != pending {
+		return 0, false, nil
+	}
+
+	secret, err := auth.DecryptSecret(mr.encryptionKey, state.Secret)
+	if err != nil {
+		return 0, false, err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok || pending {
+		return step, ok, nil
+	}
+
+	fresh, err := mr.mfaRepo.UseTOTPStep(clientID, step)
+	return step, fresh, err
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, of a client with MFA enabled.
+// Both work once.
+func (mr *MFARoutes) verifySecondFactor(clientID, code, recoveryCode string) (bool, error) {
+	code = strings.TrimSpace(code)
+	recoveryCode = strings.TrimSpace(recoveryCode)
+
+	switch {
+	case code != "":
+		_, ok, err := mr.checkTOTP(clientID, code, false)
+		return ok, err
+	case recoveryCode != "":
+		return mr.mfaRepo.UseRecoveryCode(clientID, recoveryCode)
+	default:
+		return false, errSecondFactorRequired
+	}
+}
+
+// GetMFAStatus reports whether two-factor authentication is enabled and how many recovery codes are left
+func (mr *MFARoutes) GetMFAStatus(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	state, err := mr.mfaRepo.GetMFAState(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get two-factor status"})
+	}
+
+	remaining := 0
+	if state.EnabledAt != nil {
+		remaining, err = mr.mfaRepo.CountRecoveryCodes(clientID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get two-factor status"})
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"enabled":                  state.EnabledAt != nil,
+		"enabled_at":               state.EnabledAt,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollMFA starts enrolment with a new TOTP secret; it takes effect once VerifyMFA confirms a code
+func (mr *MFARoutes) EnrollMFA(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	email, _ := c.Get("email").(string)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate secret"})
+	}
+
+	encrypted, err := auth.EncryptSecret(mr.encryptionKey, secret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate secret"})
+	}
+
+	err = mr.mfaRepo.SetPendingSecret(clientID, encrypted)
+	if errors.Is(err, repository.ErrMFAAlreadyEnabled) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start enrolment"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(mr.appName, email, secret),
+	})
+}
+
+// VerifyMFA confirms enrolment with a code from the authenticator app and returns the recovery codes
+func (mr *MFARoutes) VerifyMFA(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if strings.TrimSpace(req.Code) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code required"})
+	}
+
+	step, ok, err := mr.checkTOTP(clientID, req.Code, true)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify code"})
+	}
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid code or enrolment not started"})
+	}
+
+	codes, err := mr.mfaRepo.EnableMFA(clientID, step)
+	if errors.Is(err, repository.ErrMFANotEnrolled) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to enable two-factor authentication"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current TOTP code
+func (mr *MFARoutes) RegenerateRecoveryCodes(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if strings.TrimSpace(req.Code) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code required"})
+	}
+
+	enabled, err := mr.enabled(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get two-factor status"})
+	}
+	if !enabled {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "two-factor authentication is not enabled"})
+	}
+
+	if ok, err := mr.allowAttempt(c, clientID); !ok {
+		return err
+	}
+
+	ok, err := mr.verifySecondFactor(clientID, req.Code, "")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify code"})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid code"})
+	}
+
+	codes, err := mr.mfaRepo.ReplaceRecoveryCodes(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate recovery codes"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns two-factor authentication off after checking the password and a second factor.
+// Owners of projects that require it must lift the requirement first.
+func (mr *MFARoutes) DisableMFA(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.Password == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "password required"})
+	}
+
+	enabled, err := mr.enabled(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get two-factor status"})
+	}
+	if !enabled {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "two-factor authentication is not enabled"})
+	}
+
+	owns, err := mr.projectRepo.OwnsMFARequiredProject(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to disable two-factor authentication"})
+	}
+	if owns {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "you own projects that require two-factor authentication"})
+	}
+
+	// Counted before the password, so a stolen token cannot be used to guess either
+	if ok, err := mr.allowAttempt(c, clientID); !ok {
+		return err
+	}
+
+	client, err := mr.clientRepo.GetClientByID(clientID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "client not found"})
+	}
+	if !auth.VerifyPassword(req.Password, client.PasswordHash) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+	}
+
+	ok, err := mr.verifySecondFactor(clientID, req.Code, req.RecoveryCode)
+	if errors.Is(err, errSecondFactorRequired) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify code"})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid code"})
+	}
+
+	if err := mr.mfaRepo.DisableMFA(clientID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to disable two-factor authentication"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "two-factor authentication disabled"})
+}
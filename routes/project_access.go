@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/middleware"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// errNotMember is returned when the caller has no role in the project
+	errNotMember = errors.New("project not found or access denied")
+	// errKeyProjectMismatch is returned when an API key is used against a project other than the one it is bound to
+	errKeyProjectMismatch = errors.New("API key is bound to another project")
+	// errKeyFolderDenied is returned when an API key is used outside the folders it is scoped to
+	errKeyFolderDenied = errors.New("API key is not allowed in this folder")
+)
+
+// keyProjectID returns the project the request's API key is bound to, or "" for JWT requests and unbound keys
+func keyProjectID(c echo.Context) string {
+	if projectID, ok := c.Get("project_id").(*string); ok && projectID != nil {
+		return *projectID
+	}
+	return ""
+}
+
+// keyAllowsProject reports whether the request's API key, if any, may act on the project
+func keyAllowsProject(c echo.Context, projectID string) bool {
+	bound := keyProjectID(c)
+	return bound == "" || bound == projectID
+}
+
+// keyFolderScopes returns the folder prefixes the request's API key is restricted to, or nil when it is not
+func keyFolderScopes(c echo.Context) []string {
+	folders, _ := c.Get(middleware.ContextKeyAPIKeyFolders).([]string)
+	if len(folders) == 0 {
+		return nil
+	}
+	return folders
+}
+
+// keyAllowsFolder reports whether the request's API key, if any, may act on assets in the folder
+func keyAllowsFolder(c echo.Context, folderPath string) bool {
+	scopes := keyFolderScopes(c)
+	if scopes == nil {
+		return true
+	}
+	for _, prefix := range scopes {
+		if strings.HasPrefix(folderPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestProjectID defaults a requested project to the API key's bound project and refuses any other
+func requestProjectID(c echo.Context, requested string) (string, error) {
+	bound := keyProjectID(c)
+	if requested == "" {
+		return bound, nil
+	}
+	if bound != "" && requested != bound {
+		return "", errKeyProjectMismatch
+	}
+	return requested, nil
+}
+
+// presetRoles maps project member roles onto the roles of the file management preset
+var presetRoles = map[string]rbac.Role{
+	"owner":  presets.RoleAdmin,
+	"editor": presets.RoleEditor,
+	"viewer": presets.RoleViewer,
+}
+
+// projectAccess resolves the caller's role from project_members and checks it against the RBAC capabilities
+type projectAccess struct {
+	memberRepo *repository.MemberRepository
+	checker    *rbac.RBACChecker
+}
+
+func newProjectAccess(memberRepo *repository.MemberRepository, checker *rbac.RBACChecker) *projectAccess {
+	return &projectAccess{memberRepo: memberRepo, checker: checker}
+}
+
+// allows returns nil when a member role may perform the action on the resource
+func (pa *projectAccess) allows(role string, resource rbac.Resource, action rbac.Action) error {
+	return pa.checker.Authorize(&rbac.AuthSubject{Type: rbac.AuthTypeJWT, UserRole: presetRoles[role]}, resource, action)
+}
+
+// authorize returns the caller's project role when it may perform the action on the resource.
+// The error is errNotMember for non-members and wraps rbac.ErrDenied when the role falls short.
+func (pa *projectAccess) authorize(c echo.Context, projectID string, resource rbac.Resource, action rbac.Action) (string, error) {
+	clientID := c.Get("client_id").(string)
+
+	if !keyAllowsProject(c, projectID) {
+		return "", errKeyProjectMismatch
+	}
+
+	isMember, role, err := pa.memberRepo.CheckMemberAccess(projectID, clientID)
+	if err != nil {
+		return "", err
+	}
+	if !isMember {
+		return "", errNotMember
+	}
+
+	if err := pa.allows(role, resource, action); err != nil {
+		return role, err
+	}
+
+	return role, nil
+}
+
+// respond writes the error response for a failed authorize
+func (pa *projectAccess) respond(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, errNotMember), errors.Is(err, errKeyProjectMismatch):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrMFARequired):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, rbac.ErrDenied):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check project access"})
+	}
+}
@@ -1,18 +1,33 @@
 package routes
 
 import (
+	"errors"
+	"file-service/pkg/models"
 	"file-service/pkg/repository"
+	"file-service/pkg/s3"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
+// slugPattern allows 3 to 63 lowercase letters, digits and inner hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
 type ProjectRoutes struct {
 	projectRepo *repository.ProjectRepository
+	memberRepo  *repository.MemberRepository
+	mfaRepo     *repository.MFARepository
 }
 
-func NewProjectRoutes(projectRepo *repository.ProjectRepository) *ProjectRoutes {
-	return &ProjectRoutes{projectRepo: projectRepo}
+func NewProjectRoutes(projectRepo *repository.ProjectRepository, memberRepo *repository.MemberRepository, mfaRepo *repository.MFARepository) *ProjectRoutes {
+	return &ProjectRoutes{
+		projectRepo: projectRepo,
+		memberRepo:  memberRepo,
+		mfaRepo:     mfaRepo,
+	}
 }
 
 // CreateProject creates a new project
@@ -44,20 +59,155 @@ func (pr *ProjectRoutes) CreateProject(c echo.Context) error {
 func (pr *ProjectRoutes) GetProjects(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
 
-	projects, err := pr.projectRepo.GetProjectsByClientID(clientID)
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	projects, info, err := pr.projectRepo.GetProjectsByClientID(clientID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get projects"})
 	}
 
-	return c.JSON(http.StatusOK, projects)
+	return c.JSON(http.StatusOK, pageResponse("projects", projects, page, info))
+}
+
+// GetSharedProjects retrieves the projects other clients invited the authenticated client to
+func (pr *ProjectRoutes) GetSharedProjects(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	projects, info, err := pr.projectRepo.GetSharedProjects(clientID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get shared projects"})
+	}
+
+	return c.JSON(http.StatusOK, pageResponse("projects", projects, page, info))
 }
 
-// GetProject retrieves a specific project
+// GetProject retrieves a specific project the client is a member of
 func (pr *ProjectRoutes) GetProject(c echo.Context) error {
 	clientID := c.Get("client_id").(string)
 	projectID := c.Param("id")
 
-	project, err := pr.projectRepo.GetProjectByID(projectID, clientID)
+	isMember, _, err := pr.memberRepo.CheckMemberAccess(projectID, clientID)
+	if err != nil || !isMember {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project not found"})
+	}
+
+	project, err := pr.projectRepo.FindProjectByID(projectID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project not found"})
+	}
+
+	return c.JSON(http.StatusOK, project)
+}
+
+// UpdateProjectSettings updates presigned URL lifetimes and the upload size cap of a project
+func (pr *ProjectRoutes) UpdateProjectSettings(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+
+	var req models.ProjectURLSettings
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.DownloadURLTTLSeconds == nil && req.UploadURLTTLSeconds == nil && req.MaxUploadSizeBytes == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nothing to update"})
+	}
+
+	maxTTL := int(s3.MaxPresignExpiry.Seconds())
+	for _, ttl := range []*int{req.DownloadURLTTLSeconds, req.UploadURLTTLSeconds} {
+		if ttl != nil && (*ttl < 0 || *ttl > maxTTL) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("url lifetimes must be between 0 and %d seconds", maxTTL)})
+		}
+	}
+
+	if req.MaxUploadSizeBytes != nil && (*req.MaxUploadSizeBytes < 0 || *req.MaxUploadSizeBytes > s3.MaxSingleUploadSize) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("max_upload_size_bytes must be between 0 and %d", s3.MaxSingleUploadSize)})
+	}
+
+	project, err := pr.projectRepo.UpdateProjectURLSettings(projectID, clientID, req)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project not found"})
+	}
+
+	return c.JSON(http.StatusOK, project)
+}
+
+// UpdateProjectAliases changes the project slug used in alias paths and whether aliases are public
+func (pr *ProjectRoutes) UpdateProjectAliases(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+
+	var req models.ProjectAliasSettings
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.Slug == nil && req.PublicAliases == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nothing to update"})
+	}
+
+	if req.Slug != nil {
+		slug := strings.ToLower(strings.TrimSpace(*req.Slug))
+		if !slugPattern.MatchString(slug) || strings.Contains(slug, "--") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "slug must be 3-63 lowercase letters, digits or single hyphens"})
+		}
+		req.Slug = &slug
+	}
+
+	project, err := pr.projectRepo.UpdateProjectAliasSettings(projectID, clientID, req)
+	if errors.Is(err, repository.ErrSlugTaken) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project not found"})
+	}
+
+	return c.JSON(http.StatusOK, project)
+}
+
+// UpdateProjectSecurity sets whether members need two-factor authentication to access the project.
+// Owners must have it enabled themselves before requiring it.
+func (pr *ProjectRoutes) UpdateProjectSecurity(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	projectID := c.Param("id")
+
+	var req struct {
+		RequireMFA *bool `json:"require_mfa"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.RequireMFA == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "require_mfa required"})
+	}
+
+	if *req.RequireMFA {
+		state, err := pr.mfaRepo.GetMFAState(clientID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get two-factor status"})
+		}
+		if state.EnabledAt == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "enable two-factor authentication on your account first"})
+		}
+	}
+
+	project, err := pr.projectRepo.SetProjectRequireMFA(projectID, clientID, *req.RequireMFA)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "project not found"})
 	}
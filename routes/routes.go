@@ -2,63 +2,84 @@ package routes
 
 import (
 	"errors"
+	"file-service/pkg/apiclient"
 	"file-service/pkg/cache"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/echoadapter"
+	"file-service/pkg/rbac/presets"
 	"file-service/pkg/s3"
 	"fmt"
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
-// RegisterRoutes registers all the routes for the application
-func RegisterRoutes(e *echo.Echo, s3Client *s3.S3, urlCache *cache.URLCache) {
+// RegisterRoutes registers the admin bucket-browser API and the health check.
+// Storage routes operate on the raw bucket, so they are restricted to operators
+// and every call is recorded in the audit trail.
+func RegisterRoutes(
+	e *echo.Echo,
+	s3Client *s3.S3,
+	urlCache *cache.URLCache,
+	adminRoutes *AdminRoutes,
+	jwtMiddleware echo.MiddlewareFunc,
+	operatorMiddleware echo.MiddlewareFunc,
+	storageAuditMiddleware echo.MiddlewareFunc,
+) {
+	storage := e.Group("/admin/storage", jwtMiddleware, operatorMiddleware, storageAuditMiddleware)
+
 	// Define route for uploading images
-	e.POST("/upload", func(c echo.Context) error {
+	storage.POST("/upload", func(c echo.Context) error {
 		return uploadFileHandler(c, s3Client)
 	})
 
 	// Define route for serving files
-	e.GET("/download", func(c echo.Context) error {
+	storage.GET("/download", func(c echo.Context) error {
 		return downloadFileHandler(c, s3Client, urlCache)
 	})
 
 	// Delete File
-	e.DELETE("/delete", func(c echo.Context) error {
+	storage.DELETE("/delete", func(c echo.Context) error {
 		return deleteFileHandler(c, s3Client)
 	})
 
 	// Delete File
-	e.DELETE("/delete-folder", func(c echo.Context) error {
+	storage.DELETE("/delete-folder", func(c echo.Context) error {
 		return deleteFolderHandler(c, s3Client)
 	})
 
 	// List files within current folder
-	e.GET("/list", func(c echo.Context) error {
+	storage.GET("/list", func(c echo.Context) error {
 		return listFilesHandler(c, s3Client, urlCache)
 	})
 
 	// list all folders within current folder
-	e.GET("/list-folders", func(c echo.Context) error {
+	storage.GET("/list-folders", func(c echo.Context) error {
 		return listAllFoldersHandler(c, s3Client)
 	})
 
-	e.POST("/create-folder", func(c echo.Context) error {
+	storage.POST("/create-folder", func(c echo.Context) error {
 		return createFolderHandler(c, s3Client)
 	})
 
 	// Batch upload multiple files
-	e.POST("/batch-upload", func(c echo.Context) error {
+	storage.POST("/batch-upload", func(c echo.Context) error {
 		return batchUploadFileHandler(c, s3Client)
 	})
 
 	// Batch download - get multiple download URLs
-	e.POST("/batch-download", func(c echo.Context) error {
+	storage.POST("/batch-download", func(c echo.Context) error {
 		return batchDownloadHandler(c, s3Client, urlCache)
 	})
 
+	// Audit trail of admin calls
+	admin := e.Group("/admin", jwtMiddleware, operatorMiddleware)
+	admin.GET("/audit", adminRoutes.ListAuditLog)
+
 	// Define route for testing the server
 	e.GET("/ping", ping)
 }
@@ -78,6 +99,10 @@ func createFolderHandler(c echo.Context, client *s3.S3) error {
 		folderName = folderName + "/"
 	}
 
+	if err := guardStoragePaths(c, folderName); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
+
 	// Call the CreateFolder function to create the folder
 	err := client.CreateFolder(folderName)
 	if err != nil {
@@ -101,6 +126,10 @@ func uploadFileHandler(c echo.Context, client *s3.S3) error {
 		return c.JSON(http.StatusInternalServerError, response)
 	}
 
+	if err := guardStoragePaths(c, s3.BuildObjectKey(folderPath, file.Filename)); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
+
 	// Open the file
 	src, err := file.Open()
 	if err != nil {
@@ -153,6 +182,14 @@ func listFilesHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCache) e
 	}
 
 	folderPath := c.QueryParam("path")
+	if err := guardStoragePaths(c, folderPath); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
+
+	listing, err := parseListingQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, s3.GetFailureResponse(err))
+	}
 
 	// Next page token for pagination
 	nextPageToken := c.Request().Header.Get("x-next")
@@ -171,6 +208,15 @@ func listFilesHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCache) e
 		return c.JSON(http.StatusInternalServerError, response)
 	}
 
+	// Filters and sorting apply to the current page only
+	if objects.Files != nil {
+		visible := hideTenantObjects(c, *objects.Files)
+		objects.Files = &visible
+		objects.Files = s3.FilterFiles(*objects.Files, listing.FilterOptions())
+		objects.Files = s3.SortFiles(*objects.Files, listing.Sort, listing.Order)
+		objects.NoOfRecordsReturned = int32(len(*objects.Files))
+	}
+
 	response := s3.GetListFolderSuccessResponse(objects)
 	return c.JSON(http.StatusOK, response)
 }
@@ -191,9 +237,12 @@ func listAllFilesHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCache
 
 func listAllFoldersHandler(c echo.Context, client *s3.S3) error {
 	folderPath := c.QueryParam("path")
+	if err := guardStoragePaths(c, folderPath); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
 
 	// List all the files and folders within the nested folder
-	objects := client.ListAllFolders(folderPath)
+	objects := hideTenantObjects(c, client.ListAllFolders(folderPath))
 
 	return c.JSON(http.StatusOK, objects)
 }
@@ -201,6 +250,9 @@ func listAllFoldersHandler(c echo.Context, client *s3.S3) error {
 // Handler for downloading a file
 func downloadFileHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCache) error {
 	key := c.QueryParam("path")
+	if err := guardStoragePaths(c, key); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
 
 	url, err := client.GenerateDownloadLink(key, urlCache)
 
@@ -228,6 +280,12 @@ func downloadFileHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCache
 
 func deleteFileHandler(c echo.Context, client *s3.S3) error {
 	path := c.QueryParam("path")
+	if path == "" {
+		return c.JSON(http.StatusBadRequest, s3.GetFailureResponse(errors.New("path is required")))
+	}
+	if err := guardStoragePaths(c, path); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
 
 	// Delete the file or folder from the S3 bucket
 	err := client.DeleteObject(path)
@@ -243,6 +301,13 @@ func deleteFileHandler(c echo.Context, client *s3.S3) error {
 
 func deleteFolderHandler(c echo.Context, client *s3.S3) error {
 	folderPath := c.QueryParam("path")
+	if strings.Trim(folderPath, "/") == "" {
+		// Deleting the bucket root would wipe every tenant.
+		return c.JSON(http.StatusBadRequest, s3.GetFailureResponse(errors.New("path is required and cannot be the bucket root")))
+	}
+	if err := guardStoragePaths(c, folderPath); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
 
 	// Delete the file or folder from the S3 bucket
 	err := client.DeleteFolder(folderPath)
@@ -286,6 +351,14 @@ func batchUploadFileHandler(c echo.Context, client *s3.S3) error {
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
+	objectKeys := make([]string, 0, len(files))
+	for _, file := range files {
+		objectKeys = append(objectKeys, s3.BuildObjectKey(folderPath, file.Filename))
+	}
+	if err := guardStoragePaths(c, objectKeys...); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
+
 	var uploadInputs []s3.FileUploadInput
 	var openedFiles []multipart.File
 
@@ -341,6 +414,10 @@ func batchDownloadHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCach
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
+	if err := guardStoragePaths(c, req.Paths...); err != nil {
+		return c.JSON(http.StatusForbidden, s3.GetFailureResponse(err))
+	}
+
 	ctx := c.Request().Context()
 	result := client.BatchGenerateDownloadLinks(ctx, req.Paths, urlCache, s3.DefaultMaxWorkers)
 
@@ -348,6 +425,24 @@ func batchDownloadHandler(c echo.Context, client *s3.S3, urlCache *cache.URLCach
 	return c.JSON(http.StatusOK, response)
 }
 
+// optionalAuth authenticates requests that carry a bearer token, API key or key signature and lets anonymous ones through
+func optionalAuth(jwtMiddleware, apiKeyMiddleware echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withJWT := jwtMiddleware(next)
+		withAPIKey := apiKeyMiddleware(next)
+		return func(c echo.Context) error {
+			switch {
+			case c.Request().Header.Get("Authorization") != "":
+				return withJWT(c)
+			case c.Request().Header.Get("X-API-Key") != "", c.Request().Header.Get(apiclient.HeaderSignature) != "":
+				return withAPIKey(c)
+			default:
+				return next(c)
+			}
+		}
+	}
+}
+
 // RegisterMultiTenantRoutes registers all multi-tenant routes
 func RegisterMultiTenantRoutes(
 	e *echo.Echo,
@@ -357,19 +452,45 @@ func RegisterMultiTenantRoutes(
 	apiKeyRoutes *APIKeyRoutes,
 	assetRoutes *AssetRoutes,
 	memberRoutes *MemberRoutes,
+	searchRoutes *SearchRoutes,
+	schemaRoutes *MetadataSchemaRoutes,
+	collectionRoutes *CollectionRoutes,
+	commentRoutes *CommentRoutes,
+	workflowRoutes *WorkflowRoutes,
+	aliasRoutes *AliasRoutes,
+	folderACLRoutes *FolderACLRoutes,
+	emailVerificationRoutes *EmailVerificationRoutes,
+	mfaRoutes *MFARoutes,
+	ssoRoutes *SSORoutes,
+	rbacChecker *rbac.RBACChecker,
 	jwtMiddleware echo.MiddlewareFunc,
 	apiKeyMiddleware echo.MiddlewareFunc,
+	uploadMiddleware echo.MiddlewareFunc,
 ) {
 	// Public auth routes
 	auth := e.Group("/auth")
 	auth.POST("/register", authRoutes.Register)
 	auth.POST("/clients", authRoutes.CreateClient)
 	auth.POST("/login", authRoutes.Login)
+	auth.POST("/mfa", authRoutes.VerifyMFALogin)
+	auth.POST("/unlock", authRoutes.UnlockAccount)
+	auth.POST("/sso/discover", ssoRoutes.DiscoverSSO)
+	auth.GET("/sso/:slug/authorize", ssoRoutes.StartSSOLogin)
+	auth.POST("/sso/callback", ssoRoutes.CompleteSSOLogin)
 	auth.POST("/refresh", authRoutes.RefreshToken)
+	auth.POST("/logout", authRoutes.Logout)
+	auth.POST("/logout-all", authRoutes.LogoutAll, jwtMiddleware)
 	auth.POST("/forgot-password", authRoutes.ForgotPassword)
 	auth.POST("/reset-password", authRoutes.ResetPassword)
+	auth.POST("/verify-email", emailVerificationRoutes.VerifyEmail)
+	auth.POST("/resend-verification", emailVerificationRoutes.ResendVerification, jwtMiddleware)
 	e.POST("/clients", authRoutes.CreateClient)
 
+	// Alias paths (public projects, or members with a bearer token or API key)
+	aliases := e.Group("/p", optionalAuth(jwtMiddleware, apiKeyMiddleware))
+	aliases.GET("/:project_slug/*", aliasRoutes.ResolveAlias)
+	aliases.HEAD("/:project_slug/*", aliasRoutes.ResolveAlias)
+
 	// Protected client routes (JWT auth)
 	api := e.Group("/api", jwtMiddleware)
 
@@ -380,10 +501,64 @@ func RegisterMultiTenantRoutes(
 	api.PATCH("/clients/me", clientRoutes.UpdateMyClient)
 	api.DELETE("/clients/me", clientRoutes.DeleteMyAccount)
 
+	// Sessions
+	api.GET("/sessions", authRoutes.ListSessions)
+	api.DELETE("/sessions/:id", authRoutes.RevokeSession)
+
+	// Two-factor authentication
+	api.GET("/mfa", mfaRoutes.GetMFAStatus)
+	api.POST("/mfa/enroll", mfaRoutes.EnrollMFA)
+	api.POST("/mfa/verify", mfaRoutes.VerifyMFA)
+	api.POST("/mfa/recovery-codes", mfaRoutes.RegenerateRecoveryCodes)
+	api.POST("/mfa/disable", mfaRoutes.DisableMFA)
+
+	// SSO connections
+	api.POST("/sso/connections", ssoRoutes.CreateConnection)
+	api.GET("/sso/connections", ssoRoutes.ListConnections)
+	api.GET("/sso/connections/:id", ssoRoutes.GetConnection)
+	api.PATCH("/sso/connections/:id", ssoRoutes.UpdateConnection)
+	api.DELETE("/sso/connections/:id", ssoRoutes.DeleteConnection)
+	api.PUT("/sso/connections/:id/group-mappings", ssoRoutes.SetGroupMappings)
+	api.POST("/sso/connections/:id/domains/:domain/verify", ssoRoutes.VerifyDomain)
+	api.POST("/sso/:slug/link", ssoRoutes.StartSSOLink)
+
 	// Projects
 	api.POST("/projects", projectRoutes.CreateProject)
 	api.GET("/projects", projectRoutes.GetProjects)
+	api.GET("/projects/shared", projectRoutes.GetSharedProjects)
 	api.GET("/projects/:id", projectRoutes.GetProject)
+	api.PATCH("/projects/:id/settings", projectRoutes.UpdateProjectSettings)
+	api.PATCH("/projects/:id/aliases", projectRoutes.UpdateProjectAliases)
+	api.PATCH("/projects/:id/security", projectRoutes.UpdateProjectSecurity)
+
+	// Project metadata schemas
+	api.GET("/projects/:id/metadata-schema", schemaRoutes.GetSchema)
+	api.PUT("/projects/:id/metadata-schema", schemaRoutes.PutSchema)
+	api.GET("/projects/:id/metadata-schema/versions", schemaRoutes.ListSchemaVersions)
+	api.GET("/projects/:id/metadata-schema/versions/:version", schemaRoutes.GetSchemaVersion)
+	api.POST("/projects/:id/metadata-schema/migrate", schemaRoutes.MigrateAssets)
+
+	// Publishing workflow
+	api.GET("/projects/:id/workflow", workflowRoutes.GetWorkflow)
+	api.PUT("/projects/:id/workflow", workflowRoutes.PutWorkflow)
+	api.DELETE("/projects/:id/workflow", workflowRoutes.ResetWorkflow)
+
+	// Folder access control
+	api.GET("/projects/:id/folder-acls", folderACLRoutes.ListFolderACLs)
+	api.PUT("/projects/:id/folder-acls", folderACLRoutes.SetFolderACL)
+	api.DELETE("/projects/:id/folder-acls/:acl_id", folderACLRoutes.DeleteFolderACL)
+	api.GET("/projects/:id/folder-access", folderACLRoutes.GetFolderAccess)
+
+	// Collections
+	api.POST("/projects/:id/collections", collectionRoutes.CreateCollection)
+	api.GET("/projects/:id/collections", collectionRoutes.GetCollections)
+	api.GET("/collections/:id", collectionRoutes.GetCollection)
+	api.PATCH("/collections/:id", collectionRoutes.UpdateCollection)
+	api.DELETE("/collections/:id", collectionRoutes.DeleteCollection)
+	api.GET("/collections/:id/assets", collectionRoutes.GetCollectionAssets)
+	api.POST("/collections/:id/assets", collectionRoutes.AddCollectionAssets)
+	api.PUT("/collections/:id/assets/order", collectionRoutes.ReorderCollectionAssets)
+	api.DELETE("/collections/:id/assets/:asset_id", collectionRoutes.RemoveCollectionAsset)
 
 	// Project Members
 	api.POST("/projects/:project_id/members", memberRoutes.InviteMember)
@@ -394,24 +569,56 @@ func RegisterMultiTenantRoutes(
 	api.POST("/api-keys", apiKeyRoutes.CreateAPIKey)
 	api.GET("/api-keys", apiKeyRoutes.GetAPIKeys)
 	api.DELETE("/api-keys/:id", apiKeyRoutes.RevokeAPIKey)
+	api.POST("/api-keys/:id/rotate", apiKeyRoutes.RotateAPIKey)
+	api.GET("/api-keys/:id/usage", apiKeyRoutes.GetAPIKeyUsage)
+	api.POST("/api-keys/:id/signing", apiKeyRoutes.EnableSigning)
+	api.DELETE("/api-keys/:id/signing", apiKeyRoutes.DisableSigning)
 
 	// Assets (JWT auth)
-	api.GET("/upload-url", assetRoutes.GetUploadURL)
-	api.POST("/assets/confirm", assetRoutes.ConfirmUpload)
-	api.POST("/assets", assetRoutes.UploadAsset)
+	api.GET("/upload-url", assetRoutes.GetUploadURL, uploadMiddleware)
+	api.POST("/assets/confirm", assetRoutes.ConfirmUpload, uploadMiddleware)
+	api.POST("/assets", assetRoutes.UploadAsset, uploadMiddleware)
 	api.GET("/assets", assetRoutes.GetAssets)
 	api.GET("/assets/:id", assetRoutes.GetAsset)
 	api.GET("/assets/:id/versions", assetRoutes.GetAssetVersions)
+	api.PATCH("/assets/:id/tags", assetRoutes.UpdateAssetTags)
+	api.PATCH("/assets/:id/metadata", assetRoutes.UpdateAssetMetadata)
+	api.POST("/assets/:id/transitions", workflowRoutes.TransitionAsset)
+	api.GET("/assets/:id/state-history", workflowRoutes.GetStateHistory)
+	api.PUT("/assets/:id/pin", aliasRoutes.PinVersion)
+	api.DELETE("/assets/:id/pin", aliasRoutes.UnpinVersion)
 	api.DELETE("/assets/:id", assetRoutes.DeleteAsset)
 	api.GET("/folders", assetRoutes.GetFolders)
 
+	// Comments
+	api.GET("/assets/:id/comments", commentRoutes.GetComments)
+	api.POST("/assets/:id/comments", commentRoutes.CreateComment)
+	api.PATCH("/comments/:id", commentRoutes.UpdateComment)
+	api.DELETE("/comments/:id", commentRoutes.DeleteComment)
+
+	// Search
+	api.GET("/search", searchRoutes.SearchAssets)
+
 	// API Key routes (for developers using API keys)
+	// Handlers act on the key's bound project; each route needs the key permission it maps to
 	apiKeyGroup := e.Group("/v1", apiKeyMiddleware)
-	apiKeyGroup.GET("/upload-url", assetRoutes.GetUploadURL)
-	apiKeyGroup.POST("/assets/confirm", assetRoutes.ConfirmUpload)
-	apiKeyGroup.POST("/upload", assetRoutes.UploadAsset)
-	apiKeyGroup.GET("/assets", assetRoutes.GetAssets)
-	apiKeyGroup.GET("/assets/:id", assetRoutes.GetAsset)
-	apiKeyGroup.GET("/assets/:id/versions", assetRoutes.GetAssetVersions)
-	apiKeyGroup.GET("/folders", assetRoutes.GetFolders)
+	readFiles := echoadapter.RequirePermission(rbacChecker, presets.ResourceFile, presets.PermissionRead)
+	writeFiles := echoadapter.RequirePermission(rbacChecker, presets.ResourceFile, presets.PermissionWrite)
+	deleteFiles := echoadapter.RequirePermission(rbacChecker, presets.ResourceFile, presets.PermissionDelete)
+	readFolders := echoadapter.RequirePermission(rbacChecker, presets.ResourceFolder, presets.PermissionRead)
+	apiKeyGroup.GET("/upload-url", assetRoutes.GetUploadURL, writeFiles, uploadMiddleware)
+	apiKeyGroup.POST("/assets/confirm", assetRoutes.ConfirmUpload, writeFiles, uploadMiddleware)
+	apiKeyGroup.POST("/upload", assetRoutes.UploadAsset, writeFiles, uploadMiddleware)
+	apiKeyGroup.GET("/assets", assetRoutes.GetAssets, readFiles)
+	apiKeyGroup.GET("/assets/:id", assetRoutes.GetAsset, readFiles)
+	apiKeyGroup.GET("/assets/:id/versions", assetRoutes.GetAssetVersions, readFiles)
+	apiKeyGroup.PATCH("/assets/:id/tags", assetRoutes.UpdateAssetTags, writeFiles)
+	apiKeyGroup.PATCH("/assets/:id/metadata", assetRoutes.UpdateAssetMetadata, writeFiles)
+	apiKeyGroup.DELETE("/assets/:id", assetRoutes.DeleteAsset, deleteFiles)
+	apiKeyGroup.POST("/assets/:id/transitions", workflowRoutes.TransitionAsset, writeFiles)
+	apiKeyGroup.GET("/assets/:id/state-history", workflowRoutes.GetStateHistory, readFiles)
+	apiKeyGroup.GET("/folders", assetRoutes.GetFolders, readFolders)
+	apiKeyGroup.GET("/assets/:id/comments", commentRoutes.GetComments, readFiles)
+	apiKeyGroup.POST("/assets/:id/comments", commentRoutes.CreateComment, writeFiles)
+	apiKeyGroup.GET("/search", searchRoutes.SearchAssets, readFiles)
 }
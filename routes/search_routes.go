@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SearchRoutes struct {
+	assetRepo *repository.AssetRepository
+	access    *projectAccess
+}
+
+func NewSearchRoutes(assetRepo *repository.AssetRepository, memberRepo *repository.MemberRepository, checker *rbac.RBACChecker) *SearchRoutes {
+	return &SearchRoutes{
+		assetRepo: assetRepo,
+		access:    newProjectAccess(memberRepo, checker),
+	}
+}
+
+// SearchAssets ranks assets across every project the caller can access
+func (sr *SearchRoutes) SearchAssets(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	folder := strings.TrimSpace(c.QueryParam("folder"))
+
+	// An API key only searches the project it is bound to
+	projectID, err := requestProjectID(c, strings.TrimSpace(c.QueryParam("project_id")))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	listing, err := parseListingQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	filter := listing.AssetFilter(nil)
+	filter.Query = ""
+	hasFilter := len(filter.MimeTypes) > 0 || len(filter.Extensions) > 0 ||
+		filter.SizeGT != nil || filter.SizeLT != nil ||
+		filter.CreatedAfter != nil || filter.CreatedBefore != nil || folder != "" ||
+		len(filter.Tags) > 0 || len(filter.Metadata) > 0 || len(filter.States) > 0
+
+	if listing.Query == "" && !hasFilter {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "q or at least one filter required"})
+	}
+
+	if projectID != "" {
+		if _, err := sr.access.authorize(c, projectID, presets.ResourceFile, presets.ActionRead); err != nil {
+			return sr.access.respond(c, err)
+		}
+	}
+
+	limit := parseIntQueryParam(c.QueryParam("limit"), repository.DefaultPageLimit)
+	offset := parseIntQueryParam(c.QueryParam("offset"), 0)
+	if limit <= 0 {
+		limit = repository.DefaultPageLimit
+	}
+	if limit > repository.MaxPageLimit {
+		limit = repository.MaxPageLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var folderPrefix string
+	if folder != "" {
+		folderPrefix = normalizeFolderPath(folder)
+	}
+
+	filter.ReaderID = clientID
+	filter.FolderScopes = keyFolderScopes(c)
+
+	results, hasMore, err := sr.assetRepo.SearchAssets(clientID, repository.AssetSearch{
+		Query:        listing.Query,
+		ProjectID:    projectID,
+		FolderPrefix: folderPrefix,
+		Filter:       filter,
+		Limit:        limit,
+		Offset:       offset,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to search assets"})
+	}
+
+	terms := searchTerms(listing.Query)
+	for i := range results {
+		fields := map[string]string{
+			"original_filename": results[i].OriginalFilename,
+			"folder_path":       results[i].FolderPath,
+		}
+		for key, value := range results[i].Metadata {
+			fields["metadata."+key] = value
+		}
+		results[i].Highlights = highlightFields(terms, fields)
+		if tags := highlightTags(terms, results[i].Tags); tags != "" {
+			if results[i].Highlights == nil {
+				results[i].Highlights = make(map[string]string)
+			}
+			results[i].Highlights["tags"] = tags
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"results":  results,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	})
+}
+
+// searchTerms splits a query into the lowercase words used for highlighting
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// highlightFields returns the fields containing a term, HTML-escaped with matches wrapped in <mark>
+func highlightFields(terms []string, fields map[string]string) map[string]string {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	highlights := make(map[string]string)
+	for name, value := range fields {
+		if marked, ok := highlightTerms(value, terms); ok {
+			highlights[name] = marked
+		}
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
+
+// highlightTags returns the tags containing a term, marked like highlightFields and joined with ", "
+func highlightTags(terms []string, tags []string) string {
+	marked := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if highlighted, ok := highlightTerms(tag, terms); ok {
+			marked = append(marked, highlighted)
+		}
+	}
+	return strings.Join(marked, ", ")
+}
+
+func highlightTerms(value string, terms []string) (string, bool) {
+	lower := strings.ToLower(value)
+	if len(lower) != len(value) {
+		// case folding changed byte offsets, match on the original text only
+		lower = value
+	}
+
+	matched := make([]bool, len(value))
+	found := false
+	for _, term := range terms {
+		for start := 0; ; {
+			idx := strings.Index(lower[start:], term)
+			if idx < 0 {
+				break
+			}
+			for i := start + idx; i < start+idx+len(term); i++ {
+				matched[i] = true
+			}
+			found = true
+			start += idx + len(term)
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		j := i
+		for j < len(value) && matched[j] == matched[i] {
+			j++
+		}
+		if matched[i] {
+			b.WriteString("<mark>" + html.EscapeString(value[i:j]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(value[i:j]))
+		}
+		i = j
+	}
+	return b.String(), true
+}
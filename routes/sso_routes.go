@@ -0,0 +1,627 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"file-service/pkg/auth"
+	"file-service/pkg/models"
+	"file-service/pkg/oidc"
+	"file-service/pkg/repository"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ssoLoginTTL is how long a started SSO login can be completed
+const ssoLoginTTL = 10 * time.Minute
+
+// ssoScopes are requested from identity providers; groups arrive in the claim named by the connection
+var ssoScopes = []string{"openid", "email", "profile"}
+
+// domainPattern allows lowercase host names with at least one dot
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+type SSORoutes struct {
+	ssoRepo       *repository.SSORepository
+	clientRepo    *repository.ClientRepository
+	auth          *AuthRoutes
+	oidc          *oidc.Client
+	encryptionKey string
+	redirectURL   string
+	// lookupTXT resolves the TXT records that prove control of a claimed domain
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+}
+
+func NewSSORoutes(ssoRepo *repository.SSORepository, clientRepo *repository.ClientRepository, authRoutes *AuthRoutes, oidcClient *oidc.Client, encryptionKey string, redirectURL string) *SSORoutes {
+	return &SSORoutes{
+		ssoRepo:       ssoRepo,
+		clientRepo:    clientRepo,
+		auth:          authRoutes,
+		oidc:          oidcClient,
+		encryptionKey: encryptionKey,
+		redirectURL:   redirectURL,
+		lookupTXT:     net.DefaultResolver.LookupTXT,
+	}
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return email[at+1:]
+}
+
+// normalizeSSODomains lowercases and deduplicates domains and reports whether the client's claims
+// count as verified. Only operators' do; other clients prove control of each new domain with a DNS TXT
+// record at VerifyDomain before logins may use it, so nobody can sign in as another organisation's users.
+func (sr *SSORoutes) normalizeSSODomains(clientID string, domains []string) ([]string, bool, error) {
+	if len(domains) == 0 {
+		return nil, false, errors.New("allowed_domains required")
+	}
+
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if !domainPattern.MatchString(domain) {
+			return nil, false, errors.New("allowed_domains must be domain names such as example.com")
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			normalized = append(normalized, domain)
+		}
+	}
+
+	operator, err := sr.clientRepo.IsOperator(clientID)
+	if err != nil {
+		return nil, false, errors.New("failed to check domain ownership")
+	}
+
+	return normalized, operator, nil
+}
+
+// encryptClientSecret seals an IdP client secret; public clients relying on PKCE alone have none
+func (sr *SSORoutes) encryptClientSecret(secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+	return auth.EncryptSecret(sr.encryptionKey, secret)
+}
+
+// respondSSOError writes the response for a failed connection change
+func respondSSOError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrSSOSlugTaken), errors.Is(err, repository.ErrSSODomainTaken):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrSSOProjectNotOwned):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "SSO connection not found"})
+	}
+}
+
+// CreateConnection registers an OpenID Connect identity provider for the caller's organisation
+func (sr *SSORoutes) CreateConnection(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Slug                 string   `json:"slug"`
+		Name                 string   `json:"name"`
+		Issuer               string   `json:"issuer"`
+		OIDCClientID         string   `json:"oidc_client_id"`
+		OIDCClientSecret     string   `json:"oidc_client_secret"`
+		AllowedDomains       []string `json:"allowed_domains"`
+		GroupsClaim          string   `json:"groups_claim"`
+		TrustUnverifiedEmail bool     `json:"trust_unverified_email"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	req.Name = strings.TrimSpace(req.Name)
+	req.OIDCClientID = strings.TrimSpace(req.OIDCClientID)
+	if req.Slug == "" || req.Name == "" || req.Issuer == "" || req.OIDCClientID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "slug, name, issuer and oidc_client_id required"})
+	}
+	if !slugPattern.MatchString(req.Slug) || strings.Contains(req.Slug, "--") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "slug must be 3-63 lowercase letters, digits or single hyphens"})
+	}
+	if req.GroupsClaim = strings.TrimSpace(req.GroupsClaim); req.GroupsClaim == "" {
+		req.GroupsClaim = "groups"
+	}
+
+	domains, verified, err := sr.normalizeSSODomains(clientID, req.AllowedDomains)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	provider, err := sr.oidc.Discover(c.Request().Context(), req.Issuer)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "could not use identity provider: " + err.Error()})
+	}
+
+	secret, err := sr.encryptClientSecret(req.OIDCClientSecret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to store client secret"})
+	}
+
+	conn, err := sr.ssoRepo.CreateConnection(&models.SSOConnection{
+		ClientID:             clientID,
+		Slug:                 req.Slug,
+		Name:                 req.Name,
+		Issuer:               strings.TrimRight(provider.Issuer, "/"),
+		OIDCClientID:         req.OIDCClientID,
+		OIDCClientSecret:     secret,
+		AllowedDomains:       domains,
+		GroupsClaim:          req.GroupsClaim,
+		TrustUnverifiedEmail: req.TrustUnverifiedEmail,
+		Enabled:              true,
+	}, verified)
+	if errors.Is(err, repository.ErrSSOSlugTaken) || errors.Is(err, repository.ErrSSODomainTaken) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create SSO connection"})
+	}
+
+	return c.JSON(http.StatusCreated, conn)
+}
+
+// ListConnections returns the caller's SSO connections
+func (sr *SSORoutes) ListConnections(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	connections, err := sr.ssoRepo.ListConnections(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list SSO connections"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"connections": connections,
+	})
+}
+
+// GetConnection returns one of the caller's SSO connections with its group mappings
+func (sr *SSORoutes) GetConnection(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	conn, err := sr.ssoRepo.GetConnection(c.Param("id"), clientID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "SSO connection not found"})
+	}
+
+	return c.JSON(http.StatusOK, conn)
+}
+
+// UpdateConnection changes the provider settings, domains or enabled state of a connection
+func (sr *SSORoutes) UpdateConnection(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req models.SSOConnectionUpdate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name cannot be empty"})
+	}
+	if req.OIDCClientID != nil && strings.TrimSpace(*req.OIDCClientID) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "oidc_client_id cannot be empty"})
+	}
+	if req.GroupsClaim != nil && strings.TrimSpace(*req.GroupsClaim) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "groups_claim cannot be empty"})
+	}
+
+	verified := false
+	if req.AllowedDomains != nil {
+		domains, operator, err := sr.normalizeSSODomains(clientID, *req.AllowedDomains)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		req.AllowedDomains = &domains
+		verified = operator
+	}
+
+	if req.Issuer != nil {
+		provider, err := sr.oidc.Discover(c.Request().Context(), *req.Issuer)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "could not use identity provider: " + err.Error()})
+		}
+		issuer := strings.TrimRight(provider.Issuer, "/")
+		req.Issuer = &issuer
+	}
+
+	if req.OIDCClientSecret != nil {
+		secret, err := sr.encryptClientSecret(*req.OIDCClientSecret)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to store client secret"})
+		}
+		req.OIDCClientSecret = &secret
+	}
+
+	conn, err := sr.ssoRepo.UpdateConnection(c.Param("id"), clientID, req, verified)
+	if err != nil {
+		return respondSSOError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, conn)
+}
+
+// DeleteConnection removes an SSO connection; clients it provisioned keep their accounts and memberships
+func (sr *SSORoutes) DeleteConnection(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	if err := sr.ssoRepo.DeleteConnection(c.Param("id"), clientID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "SSO connection not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "SSO connection deleted"})
+}
+
+// VerifyDomain checks the TXT record of a domain the connection claims and, once it is published,
+// lets logins use the domain
+func (sr *SSORoutes) VerifyDomain(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+	connectionID := c.Param("id")
+
+	domain, err := sr.ssoRepo.GetDomain(connectionID, clientID, strings.ToLower(c.Param("domain")))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "domain not found"})
+	}
+	if domain.Verified {
+		return c.JSON(http.StatusOK, domain)
+	}
+
+	records, err := sr.lookupTXT(c.Request().Context(), domain.TXTRecord)
+	found := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.TXTValue {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if err != nil {
+			log.Printf("sso domain lookup failed for %s: %v", domain.TXTRecord, err)
+		}
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":      "verification record not found; DNS changes can take a while to appear",
+			"txt_record": domain.TXTRecord,
+			"txt_value":  domain.TXTValue,
+		})
+	}
+
+	if err := sr.ssoRepo.MarkDomainVerified(connectionID, domain.Domain); err != nil {
+		if errors.Is(err, repository.ErrSSODomainTaken) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify domain"})
+	}
+
+	sr.auth.audit(c, "sso.domain-verified", clientID, http.StatusOK, map[string]any{
+		"connection_id": connectionID,
+		"domain":        domain.Domain,
+	})
+
+	verified, err := sr.ssoRepo.GetDomain(connectionID, clientID, domain.Domain)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify domain"})
+	}
+	return c.JSON(http.StatusOK, verified)
+}
+
+// SetGroupMappings replaces the group to project role mappings of a connection
+func (sr *SSORoutes) SetGroupMappings(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		Mappings []models.SSOGroupMapping `json:"mappings"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	for i, mapping := range req.Mappings {
+		mapping.Group = strings.TrimSpace(mapping.Group)
+		if mapping.Group == "" || mapping.ProjectID == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "each mapping needs group and project_id"})
+		}
+		if _, err := uuid.Parse(mapping.ProjectID); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid project_id"})
+		}
+		if mapping.Role != "editor" && mapping.Role != "viewer" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "role must be editor or viewer"})
+		}
+		req.Mappings[i] = mapping
+	}
+
+	conn, err := sr.ssoRepo.ReplaceGroupMappings(c.Param("id"), clientID, req.Mappings)
+	if err != nil {
+		return respondSSOError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, conn)
+}
+
+// DiscoverSSO finds the SSO connection that handles an email address, so login forms can offer it
+func (sr *SSORoutes) DiscoverSSO(c echo.Context) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	domain := emailDomain(normalizeEmail(req.Email))
+	if domain == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "email required"})
+	}
+
+	conn, err := sr.ssoRepo.FindConnectionByDomain(domain)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no SSO connection for this email domain"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"slug": conn.Slug,
+		"name": conn.Name,
+	})
+}
+
+// StartSSOLogin begins an authorization code login with PKCE. The frontend sends the user to
+// authorization_url and, once the provider redirects back, checks that the returned state is the
+// one it started with before posting it with the code to CompleteSSOLogin.
+func (sr *SSORoutes) StartSSOLogin(c echo.Context) error {
+	return sr.startLogin(c, "")
+}
+
+// StartSSOLink begins the same flow for the signed-in client, to link the provider identity to its
+// account; existing accounts are never linked by email alone
+func (sr *SSORoutes) StartSSOLink(c echo.Context) error {
+	return sr.startLogin(c, c.Get("client_id").(string))
+}
+
+func (sr *SSORoutes) startLogin(c echo.Context, linkClientID string) error {
+	conn, err := sr.ssoRepo.GetConnectionBySlug(strings.ToLower(c.Param("slug")))
+	if err != nil || !conn.Enabled {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "SSO connection not found"})
+	}
+
+	provider, err := sr.oidc.Discover(c.Request().Context(), conn.Issuer)
+	if err != nil {
+		log.Printf("sso discovery failed for %s: %v", conn.Slug, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "identity provider unavailable"})
+	}
+
+	state, err := oidc.RandomToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start SSO login"})
+	}
+	nonce, err := oidc.RandomToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start SSO login"})
+	}
+	verifier, err := oidc.RandomToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start SSO login"})
+	}
+
+	login := repository.SSOLoginState{
+		ConnectionID: conn.ID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkClientID: linkClientID,
+	}
+	if err := sr.ssoRepo.CreateLoginState(state, login, ssoLoginTTL); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start SSO login"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"authorization_url": provider.AuthCodeURL(conn.OIDCClientID, sr.redirectURL, state, nonce, oidc.CodeChallengeS256(verifier), ssoScopes),
+		"state":             state,
+		"expires_in":        int(ssoLoginTTL.Seconds()),
+	})
+}
+
+// CompleteSSOLogin redeems the provider's code, provisions the client on its first login, applies
+// the connection's group mappings and returns a token pair, or an MFA challenge for clients with
+// two-factor authentication
+func (sr *SSORoutes) CompleteSSOLogin(c echo.Context) error {
+	var req struct {
+		State string `json:"state"`
+		Code  string `json:"code"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if req.State == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "state and code required"})
+	}
+
+	login, err := sr.ssoRepo.ConsumeLoginState(req.State)
+	if errors.Is(err, repository.ErrSSOStateInvalid) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to complete SSO login"})
+	}
+
+	conn, err := sr.ssoRepo.GetConnectionByID(login.ConnectionID)
+	if err != nil || !conn.Enabled {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "SSO connection not found"})
+	}
+
+	ssoFailed := func(reason string, status int, message string) error {
+		sr.auth.audit(c, "auth.sso-login-failed", "", status, map[string]any{
+			"connection": conn.Slug,
+			"reason":     reason,
+		})
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	ctx := c.Request().Context()
+	provider, err := sr.oidc.Discover(ctx, conn.Issuer)
+	if err != nil {
+		log.Printf("sso discovery failed for %s: %v", conn.Slug, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "identity provider unavailable"})
+	}
+
+	clientSecret := ""
+	if conn.OIDCClientSecret != "" {
+		if clientSecret, err = auth.DecryptSecret(sr.encryptionKey, conn.OIDCClientSecret); err != nil {
+			log.Printf("sso client secret of %s cannot be decrypted: %v", conn.Slug, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to complete SSO login"})
+		}
+	}
+
+	rawIDToken, err := sr.oidc.Exchange(ctx, provider, conn.OIDCClientID, clientSecret, sr.redirectURL, req.Code, login.CodeVerifier)
+	if err != nil {
+		log.Printf("sso code exchange failed for %s: %v", conn.Slug, err)
+		return ssoFailed("code exchange failed", http.StatusUnauthorized, "SSO login failed")
+	}
+
+	idToken, err := sr.oidc.VerifyIDToken(ctx, provider, conn.OIDCClientID, rawIDToken, login.Nonce)
+	if err != nil {
+		log.Printf("sso id token rejected for %s: %v", conn.Slug, err)
+		return ssoFailed("invalid id token", http.StatusUnauthorized, "SSO login failed")
+	}
+
+	// Emails the provider does not mark as verified are only trusted on connections that opted in
+	email := normalizeEmail(idToken.Email)
+	if email == "" || (!idToken.EmailVerified && !conn.TrustUnverifiedEmail) {
+		return ssoFailed("email missing or unverified", http.StatusForbidden, "identity provider did not supply a verified email address")
+	}
+	allowed := false
+	for _, domain := range conn.VerifiedDomains {
+		if emailDomain(email) == domain {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return ssoFailed("email domain not allowed", http.StatusForbidden, "email domain is not allowed for this SSO connection")
+	}
+
+	if login.LinkClientID != "" {
+		return sr.completeLink(c, conn, login.LinkClientID, idToken.Subject, email)
+	}
+
+	name := strings.TrimSpace(idToken.Name)
+	if name == "" {
+		name = email
+	}
+
+	// Provisioned clients get a password nobody knows; they can set one with a password reset
+	randomPassword, err := oidc.RandomToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to complete SSO login"})
+	}
+	passwordHash, err := auth.HashPassword(randomPassword)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to complete SSO login"})
+	}
+
+	clientID, created, err := sr.ssoRepo.ProvisionClient(conn.ID, idToken.Subject, email, name, passwordHash)
+	if errors.Is(err, repository.ErrSSOEmailInUse) {
+		return ssoFailed("email belongs to an unlinked account", http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("sso provisioning failed for %s: %v", email, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to provision account"})
+	}
+
+	client, err := sr.clientRepo.GetClientByID(clientID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to complete SSO login"})
+	}
+	if client.Status != "active" {
+		return c.JSON(http.StatusForbidden, accountPausedResponse(sr.clientRepo, client.ID))
+	}
+
+	groups := idToken.Groups(conn.GroupsClaim)
+	if err := sr.ssoRepo.SyncGroupRoles(conn.ID, client.ID, groups); err != nil {
+		log.Printf("sso group sync failed for %s: %v", client.Email, err)
+	}
+
+	// The identity provider only replaces the password; two-factor clients still finish at VerifyMFALogin
+	challenge, err := sr.auth.mfaChallenge(client)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if challenge != nil {
+		sr.auth.audit(c, "auth.sso-login", client.ID, http.StatusOK, map[string]any{
+			"connection":   conn.Slug,
+			"provisioned":  created,
+			"groups":       groups,
+			"mfa_required": true,
+		})
+		challenge["provisioned"] = created
+		return c.JSON(http.StatusOK, challenge)
+	}
+
+	accessToken, refreshToken, newDevice, err := sr.auth.issueTokens(c, client.ID, client.Email)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to issue tokens"})
+	}
+	if newDevice && !created {
+		sr.auth.sendNewDeviceEmail(client.Name, client.Email, c.Request().UserAgent(), c.RealIP())
+	}
+
+	sr.auth.audit(c, "auth.sso-login", client.ID, http.StatusOK, map[string]any{
+		"connection":  conn.Slug,
+		"provisioned": created,
+		"groups":      groups,
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"client":        client,
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"provisioned":   created,
+	})
+}
+
+// completeLink links a verified identity to the client that started the link; no tokens are issued
+func (sr *SSORoutes) completeLink(c echo.Context, conn *models.SSOConnection, clientID, subject, email string) error {
+	err := sr.ssoRepo.LinkIdentity(conn.ID, subject, clientID)
+	if errors.Is(err, repository.ErrSSOIdentityLinked) {
+		sr.auth.audit(c, "auth.sso-link-failed", clientID, http.StatusConflict, map[string]any{
+			"connection": conn.Slug,
+			"reason":     "identity linked to another account",
+		})
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("sso link failed for %s: %v", clientID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to link SSO identity"})
+	}
+
+	sr.auth.audit(c, "auth.sso-link", clientID, http.StatusOK, map[string]any{
+		"connection": conn.Slug,
+		"email":      email,
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":    "SSO identity linked",
+		"connection": conn.Slug,
+		"linked":     true,
+	})
+}
+
+// CleanupLoginStates deletes SSO logins that were started but never completed
+func (sr *SSORoutes) CleanupLoginStates() (int64, error) {
+	return sr.ssoRepo.DeleteExpiredLoginStates()
+}
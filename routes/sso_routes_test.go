@@ -0,0 +1,318 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-service/pkg/auth"
+	"file-service/pkg/models"
+	"file-service/pkg/oidc"
+	"file-service/pkg/oidc/oidctest"
+	"file-service/pkg/repository"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ssoTestKey         = "sso-test-encryption-key"
+	ssoTestRedirectURL = "http://app.test/sso/callback"
+)
+
+// ssoTestEnv serves the SSO handlers against a mock provider and a throwaway schema
+type ssoTestEnv struct {
+	db       *sql.DB
+	e        *echo.Echo
+	provider *oidctest.Provider
+	ssoRepo  *repository.SSORepository
+	conn     *models.SSOConnection
+}
+
+// newSSOTestEnv needs PostgreSQL: TEST_DATABASE_URL names a database the schema is loaded into,
+// inside a schema of its own that is dropped afterwards.
+func newSSOTestEnv(t *testing.T) *ssoTestEnv {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set; the SSO handler tests need PostgreSQL")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection, so the search path set below applies to every query
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	schemaName := "sso_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := db.Exec(`CREATE SCHEMA ` + schemaName + `; SET search_path TO ` + schemaName + `, public`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DROP SCHEMA ` + schemaName + ` CASCADE`) })
+
+	schema, err := os.ReadFile("../database/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("failed to load schema: %v", err)
+	}
+
+	provider, err := oidctest.NewProvider("", "file-service", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(provider.Handler())
+	t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+
+	clientRepo := repository.NewClientRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	ssoRepo := repository.NewSSORepository(db)
+	emailVerification := NewEmailVerificationRoutes(repository.NewEmailVerificationRepository(db), clientRepo, nil, "http://app.test", "Test")
+	mfa := NewMFARoutes(repository.NewMFARepository(db), clientRepo, projectRepo, ssoTestKey, "Test")
+	authRoutes := NewAuthRoutes(clientRepo, repository.NewRefreshTokenRepository(db), repository.NewSessionRepository(db), repository.NewPasswordResetRepository(db), repository.NewLoginAttemptRepository(db), repository.NewAuditRepository(db), emailVerification, mfa, "jwt-secret", nil, "http://app.test", "Test")
+	sr := NewSSORoutes(ssoRepo, clientRepo, authRoutes, oidc.NewClient(nil, true), ssoTestKey, ssoTestRedirectURL)
+
+	var ownerID string
+	err = db.QueryRow(`INSERT INTO clients (name, email, password_hash, platform_role) VALUES ('Operator', 'ops@example.org', 'x', 'operator') RETURNING id`).Scan(&ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := auth.EncryptSecret(ssoTestKey, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ssoRepo.CreateConnection(&models.SSOConnection{
+		ClientID:         ownerID,
+		Slug:             "acme",
+		Name:             "Acme",
+		Issuer:           provider.Issuer,
+		OIDCClientID:     "file-service",
+		OIDCClientSecret: secret,
+		AllowedDomains:   []string{"example.com"},
+		GroupsClaim:      "groups",
+		Enabled:          true,
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/auth/sso/:slug/authorize", sr.StartSSOLogin)
+	e.POST("/auth/sso/callback", sr.CompleteSSOLogin)
+	e.POST("/api/sso/:slug/link", sr.StartSSOLink, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("client_id", c.Request().Header.Get("X-Test-Client"))
+			return next(c)
+		}
+	})
+
+	return &ssoTestEnv{db: db, e: e, provider: provider, ssoRepo: ssoRepo, conn: conn}
+}
+
+func (env *ssoTestEnv) serve(t *testing.T, method, target string, body any, header http.Header) (int, map[string]any) {
+	t.Helper()
+	var reader *strings.Reader
+	if body == nil {
+		reader = strings.NewReader("")
+	} else {
+		encoded, _ := json.Marshal(body)
+		reader = strings.NewReader(string(encoded))
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	env.e.ServeHTTP(rec, req)
+
+	result := map[string]any{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return rec.Code, result
+}
+
+// start begins a login and returns the authorization URL and state
+func (env *ssoTestEnv) start(t *testing.T) (string, string) {
+	t.Helper()
+	status, body := env.serve(t, http.MethodGet, "/auth/sso/acme/authorize", nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("start returned %d: %v", status, body)
+	}
+	return body["authorization_url"].(string), body["state"].(string)
+}
+
+// authorize signs in at the mock provider, with overrides such as email or nonce applied to the
+// authorization URL, and returns the code it redirects back with
+func (env *ssoTestEnv) authorize(t *testing.T, authURL string, overrides url.Values) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	for name := range overrides {
+		query.Set(name, overrides.Get(name))
+	}
+	parsed.RawQuery = query.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(parsed.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	if !strings.HasPrefix(location.String(), ssoTestRedirectURL) {
+		t.Fatalf("provider redirected to %s", location)
+	}
+	return location.Query().Get("code")
+}
+
+func (env *ssoTestEnv) complete(t *testing.T, state, code string) (int, map[string]any) {
+	t.Helper()
+	return env.serve(t, http.MethodPost, "/auth/sso/callback", map[string]string{"state": state, "code": code}, nil)
+}
+
+// login runs a whole login for the user the overrides describe
+func (env *ssoTestEnv) login(t *testing.T, overrides url.Values) (int, map[string]any) {
+	t.Helper()
+	authURL, state := env.start(t)
+	return env.complete(t, state, env.authorize(t, authURL, overrides))
+}
+
+func TestSSOLoginProvisionsClient(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	status, body := env.login(t, url.Values{"email": {"alice@example.com"}})
+	if status != http.StatusOK || body["access_token"] == nil || body["provisioned"] != true {
+		t.Fatalf("first login: %d %v", status, body)
+	}
+
+	status, body = env.login(t, url.Values{"email": {"alice@example.com"}})
+	if status != http.StatusOK || body["access_token"] == nil || body["provisioned"] != false {
+		t.Fatalf("second login: %d %v", status, body)
+	}
+}
+
+func TestSSOLoginRejectsReplayedState(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	authURL, state := env.start(t)
+	if status, body := env.complete(t, state, env.authorize(t, authURL, nil)); status != http.StatusOK {
+		t.Fatalf("login: %d %v", status, body)
+	}
+
+	status, body := env.complete(t, state, env.authorize(t, authURL, nil))
+	if status != http.StatusBadRequest || body["access_token"] != nil {
+		t.Fatalf("replayed state: %d %v", status, body)
+	}
+}
+
+func TestSSOLoginRejectsWrongNonce(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	status, body := env.login(t, url.Values{"nonce": {"nonce-of-another-login"}})
+	if status != http.StatusUnauthorized || body["access_token"] != nil {
+		t.Fatalf("wrong nonce: %d %v", status, body)
+	}
+}
+
+func TestSSOLoginRejectsWrongDomain(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	status, body := env.login(t, url.Values{"email": {"mallory@elsewhere.test"}})
+	if status != http.StatusForbidden || body["access_token"] != nil {
+		t.Fatalf("other domain: %d %v", status, body)
+	}
+
+	// A claimed domain is not usable until it is verified
+	domains := []string{"example.com", "unverified.test"}
+	if _, err := env.ssoRepo.UpdateConnection(env.conn.ID, env.conn.ClientID, models.SSOConnectionUpdate{AllowedDomains: &domains}, false); err != nil {
+		t.Fatal(err)
+	}
+	status, body = env.login(t, url.Values{"email": {"bob@unverified.test"}})
+	if status != http.StatusForbidden || body["access_token"] != nil {
+		t.Fatalf("unverified domain: %d %v", status, body)
+	}
+}
+
+func TestSSOLoginRequiresVerifiedEmail(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	for _, claim := range []string{"false", "omit"} {
+		status, body := env.login(t, url.Values{"email": {"dave@example.com"}, "email_verified": {claim}})
+		if status != http.StatusForbidden || body["access_token"] != nil {
+			t.Fatalf("email_verified %s: %d %v", claim, status, body)
+		}
+	}
+
+	// A connection to a provider that never sends the claim can opt in to trusting its emails
+	trust := true
+	if _, err := env.ssoRepo.UpdateConnection(env.conn.ID, env.conn.ClientID, models.SSOConnectionUpdate{TrustUnverifiedEmail: &trust}, false); err != nil {
+		t.Fatal(err)
+	}
+	status, body := env.login(t, url.Values{"email": {"dave@example.com"}, "email_verified": {"omit"}})
+	if status != http.StatusOK || body["access_token"] == nil {
+		t.Fatalf("trusted connection: %d %v", status, body)
+	}
+}
+
+func TestSSOLoginDoesNotTakeOverExistingAccount(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	var victimID string
+	err := env.db.QueryRow(`INSERT INTO clients (name, email, password_hash, email_verified_at) VALUES ('Victim', 'victim@example.com', 'x', NOW()) RETURNING id`).Scan(&victimID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := env.login(t, url.Values{"email": {"victim@example.com"}, "sub": {"attacker"}})
+	if status != http.StatusConflict || body["access_token"] != nil {
+		t.Fatalf("login as existing account: %d %v", status, body)
+	}
+
+	// The owner links the identity while signed in; logins through it then reach the account
+	status, body = env.serve(t, http.MethodPost, "/api/sso/acme/link", nil, http.Header{"X-Test-Client": {victimID}})
+	if status != http.StatusOK {
+		t.Fatalf("start link: %d %v", status, body)
+	}
+	code := env.authorize(t, body["authorization_url"].(string), url.Values{"email": {"victim@example.com"}, "sub": {"victim"}})
+	if status, body := env.complete(t, body["state"].(string), code); status != http.StatusOK || body["linked"] != true {
+		t.Fatalf("complete link: %d %v", status, body)
+	}
+
+	status, body = env.login(t, url.Values{"email": {"victim@example.com"}, "sub": {"victim"}})
+	if status != http.StatusOK || body["access_token"] == nil {
+		t.Fatalf("login after link: %d %v", status, body)
+	}
+	if client, _ := body["client"].(map[string]any); client["id"] != victimID {
+		t.Fatalf("login after link reached %v, want %s", body["client"], victimID)
+	}
+}
+
+func TestSSOLoginAsksTwoFactorClientsForCode(t *testing.T) {
+	env := newSSOTestEnv(t)
+
+	if status, body := env.login(t, url.Values{"email": {"carol@example.com"}}); status != http.StatusOK {
+		t.Fatalf("first login: %d %v", status, body)
+	}
+	if _, err := env.db.Exec(`UPDATE clients SET mfa_secret = 'sealed', mfa_enabled_at = NOW() WHERE email = 'carol@example.com'`); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := env.login(t, url.Values{"email": {"carol@example.com"}})
+	if status != http.StatusOK || body["mfa_required"] != true || body["mfa_token"] == nil || body["access_token"] != nil {
+		t.Fatalf("two-factor client: %d %v", status, body)
+	}
+}
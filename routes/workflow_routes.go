@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"errors"
+	"file-service/pkg/rbac"
+	"file-service/pkg/rbac/presets"
+	"file-service/pkg/repository"
+	"file-service/pkg/workflow"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxTransitionNoteLength caps the note attached to a state change in characters
+const maxTransitionNoteLength = 2000
+
+type WorkflowRoutes struct {
+	workflowRepo *repository.WorkflowRepository
+	assetRepo    *repository.AssetRepository
+	access       *folderAccess
+}
+
+func NewWorkflowRoutes(workflowRepo *repository.WorkflowRepository, assetRepo *repository.AssetRepository, memberRepo *repository.MemberRepository, aclRepo *repository.FolderACLRepository, checker *rbac.RBACChecker) *WorkflowRoutes {
+	return &WorkflowRoutes{
+		workflowRepo: workflowRepo,
+		assetRepo:    assetRepo,
+		access:       newFolderAccess(memberRepo, aclRepo, checker),
+	}
+}
+
+// GetWorkflow returns the project's workflow and the transitions open to the caller
+func (wr *WorkflowRoutes) GetWorkflow(c echo.Context) error {
+	projectID := c.Param("id")
+
+	role, err := wr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionRead)
+	if err != nil {
+		return wr.access.respond(c, err)
+	}
+
+	def, custom, err := wr.workflowRepo.GetProjectWorkflow(projectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get workflow"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"workflow":      def,
+		"custom":        custom,
+		"initial_state": workflow.InitialState,
+		"role":          role,
+	})
+}
+
+// PutWorkflow replaces the project's transitions (owners)
+func (wr *WorkflowRoutes) PutWorkflow(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := wr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionManage); err != nil {
+		return wr.access.respond(c, err)
+	}
+
+	var def workflow.Definition
+	if err := c.Bind(&def); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if problems := def.Check(); len(problems) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]any{
+			"error":    "invalid workflow",
+			"problems": problems,
+		})
+	}
+
+	if err := wr.workflowRepo.SetProjectWorkflow(projectID, &def); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save workflow"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"workflow": def,
+		"custom":   true,
+	})
+}
+
+// ResetWorkflow restores the default workflow (owners)
+func (wr *WorkflowRoutes) ResetWorkflow(c echo.Context) error {
+	projectID := c.Param("id")
+
+	if _, err := wr.access.authorize(c, projectID, presets.ResourceProject, presets.ActionManage); err != nil {
+		return wr.access.respond(c, err)
+	}
+
+	if err := wr.workflowRepo.SetProjectWorkflow(projectID, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to reset workflow"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"workflow": workflow.Default(),
+		"custom":   false,
+	})
+}
+
+// TransitionAsset moves an asset to another workflow state if the project's workflow allows it for the caller's role
+func (wr *WorkflowRoutes) TransitionAsset(c echo.Context) error {
+	clientID := c.Get("client_id").(string)
+
+	var req struct {
+		To   workflow.State `json:"to"`
+		Note string         `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.To = workflow.State(strings.ToLower(strings.TrimSpace(string(req.To))))
+	if !workflow.ValidState(req.To) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown state: " + string(req.To)})
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len([]rune(req.Note)) > maxTransitionNoteLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "note is too long"})
+	}
+
+	asset, err := wr.assetRepo.FindAssetByID(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	// The workflow checks the effective role on the asset's folder, so folder entries narrow who may move it
+	role, err := wr.access.authorizeAsset(c, asset, folderRead)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	def, _, err := wr.workflowRepo.GetProjectWorkflow(asset.ProjectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get workflow"})
+	}
+
+	switch err := def.Authorize(asset.State, req.To, role); {
+	case errors.Is(err, workflow.ErrTransitionNotDefined):
+		return c.JSON(http.StatusConflict, map[string]any{
+			"error":     err.Error(),
+			"state":     asset.State,
+			"available": def.Available(asset.State, role),
+		})
+	case errors.Is(err, workflow.ErrRoleNotAllowed):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	updated, err := wr.workflowRepo.TransitionAsset(asset.ID, asset.State, req.To, clientID, req.Note)
+	if errors.Is(err, repository.ErrStateChanged) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to change asset state"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"asset":     updated,
+		"available": def.Available(updated.State, role),
+	})
+}
+
+// GetStateHistory lists who moved an asset between workflow states and when
+func (wr *WorkflowRoutes) GetStateHistory(c echo.Context) error {
+	asset, err := wr.assetRepo.FindAssetByID(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	if _, err := wr.access.authorizeAsset(c, asset, folderRead); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset not found"})
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	changes, info, err := wr.workflowRepo.GetStateHistory(asset.ID, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get state history"})
+	}
+
+	response := pageResponse("history", changes, page, info)
+	response["state"] = asset.State
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,41 @@
+// Command mock_oidc is a local OpenID provider for trying SSO logins without a real identity provider.
+//
+// It signs in whoever is asked for without a login page: /authorize redirects straight back with a code
+// for the user given by the flags, or by email, name, sub and groups query parameters on the authorization
+// URL; email_verified=false or email_verified=omit sends the email as unverified or without the claim.
+// Codes work once and only with the PKCE verifier of their challenge.
+//
+//	go run ./scripts/mock_oidc -addr :9999 -client-id file-service -client-secret secret -email alice@example.com -groups designers
+//
+// Register it as an SSO connection with issuer http://localhost:9999 and start the server with
+// SSO_ALLOW_HTTP_ISSUERS=true.
+package main
+
+import (
+	"file-service/pkg/oidc/oidctest"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9999", "issuer URL, as registered in the SSO connection")
+	clientID := flag.String("client-id", "file-service", "accepted client id")
+	clientSecret := flag.String("client-secret", "secret", "accepted client secret")
+	email := flag.String("email", "alice@example.com", "default email of the signed-in user")
+	name := flag.String("name", "Alice Example", "default name of the signed-in user")
+	groups := flag.String("groups", "", "default comma separated groups of the signed-in user")
+	flag.Parse()
+
+	provider, err := oidctest.NewProvider(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("failed to generate signing key: %v", err)
+	}
+	provider.Email = *email
+	provider.Name = *name
+	provider.Groups = oidctest.SplitGroups(*groups)
+
+	log.Printf("mock OIDC provider %s listening on %s", provider.Issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider.Handler()))
+}
@@ -47,7 +47,7 @@ func main() {
 	fmt.Println()
 
 	fmt.Println("=== Verifying Tables ===")
-	tables := []string{"clients", "projects", "assets", "api_keys", "project_members", "refresh_tokens"}
+	tables := []string{"clients", "projects", "assets", "api_keys", "project_members", "refresh_tokens", "audit_log", "project_metadata_schemas", "collections", "collection_assets", "asset_comments", "asset_state_history", "asset_pins", "folder_acls", "api_key_usage", "api_key_nonces", "sessions", "email_verification_tokens", "password_reset_tokens", "mfa_recovery_codes", "login_failures", "account_unlock_tokens", "sso_connections", "sso_domains", "sso_group_mappings", "sso_identities", "sso_login_states"}
 
 	for _, table := range tables {
 		var exists bool